@@ -1,12 +1,58 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
+	"time"
 
 	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/spf13/cobra"
 )
 
+const (
+	// defaultIPCTimeout bounds each request to the daemon. Override it with
+	// ENV_LEASE_IPC_TIMEOUT.
+	defaultIPCTimeout = 30 * time.Second
+	// defaultFetchTimeout bounds each call to a secret provider, leaving time
+	// to answer a biometric prompt. Override it with ENV_LEASE_FETCH_TIMEOUT.
+	defaultFetchTimeout = 2 * time.Minute
+)
+
+// envTimeout reads a duration from the environment variable name. An unset or
+// invalid value yields def; "0" disables the timeout.
+func envTimeout(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("Ignoring invalid timeout", "env", name, "value", value)
+		return def
+	}
+	return d
+}
+
+// commandContext returns the context of a running command, which is
+// cancelled on Ctrl-C. Commands run directly through RunE have none.
+func commandContext(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+// fetchContext bounds a single secret provider call.
+func fetchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := envTimeout("ENV_LEASE_FETCH_TIMEOUT", defaultFetchTimeout)
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
 func newIPCClient() *ipc.Client {
 	if os.Getenv("ENV_LEASE_TEST") == "1" {
 		return nil
@@ -15,17 +61,18 @@ func newIPCClient() *ipc.Client {
 	if err != nil {
 		handleClientError(fmt.Errorf("failed to get secret: %w", err))
 	}
-	return ipc.NewClient(getSocketPath(), secret)
+	client := ipc.NewClient(getSocketPath(), secret)
+	client.SetTimeout(envTimeout("ENV_LEASE_IPC_TIMEOUT", defaultIPCTimeout))
+	return client
 }
 
-func ensureDaemonClient() *ipc.Client {
+func ensureDaemonClient(ctx context.Context) *ipc.Client {
 	client := newIPCClient()
 	if client == nil {
 		return nil
 	}
 
-	var resp ipc.StatusResponse
-	if err := client.Send(ipc.StatusRequest{Command: "status"}, &resp); err != nil {
+	if _, err := client.Hello(ctx); err != nil {
 		handleClientError(err)
 	}
 	return client
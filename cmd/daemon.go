@@ -2,18 +2,44 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"runtime"
 	"time"
 
 	"github.com/lmittmann/tint"
+	"github.com/mblarsen/env-lease/internal/audit"
+	"github.com/mblarsen/env-lease/internal/config"
 	"github.com/mblarsen/env-lease/internal/daemon"
 	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/mblarsen/env-lease/internal/journal"
 	"github.com/mblarsen/env-lease/internal/xdgpath"
 	"github.com/spf13/cobra"
 )
 
+// instanceSuffix is appended to service names so each instance gets its own
+// service. It is empty for the default instance.
+func instanceSuffix() string {
+	if name := xdgpath.Instance(); name != xdgpath.DefaultInstance {
+		return "-" + name
+	}
+	return ""
+}
+
+// instanceArgs are the arguments a service definition passes to select the
+// current instance.
+func instanceArgs() []string {
+	if name := xdgpath.Instance(); name != xdgpath.DefaultInstance {
+		return []string{"--instance", name}
+	}
+	return nil
+}
+
 var daemonCmd = &cobra.Command{
 	Use:   "daemon",
 	Short: "Manage the env-lease daemon.",
@@ -41,7 +67,8 @@ var daemonStatusCmd = &cobra.Command{
 var daemonReloadCmd = &cobra.Command{
 	Use:   "reload",
 	Short: "Reload the env-lease daemon.",
-	Long:  `Reload the env-lease daemon.`,
+	Long: `Restart the env-lease daemon service, so it reads daemon.toml again and
+runs the installed version of env-lease.`,
 }
 
 var runCmd = &cobra.Command{
@@ -63,7 +90,7 @@ var runCmd = &cobra.Command{
 				TimeFormat: time.Kitchen,
 			}),
 		))
-		slog.Info("Starting daemon...")
+		slog.Info("Starting daemon...", "instance", xdgpath.Instance())
 
 		// Configuration paths
 		socketPath, err := xdgpath.RuntimePath("daemon.sock")
@@ -85,11 +112,34 @@ var runCmd = &cobra.Command{
 			return err
 		}
 
-		state, err := loadDaemonState(statePath)
+		daemonConfigPath, _ := cmd.Flags().GetString("config")
+		if daemonConfigPath == "" {
+			daemonConfigPath, err = xdgpath.ConfigPath("daemon.toml")
+			if err != nil {
+				return fmt.Errorf("failed to get config path: %w", err)
+			}
+		}
+		daemonConfig, err := config.LoadDaemonConfig(daemonConfigPath)
+		if err != nil {
+			return err
+		}
+
+		stateStore := daemon.NewStateStore(statePath, daemonConfig.StateEncryption, daemon.StateKeyFunc(secret, "state-key"+instanceSuffix()))
+		state, err := loadDaemonState(stateStore)
 		if err != nil {
 			return err
 		}
 
+		auditPath, err := xdgpath.StatePath("audit.log")
+		if err != nil {
+			return fmt.Errorf("failed to get audit log path: %w", err)
+		}
+		auditLog, err := audit.Open(auditPath, audit.DefaultMaxSize, audit.DefaultMaxBackups)
+		if err != nil {
+			return err
+		}
+		defer auditLog.Close()
+
 		// Set up dependencies
 		clock := &daemon.RealClock{}
 		revoker := &daemon.FileRevoker{}
@@ -98,27 +148,147 @@ var runCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		ioTimeout, handlerTimeout := daemonConfig.IPCTimeouts()
+		ipcServer.SetTimeouts(ipc.Timeouts{IO: ioTimeout, Handler: handlerTimeout})
 
 		// Create and run daemon
 		d := daemon.NewDaemon(state, statePath, clock, ipcServer, revoker, notifier)
-		slog.Info("Daemon startup successful.", "socket", ipcServer.SocketPath())
+		d.SetStateStore(stateStore)
+		journalDir, err := xdgpath.StatePath("pending")
+		if err != nil {
+			return fmt.Errorf("failed to get grant journal path: %w", err)
+		}
+		d.SetGrantJournal(journal.New(journalDir))
+		promptCachePath, err := xdgpath.RuntimePath("prompt.json")
+		if err != nil {
+			return fmt.Errorf("failed to get prompt cache path: %w", err)
+		}
+		d.SetPromptCache(promptCachePath)
+		d.SetShutdownPolicy(daemonConfig.ShutdownPolicy)
+		d.SetMaxRetryAttempts(daemonConfig.RetryMaxAttempts)
+		d.SetAuditLog(auditLog)
+		if daemonConfig.ShutdownPolicy == config.ShutdownPolicyRevokeOnLogout {
+			detector, err := daemon.NewLogindShutdownDetector()
+			if err != nil {
+				slog.Warn("Could not watch logind for shutdown; leases will be revoked on every shutdown", "err", err)
+			} else {
+				defer detector.Close()
+				d.SetShutdownDetector(detector)
+			}
+		}
+		// Session events come from systemd-logind, which only exists on Linux.
+		if daemonConfig.SessionRevoke != config.SessionRevokeOff && runtime.GOOS == "linux" {
+			watcher, err := daemon.NewLogindSessionWatcher()
+			if err != nil {
+				slog.Warn("Could not watch logind for session events; leases will not be revoked on lock, suspend or logout", "err", err)
+			} else {
+				defer watcher.Close()
+				d.SetSessionWatcher(watcher, daemonConfig.SessionRevoke)
+			}
+		}
+		// Projects and leases can set their own idle timeout, so measure idle
+		// time even without a default.
+		timeout := daemonConfig.IdleTimeoutDuration()
+		if source, err := daemon.NewIdleSource(daemonConfig.IdleSource); err != nil {
+			if timeout > 0 {
+				slog.Warn("Could not measure idle time; leases will not be revoked on idle", "err", err)
+			} else {
+				slog.Info("Could not measure idle time; idle_timeout settings will be ignored", "err", err)
+			}
+		} else {
+			if closer, ok := source.(io.Closer); ok {
+				defer closer.Close()
+			}
+			d.SetIdleSource(source, timeout)
+			slog.Info("Revoking leases on idle", "source", source.Name(), "timeout", timeout)
+		}
+		if daemonConfig.MetricsListen != "" {
+			metricsServer, err := serveMetrics(daemonConfig.MetricsListen, d.MetricsHandler())
+			if err != nil {
+				return err
+			}
+			defer metricsServer.Close()
+		}
+		slog.Info("Daemon startup successful.", "socket", ipcServer.SocketPath(), "socket_activated", ipcServer.Activated(), "shutdown_policy", daemonConfig.ShutdownPolicy, "session_revoke", daemonConfig.SessionRevoke)
 
 		return d.Run(context.Background())
 	},
 }
 
-func loadDaemonState(statePath string) (*daemon.State, error) {
-	state, err := daemon.LoadState(statePath)
-	if err != nil {
-		if daemon.IsCorruptStateError(err) {
-			slog.Warn("State file is malformed; starting with empty state", "path", statePath, "err", err)
-			return daemon.NewState(), nil
+func loadDaemonState(store *daemon.StateStore) (*daemon.State, error) {
+	state, err := store.Load()
+	var salvage *daemon.SalvageError
+	switch {
+	case err == nil:
+		slog.Info("Loaded state", "leases", len(state.Leases))
+		return state, nil
+	case errors.As(err, &salvage):
+		quarantineState(store, "State file is malformed; salvaged what could be read", "recovered", salvage.Recovered, "lost", len(salvage.Lost), "err", salvage.Cause)
+		for _, destination := range salvage.Lost {
+			slog.Warn("Lease could not be recovered and will not be revoked; remove its secret by hand", "destination", destination)
+		}
+		// Persist the salvaged leases right away so they are not lost with the
+		// quarantined file if the daemon stops before the next change.
+		if err := store.Save(state); err != nil {
+			slog.Warn("Failed to save salvaged state", "err", err)
 		}
+		return state, nil
+	case daemon.IsCorruptStateError(err):
+		quarantineState(store, "State file is malformed; starting with empty state", "err", err)
+		return daemon.NewState(), nil
+	case errors.Is(err, daemon.ErrStateKey):
+		// Starting empty would forget leases whose secrets are still on
+		// disk, and the key is usually only unavailable for now.
+		return nil, fmt.Errorf("%w; unlock the keyring or restore the auth.token the state was written with, then start the daemon again, or move %s aside to start with empty state and remove its leased secrets by hand", err, store.Path())
+	default:
 		return nil, fmt.Errorf("failed to load daemon state: %w", err)
 	}
+}
+
+// quarantineState moves an unusable state file aside so it is not
+// overwritten, and logs msg with where it was moved to.
+func quarantineState(store *daemon.StateStore, msg string, args ...any) {
+	quarantined, err := store.Quarantine()
+	if err != nil {
+		slog.Warn(msg, append(args, "path", store.Path(), "quarantine_err", err)...)
+		return
+	}
+	slog.Warn(msg, append(args, "quarantined", quarantined)...)
+}
+
+// serveMetrics starts an HTTP server for the metrics endpoint on the address
+// configured by metrics_listen.
+func serveMetrics(listen string, handler http.Handler) (*http.Server, error) {
+	network, address, err := config.ParseMetricsListen(listen)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove stale metrics socket: %w", err)
+		}
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics: %w", err)
+	}
+	if network == "unix" {
+		if err := os.Chmod(address, 0600); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("failed to set metrics socket permissions: %w", err)
+		}
+	}
 
-	slog.Info("Loaded state", "leases", len(state.Leases))
-	return state, nil
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Metrics server stopped", "err", err)
+		}
+	}()
+	slog.Info("Serving metrics", "network", network, "address", address)
+	return server, nil
 }
 
 var cleanupCmd = &cobra.Command{
@@ -135,7 +305,7 @@ var cleanupCmd = &cobra.Command{
 		req := ipc.CleanupRequest{Command: "cleanup"}
 		var resp ipc.CleanupResponse
 
-		if err := client.Send(req, &resp); err != nil {
+		if err := client.Send(commandContext(cmd), req, &resp); err != nil {
 			handleClientError(err)
 		}
 
@@ -147,6 +317,7 @@ var cleanupCmd = &cobra.Command{
 }
 
 func init() {
+	runCmd.Flags().String("config", "", "Path to the daemon config file (default: $XDG_CONFIG_HOME/env-lease/daemon.toml).")
 	daemonCmd.AddCommand(daemonInstallCmd)
 	daemonCmd.AddCommand(daemonUninstallCmd)
 	daemonCmd.AddCommand(daemonStatusCmd)
@@ -8,14 +8,21 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 
 	"github.com/mblarsen/env-lease/internal/fileutil"
 	"github.com/spf13/cobra"
 )
 
-const (
-	daemonServiceName = "com.user.env-lease.plist"
-)
+// daemonServiceLabel is the launchd label of the current instance's daemon.
+func daemonServiceLabel() string {
+	return "com.user.env-lease" + instanceSuffix()
+}
+
+// daemonServiceName is the file name of the current instance's plist.
+func daemonServiceName() string {
+	return daemonServiceLabel() + ".plist"
+}
 
 func init() {
 	daemonInstallCmd.RunE = runInstallDaemon
@@ -30,7 +37,7 @@ func runReloadDaemon(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	plistPath := filepath.Join(homeDir, launchdDir, daemonServiceName)
+	plistPath := filepath.Join(homeDir, launchdDir, daemonServiceName())
 
 	// Unload the service
 	if err := exec.Command("launchctl", "unload", plistPath).Run(); err != nil {
@@ -58,8 +65,13 @@ func runInstallDaemon(cmd *cobra.Command, args []string) error {
 	}
 
 	// Write the launchd plist
-	plistPath := filepath.Join(homeDir, launchdDir, daemonServiceName)
-	plistContent := fmt.Sprintf(daemonPlistTemplate, executable, homeDir, homeDir)
+	plistPath := filepath.Join(homeDir, launchdDir, daemonServiceName())
+	var programArgs strings.Builder
+	for _, arg := range append(instanceArgs(), "daemon", "run") {
+		fmt.Fprintf(&programArgs, "\n        <string>%s</string>", arg)
+	}
+	logName := "env-lease" + instanceSuffix()
+	plistContent := fmt.Sprintf(daemonPlistTemplate, daemonServiceLabel(), executable, programArgs.String(), homeDir, logName, homeDir, logName)
 	if _, err := fileutil.AtomicWriteFile(plistPath, []byte(plistContent), 0644); err != nil {
 		return err
 	}
@@ -79,7 +91,7 @@ func runUninstallDaemon(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	plistPath := filepath.Join(homeDir, launchdDir, daemonServiceName)
+	plistPath := filepath.Join(homeDir, launchdDir, daemonServiceName())
 
 	// Unload the service
 	_ = exec.Command("launchctl", "unload", plistPath).Run()
@@ -97,7 +109,7 @@ func runStatusDaemon(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	plistPath := filepath.Join(homeDir, launchdDir, daemonServiceName)
+	plistPath := filepath.Join(homeDir, launchdDir, daemonServiceName())
 	if _, err := os.Stat(plistPath); os.IsNotExist(err) {
 		fmt.Println("Daemon service is not installed.")
 		return nil
@@ -113,21 +125,19 @@ const daemonPlistTemplate = `<?xml version="1.0" encoding="UTF-8"?>
 <plist version="1.0">
 <dict>
     <key>Label</key>
-    <string>com.user.env-lease</string>
+    <string>%s</string>
     <key>ProgramArguments</key>
     <array>
-        <string>%s</string>
-        <string>daemon</string>
-        <string>run</string>
+        <string>%s</string>%s
     </array>
     <key>RunAtLoad</key>
     <true/>
     <key>KeepAlive</key>
     <true/>
     <key>StandardOutPath</key>
-    <string>%s/Library/Logs/env-lease.log</string>
+    <string>%s/Library/Logs/%s.log</string>
     <key>StandardErrorPath</key>
-    <string>%s/Library/Logs/env-lease.error.log</string>
+    <string>%s/Library/Logs/%s.error.log</string>
 </dict>
 </plist>
 `
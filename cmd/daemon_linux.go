@@ -4,20 +4,43 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/mblarsen/env-lease/internal/fileutil"
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/mblarsen/env-lease/internal/xdgpath"
 	"github.com/spf13/cobra"
 )
 
+// daemonServiceUnit and daemonSocketUnit name the systemd units of the
+// current instance.
+func daemonServiceUnit() string {
+	return "env-lease" + instanceSuffix() + ".service"
+}
+
+func daemonSocketUnit() string {
+	return "env-lease" + instanceSuffix() + ".socket"
+}
+
+// daemonExecStart is the command line a service runs the daemon with.
+func daemonExecStart(executable string) string {
+	return strings.Join(append([]string{executable}, append(instanceArgs(), "daemon", "run")...), " ")
+}
+
 const daemonServiceTemplate = `[Unit]
 Description=env-lease daemon
 
 [Service]
-ExecStart=%s daemon run
+ExecStart=%s
 Restart=always
 Environment="ENV_LEASE_LOG_LEVEL=info"
 
@@ -25,15 +48,47 @@ Environment="ENV_LEASE_LOG_LEVEL=info"
 WantedBy=default.target
 `
 
+// daemonActivatedServiceTemplate is installed alongside the socket unit. It
+// has no [Install] section, as systemd starts it on the first connection.
+const daemonActivatedServiceTemplate = `[Unit]
+Description=env-lease daemon
+Requires=%s
+
+[Service]
+ExecStart=%s
+Restart=on-failure
+Environment="ENV_LEASE_LOG_LEVEL=info"
+`
+
+const daemonSocketTemplate = `[Unit]
+Description=env-lease daemon socket
+
+[Socket]
+ListenStream=%s
+SocketMode=0600
+DirectoryMode=0700
+
+[Install]
+WantedBy=sockets.target
+`
+
 func init() {
 	daemonInstallCmd.RunE = runInstallDaemon
 	daemonUninstallCmd.RunE = runUninstallDaemon
+	daemonStatusCmd.RunE = runStatusDaemon
 	daemonInstallCmd.Flags().Bool("print", false, "Print the service configuration to stdout instead of installing it.")
+	daemonInstallCmd.Flags().Bool("socket", false, "Install a systemd socket unit that starts the daemon on first use.")
 	daemonReloadCmd.RunE = runReloadDaemon
 }
 
+func systemdUnitPath(unit string) string {
+	return filepath.Join(os.Getenv("HOME"), ".config", "systemd", "user", unit)
+}
+
+// runReloadDaemon restarts the service, as the unit has no ExecReload and the
+// daemon only reads its config and binary on start.
 func runReloadDaemon(cmd *cobra.Command, args []string) error {
-	if err := exec.Command("systemctl", "--user", "reload", "env-lease.service").Run(); err != nil {
+	if err := exec.Command("systemctl", "--user", "restart", daemonServiceUnit()).Run(); err != nil {
 		return fmt.Errorf("failed to reload daemon service: %w", err)
 	}
 	fmt.Println("Successfully reloaded env-lease daemon service.")
@@ -46,37 +101,201 @@ func runInstallDaemon(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	service := fmt.Sprintf(daemonServiceTemplate, executable)
+	socketActivated, _ := cmd.Flags().GetBool("socket")
+	units := map[string]string{
+		daemonServiceUnit(): fmt.Sprintf(daemonServiceTemplate, daemonExecStart(executable)),
+	}
+	enable := daemonServiceUnit()
+	if socketActivated {
+		units[daemonServiceUnit()] = fmt.Sprintf(daemonActivatedServiceTemplate, daemonSocketUnit(), daemonExecStart(executable))
+		units[daemonSocketUnit()] = fmt.Sprintf(daemonSocketTemplate, getSocketPath())
+		enable = daemonSocketUnit()
+	}
+
 	if print, _ := cmd.Flags().GetBool("print"); print {
-		fmt.Fprint(os.Stdout, service)
+		fmt.Fprint(os.Stdout, units[daemonServiceUnit()])
+		if socketActivated {
+			fmt.Fprintf(os.Stdout, "\n# %s\n%s", daemonSocketUnit(), units[daemonSocketUnit()])
+		}
 		fmt.Fprintln(os.Stderr, "WARNING: Service configuration printed but not installed.")
 		return nil
 	}
-	servicePath := filepath.Join(os.Getenv("HOME"), ".config", "systemd", "user", "env-lease.service")
 
-	if _, err := fileutil.AtomicWriteFile(servicePath, []byte(service), 0644); err != nil {
-		return err
+	for _, unit := range []string{daemonServiceUnit(), daemonSocketUnit()} {
+		content, ok := units[unit]
+		if !ok {
+			continue
+		}
+		if _, err := fileutil.AtomicWriteFile(systemdUnitPath(unit), []byte(content), 0644); err != nil {
+			return err
+		}
 	}
 
-	if err := exec.Command("systemctl", "--user", "enable", "--now", "env-lease.service").Run(); err != nil {
+	if socketActivated {
+		// A daemon started by an earlier plain install holds the socket path.
+		_ = exec.Command("systemctl", "--user", "disable", "--now", daemonServiceUnit()).Run()
+	}
+	if err := exec.Command("systemctl", "--user", "daemon-reload").Run(); err != nil {
+		return fmt.Errorf("failed to reload systemd: %w", err)
+	}
+	if err := exec.Command("systemctl", "--user", "enable", "--now", enable).Run(); err != nil {
 		return err
 	}
 
-	fmt.Printf("Successfully installed env-lease daemon service. Configuration file created at: %s\n", servicePath)
+	fmt.Printf("Successfully installed env-lease daemon service. Configuration file created at: %s\n", systemdUnitPath(daemonServiceUnit()))
+	if socketActivated {
+		fmt.Printf("The daemon starts on first use through %s.\n", systemdUnitPath(daemonSocketUnit()))
+	}
 	return nil
 }
 
 func runUninstallDaemon(cmd *cobra.Command, args []string) error {
-	servicePath := filepath.Join(os.Getenv("HOME"), ".config", "systemd", "user", "env-lease.service")
+	// Ignore errors, as the units may not be installed or running.
+	_ = exec.Command("systemctl", "--user", "disable", "--now", daemonSocketUnit(), daemonServiceUnit()).Run()
 
-	if err := exec.Command("systemctl", "--user", "disable", "--now", "env-lease.service").Run(); err != nil {
-		// Ignore errors, as the service may not be running
+	if err := os.Remove(systemdUnitPath(daemonSocketUnit())); err != nil && !os.IsNotExist(err) {
+		return err
 	}
-
-	if err := os.Remove(servicePath); err != nil {
+	if err := os.Remove(systemdUnitPath(daemonServiceUnit())); err != nil {
 		return err
 	}
+	_ = exec.Command("systemctl", "--user", "daemon-reload").Run()
 
 	fmt.Println("Successfully uninstalled env-lease daemon service.")
 	return nil
 }
+
+// daemonStatus is what `daemon status` reports on Linux.
+type daemonStatus struct {
+	Instance   string
+	Service    map[string]string
+	Socket     map[string]string
+	SocketPath string
+	Now        time.Time
+	// Leases and Failed are -1 when the daemon could not be asked.
+	Leases    int
+	Failed    int
+	LastError string
+}
+
+func runStatusDaemon(cmd *cobra.Command, args []string) error {
+	service, err := systemctlShow(daemonServiceUnit())
+	if err != nil {
+		return err
+	}
+	if service["LoadState"] == "not-found" {
+		fmt.Println("Daemon service is not installed.")
+		return nil
+	}
+	socket, err := systemctlShow(daemonSocketUnit())
+	if err != nil || socket["LoadState"] == "not-found" {
+		socket = nil
+	}
+
+	status := daemonStatus{
+		Instance:   xdgpath.Instance(),
+		Service:    service,
+		Socket:     socket,
+		SocketPath: getSocketPath(),
+		Now:        time.Now(),
+		Leases:     -1,
+		Failed:     -1,
+		LastError:  lastDaemonError(service),
+	}
+	// Only ask a running daemon: connecting to the socket would start a
+	// socket-activated one.
+	if service["ActiveState"] == "active" {
+		if client := newIPCClient(); client != nil {
+			var resp ipc.StatusResponse
+			if err := client.Send(commandContext(cmd), ipc.StatusRequest{Command: "status"}, &resp); err == nil {
+				status.Leases = len(resp.Leases)
+				status.Failed = len(resp.Failed)
+			}
+		}
+	}
+	writeDaemonStatus(os.Stdout, status)
+	return nil
+}
+
+// systemctlShow returns the properties of a user unit.
+func systemctlShow(unit string) (map[string]string, error) {
+	out, err := exec.Command("systemctl", "--user", "show", unit,
+		"--property=LoadState,ActiveState,SubState,UnitFileState,MainPID,ActiveEnterTimestamp,Result").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query systemd for %s: %w", unit, err)
+	}
+	return parseSystemctlShow(string(out)), nil
+}
+
+// parseSystemctlShow parses the KEY=VALUE lines printed by `systemctl show`.
+func parseSystemctlShow(out string) map[string]string {
+	props := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), "="); ok {
+			props[key] = value
+		}
+	}
+	return props
+}
+
+// lastDaemonError returns the most recent error the daemon logged, falling
+// back to the result systemd recorded for the service.
+func lastDaemonError(service map[string]string) string {
+	out, err := exec.Command("journalctl", "--user", "--unit", daemonServiceUnit(), "--priority", "err", "--lines", "1", "--output", "cat", "--no-pager").Output()
+	if err == nil {
+		if line := strings.TrimSpace(string(out)); line != "" && line != "-- No entries --" {
+			return line
+		}
+	}
+	if result := service["Result"]; result != "" && result != "success" {
+		return "service result: " + result
+	}
+	return ""
+}
+
+func writeDaemonStatus(out io.Writer, s daemonStatus) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Instance:\t%s\n", s.Instance)
+	fmt.Fprintf(w, "Service:\t%s\n", unitState(s.Service))
+	if s.Socket != nil {
+		fmt.Fprintf(w, "Socket unit:\t%s\n", unitState(s.Socket))
+	}
+	fmt.Fprintf(w, "Socket:\t%s\n", s.SocketPath)
+
+	if pid, _ := strconv.Atoi(s.Service["MainPID"]); pid > 0 {
+		fmt.Fprintf(w, "PID:\t%d\n", pid)
+	}
+	if s.Service["ActiveState"] == "active" {
+		if started, err := time.Parse("Mon 2006-01-02 15:04:05 MST", s.Service["ActiveEnterTimestamp"]); err == nil {
+			fmt.Fprintf(w, "Uptime:\t%s\n", s.Now.Sub(started).Truncate(time.Second))
+		}
+	}
+
+	switch {
+	case s.Leases >= 0:
+		fmt.Fprintf(w, "Leases:\t%d active, %d failed revocation(s)\n", s.Leases, s.Failed)
+	case s.Service["ActiveState"] == "active":
+		fmt.Fprintf(w, "Leases:\tunknown (daemon did not respond)\n")
+	}
+
+	lastError := s.LastError
+	if lastError == "" {
+		lastError = "none"
+	}
+	fmt.Fprintf(w, "Last error:\t%s\n", lastError)
+	w.Flush()
+}
+
+// unitState describes a unit like `systemctl status` does, for example
+// "active (running), enabled".
+func unitState(props map[string]string) string {
+	state := props["ActiveState"]
+	if sub := props["SubState"]; sub != "" && sub != state {
+		state += " (" + sub + ")"
+	}
+	if enabled := props["UnitFileState"]; enabled != "" {
+		state += ", " + enabled
+	}
+	return state
+}
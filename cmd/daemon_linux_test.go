@@ -0,0 +1,72 @@
+//go:build linux
+// +build linux
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSystemctlShow(t *testing.T) {
+	props := parseSystemctlShow("LoadState=loaded\nActiveState=active\nActiveEnterTimestamp=Sun 2026-10-18 09:00:00 UTC\nMainPID=4242\n")
+
+	assert.Equal(t, "loaded", props["LoadState"])
+	assert.Equal(t, "4242", props["MainPID"])
+	assert.Equal(t, "Sun 2026-10-18 09:00:00 UTC", props["ActiveEnterTimestamp"])
+}
+
+func TestWriteDaemonStatus(t *testing.T) {
+	now := time.Date(2026, 10, 18, 11, 30, 0, 0, time.UTC)
+
+	t.Run("running", func(t *testing.T) {
+		var out bytes.Buffer
+		writeDaemonStatus(&out, daemonStatus{
+			Instance: "default",
+			Service: map[string]string{
+				"ActiveState":          "active",
+				"SubState":             "running",
+				"UnitFileState":        "static",
+				"MainPID":              "4242",
+				"ActiveEnterTimestamp": "Sun 2026-10-18 09:00:00 UTC",
+			},
+			Socket:     map[string]string{"ActiveState": "active", "SubState": "running", "UnitFileState": "enabled"},
+			SocketPath: "/run/user/1000/env-lease/daemon.sock",
+			Now:        now,
+			Leases:     3,
+			Failed:     1,
+		})
+
+		assert.Equal(t, `Instance:     default
+Service:      active (running), static
+Socket unit:  active (running), enabled
+Socket:       /run/user/1000/env-lease/daemon.sock
+PID:          4242
+Uptime:       2h30m0s
+Leases:       3 active, 1 failed revocation(s)
+Last error:   none
+`, out.String())
+	})
+
+	t.Run("stopped with error", func(t *testing.T) {
+		var out bytes.Buffer
+		writeDaemonStatus(&out, daemonStatus{
+			Instance:   "work",
+			Service:    map[string]string{"ActiveState": "failed", "SubState": "failed", "UnitFileState": "enabled", "MainPID": "0"},
+			SocketPath: "/run/user/1000/env-lease/daemon.sock",
+			Now:        now,
+			Leases:     -1,
+			Failed:     -1,
+			LastError:  "service result: exit-code",
+		})
+
+		assert.Equal(t, `Instance:    work
+Service:     failed, enabled
+Socket:      /run/user/1000/env-lease/daemon.sock
+Last error:  service result: exit-code
+`, out.String())
+	})
+}
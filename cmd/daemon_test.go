@@ -16,12 +16,40 @@ func TestLoadDaemonStateFallsBackToEmptyStateOnCorruption(t *testing.T) {
 	statePath := filepath.Join(t.TempDir(), "state.json")
 	require.NoError(t, os.WriteFile(statePath, []byte("{"), 0600))
 
-	state, err := loadDaemonState(statePath)
+	state, err := loadDaemonState(daemon.NewStateStore(statePath, config.StateEncryptionOff, nil))
 
 	require.NoError(t, err)
 	require.NotNil(t, state)
 	assert.Empty(t, state.Leases)
 	assert.Empty(t, state.RetryQueue)
+
+	quarantined, err := filepath.Glob(statePath + ".corrupt-*")
+	require.NoError(t, err)
+	assert.Len(t, quarantined, 1)
+}
+
+func TestLoadDaemonStateKeepsSalvagedLeases(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	data := `{"version": 1, "leases": {"good": {"source": "op://vault/item/good"}, "bad": {"expires_at": 5}}}`
+	require.NoError(t, os.WriteFile(statePath, []byte(data), 0600))
+
+	state, err := loadDaemonState(daemon.NewStateStore(statePath, config.StateEncryptionOff, nil))
+
+	require.NoError(t, err)
+	assert.Contains(t, state.Leases, "good")
+	reloaded, err := daemon.LoadState(statePath)
+	require.NoError(t, err)
+	assert.Contains(t, reloaded.Leases, "good")
+}
+
+func TestLoadDaemonStateRefusesNewerState(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, os.WriteFile(statePath, []byte(`{"version": 99}`), 0600))
+
+	_, err := loadDaemonState(daemon.NewStateStore(statePath, config.StateEncryptionOff, nil))
+
+	assert.ErrorIs(t, err, daemon.ErrNewerState)
+	assert.FileExists(t, statePath)
 }
 
 func TestLoadDaemonStateReturnsPersistedStateWhenValid(t *testing.T) {
@@ -34,7 +62,7 @@ func TestLoadDaemonStateReturnsPersistedStateWhenValid(t *testing.T) {
 	}
 	require.NoError(t, expected.SaveState(statePath))
 
-	loaded, err := loadDaemonState(statePath)
+	loaded, err := loadDaemonState(daemon.NewStateStore(statePath, config.StateEncryptionOff, nil))
 
 	require.NoError(t, err)
 	require.NotNil(t, loaded)
@@ -45,10 +73,25 @@ func TestLoadDaemonStateReturnsPersistedStateWhenValid(t *testing.T) {
 func TestLoadDaemonStateReturnsErrorForUnreadableState(t *testing.T) {
 	statePath := t.TempDir()
 
-	state, err := loadDaemonState(statePath)
+	state, err := loadDaemonState(daemon.NewStateStore(statePath, config.StateEncryptionOff, nil))
 
 	require.Error(t, err)
 	assert.Nil(t, state)
 	assert.Contains(t, err.Error(), "failed to load daemon state")
 	assert.NotContains(t, err.Error(), "malformed")
 }
+
+func TestLoadDaemonStateFailsOnWrongKey(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	state := daemon.NewState()
+	state.Leases["lease1"] = &config.Lease{Source: "op://vault/item/field"}
+	writer := daemon.NewStateStore(statePath, config.StateEncryptionToken, daemon.StateKeyFunc([]byte("old-token"), "state-key"))
+	require.NoError(t, writer.Save(state))
+
+	loaded, err := loadDaemonState(daemon.NewStateStore(statePath, config.StateEncryptionToken, daemon.StateKeyFunc([]byte("new-token"), "state-key")))
+
+	require.ErrorIs(t, err, daemon.ErrStateKey)
+	assert.Nil(t, loaded)
+	assert.Contains(t, err.Error(), "auth.token")
+	assert.FileExists(t, statePath)
+}
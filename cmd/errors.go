@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -12,8 +13,17 @@ import (
 func handleClientError(err error) {
 	slog.Error("an ipc error occurred", "err", err)
 	var connErr *ipc.ConnectionError
-	if errors.As(err, &connErr) {
+	var versionErr *ipc.VersionMismatchError
+	if errors.Is(err, context.Canceled) {
+		_, _ = fmt.Fprintln(os.Stderr, "Error: interrupted.")
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		_, _ = fmt.Fprintln(os.Stderr, "Error: timed out waiting for the env-lease daemon. Set ENV_LEASE_IPC_TIMEOUT to wait longer.")
+	} else if errors.As(err, &connErr) {
 		_, _ = fmt.Fprintln(os.Stderr, "Error: env-lease daemon is not running. Please start it with 'env-lease daemon start'.")
+	} else if errors.As(err, &versionErr) {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %s.\n", versionErr)
+	} else if errors.Is(err, ipc.ErrInvalidResponseSignature) {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %s.\n", err)
 	} else {
 		_, _ = fmt.Fprintln(os.Stderr, "Error: could not connect to the env-lease daemon. Is it running?")
 	}
@@ -66,6 +66,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -75,16 +76,43 @@ import (
 	"time"
 
 	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/envfile"
 	"github.com/mblarsen/env-lease/internal/fileutil"
 	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/mblarsen/env-lease/internal/journal"
 	"github.com/mblarsen/env-lease/internal/provider"
 	"github.com/mblarsen/env-lease/internal/transform"
+	"github.com/mblarsen/env-lease/internal/xdgpath"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
 )
 
 var shellMode bool
 
+// beginGrantJournal starts the journal entry for a grant. It records the
+// grant's leases before their secrets are written, so the daemon can take
+// them over if the grant never reaches it. Journaling is skipped, and nil
+// returned, without a daemon client, as nothing could replay the entry.
+func beginGrantJournal(client *ipc.Client, configFile string) *journal.Pending {
+	if client == nil {
+		return nil
+	}
+	dir, err := xdgpath.StatePath("pending")
+	if err != nil {
+		slog.Warn("Grant journal unavailable", "err", err)
+		return nil
+	}
+	return journal.New(dir).Begin(configFile)
+}
+
+// commitGrantJournal drops the journal entry once the daemon has accepted the
+// grant.
+func commitGrantJournal(pending *journal.Pending) {
+	if err := pending.Commit(); err != nil {
+		slog.Warn("Failed to clean up grant journal", "err", err)
+	}
+}
+
 type grantError struct {
 	Source string
 	Err    error
@@ -112,7 +140,7 @@ func (e *GrantErrors) Error() string {
 	return strings.TrimRight(sb.String(), "\n")
 }
 
-func processSingleLease(cmd *cobra.Command, l config.Lease, secretVal string, projectRoot string, absConfigFile string, interactive bool, errs *[]grantError, continueOnError bool) ([]ipc.Lease, []string, error) {
+func processSingleLease(cmd *cobra.Command, l config.Lease, secretVal string, projectRoot string, absConfigFile string, interactive bool, errs *[]grantError, continueOnError bool, pending *journal.Pending) ([]ipc.Lease, []string, error) {
 	// Duration validation
 	duration, err := time.ParseDuration(l.Duration)
 	if err != nil {
@@ -124,15 +152,9 @@ func processSingleLease(cmd *cobra.Command, l config.Lease, secretVal string, pr
 
 	// Set default format
 	if l.Format == "" {
-		switch filepath.Base(l.Destination) {
-		case ".envrc":
-			l.Format = "export %s=%q"
-		case ".env":
-			l.Format = "%s=%q"
-		default:
-			if l.LeaseType == "env" {
-				return nil, nil, fmt.Errorf("lease for '%s' has no format specified", l.Destination)
-			}
+		l.Format = envfile.DefaultFor(l.Destination)
+		if l.Format == "" && l.LeaseType == "env" {
+			return nil, nil, fmt.Errorf("lease for '%s' has no format specified", l.Destination)
 		}
 	}
 
@@ -168,7 +190,9 @@ func processSingleLease(cmd *cobra.Command, l config.Lease, secretVal string, pr
 			} else {
 				p = &provider.OnePasswordCLI{Account: l.OpAccount}
 			}
-			secretVal, err = p.Fetch(l.Source)
+			fetchCtx, cancel := fetchContext(commandContext(cmd))
+			secretVal, err = p.Fetch(fetchCtx, l.Source)
+			cancel()
 			if err != nil {
 				return nil, nil, fmt.Errorf("failed to fetch secret: %w", err)
 			}
@@ -192,7 +216,7 @@ func processSingleLease(cmd *cobra.Command, l config.Lease, secretVal string, pr
 		switch result := transformResult.(type) {
 		case string:
 			// SINGLE LEASE CASE
-			finalLeases, sc, err := processLease(cmd, l, result, projectRoot, absConfigFile)
+			finalLeases, sc, err := processLease(cmd, l, result, projectRoot, absConfigFile, pending)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -208,7 +232,7 @@ func processSingleLease(cmd *cobra.Command, l config.Lease, secretVal string, pr
 			// Add a parent/container lease for the status command to find
 			parentLeaseConfig := l
 			parentLeaseConfig.Variable = "" // No single variable for the parent
-			parentLeases, _, err := processLease(cmd, parentLeaseConfig, "", projectRoot, absConfigFile)
+			parentLeases, _, err := processLease(cmd, parentLeaseConfig, "", projectRoot, absConfigFile, pending)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -223,7 +247,7 @@ func processSingleLease(cmd *cobra.Command, l config.Lease, secretVal string, pr
 					explodedLeaseConfig.Variable = key
 					explodedLeaseConfig.ParentSource = uniqueParentID
 
-					finalLeases, sc, err := processLease(cmd, explodedLeaseConfig, value, projectRoot, absConfigFile)
+					finalLeases, sc, err := processLease(cmd, explodedLeaseConfig, value, projectRoot, absConfigFile, pending)
 					if err != nil {
 						*errs = append(*errs, grantError{Source: key, Err: err})
 						if !continueOnError {
@@ -243,8 +267,9 @@ func processSingleLease(cmd *cobra.Command, l config.Lease, secretVal string, pr
 // fetchSecretsParallel retrieves raw secret material for the provided leases using the
 // same parallelized batching strategy as the interactive flow. The returned map is keyed
 // by source URI. Any encountered errors are returned as grantError entries; when
-// continueOnError is false, the first failure terminates early.
-func fetchSecretsParallel(leases []config.Lease, continueOnError bool, mode string) (map[string]string, []grantError, error) {
+// continueOnError is false, the first failure terminates early. The duration of
+// every provider call is returned so it can be reported to the daemon.
+func fetchSecretsParallel(ctx context.Context, leases []config.Lease, continueOnError bool, mode string) (map[string]string, []grantError, []ipc.ProviderFetch, error) {
 	type accountGroup struct {
 		account string
 		leases  []config.Lease
@@ -285,6 +310,7 @@ func fetchSecretsParallel(leases []config.Lease, continueOnError bool, mode stri
 
 	fetched := make(map[string]string, len(leases))
 	var errs []grantError
+	var timings []ipc.ProviderFetch
 
 	var fetchMu sync.Mutex
 	var fetchGroup errgroup.Group
@@ -305,7 +331,11 @@ func fetchSecretsParallel(leases []config.Lease, continueOnError bool, mode stri
 				p = &provider.OnePasswordCLI{Account: b.account}
 			}
 
-			secrets, perrs := p.FetchLeases(b.leases)
+			fetchCtx, cancel := fetchContext(ctx)
+			defer cancel()
+			start := time.Now()
+			secrets, perrs := p.FetchLeases(fetchCtx, b.leases)
+			timing := newProviderFetch("op", start, len(perrs) > 0)
 
 			localErrs := make([]grantError, 0, len(perrs))
 			for _, pe := range perrs {
@@ -313,6 +343,7 @@ func fetchSecretsParallel(leases []config.Lease, continueOnError bool, mode stri
 			}
 
 			fetchMu.Lock()
+			timings = append(timings, timing)
 			for src, val := range secrets {
 				fetched[src] = val
 			}
@@ -354,9 +385,14 @@ func fetchSecretsParallel(leases []config.Lease, continueOnError bool, mode stri
 				p = &provider.OnePasswordCLI{Account: lAccount}
 			}
 
-			val, err := p.Fetch(source)
+			fetchCtx, cancel := fetchContext(ctx)
+			defer cancel()
+			start := time.Now()
+			val, err := p.Fetch(fetchCtx, source)
+			timing := newProviderFetch(providerName(source), start, err != nil)
 			if err != nil {
 				fetchMu.Lock()
+				timings = append(timings, timing)
 				errs = append(errs, grantError{Source: source, Err: err})
 				fetchMu.Unlock()
 				if !continueOnError {
@@ -366,6 +402,7 @@ func fetchSecretsParallel(leases []config.Lease, continueOnError bool, mode stri
 			}
 
 			fetchMu.Lock()
+			timings = append(timings, timing)
 			fetched[source] = val
 			fetchMu.Unlock()
 
@@ -387,9 +424,14 @@ func fetchSecretsParallel(leases []config.Lease, continueOnError bool, mode stri
 				p = &provider.OnePasswordCLI{Account: lease.OpAccount}
 			}
 
-			val, err := p.Fetch(lease.Source)
+			fetchCtx, cancel := fetchContext(ctx)
+			defer cancel()
+			start := time.Now()
+			val, err := p.Fetch(fetchCtx, lease.Source)
+			timing := newProviderFetch(providerName(lease.Source), start, err != nil)
 			if err != nil {
 				fetchMu.Lock()
+				timings = append(timings, timing)
 				errs = append(errs, grantError{Source: lease.Source, Err: err})
 				fetchMu.Unlock()
 				if !continueOnError {
@@ -399,6 +441,7 @@ func fetchSecretsParallel(leases []config.Lease, continueOnError bool, mode stri
 			}
 
 			fetchMu.Lock()
+			timings = append(timings, timing)
 			fetched[lease.Source] = val
 			fetchMu.Unlock()
 
@@ -411,9 +454,22 @@ func fetchSecretsParallel(leases []config.Lease, continueOnError bool, mode stri
 
 	waitErr := fetchGroup.Wait()
 	if waitErr != nil && !continueOnError {
-		return fetched, errs, waitErr
+		return fetched, errs, timings, waitErr
+	}
+	return fetched, errs, timings, nil
+}
+
+// providerName returns the URI scheme of a secret source, used to label
+// provider fetch timings.
+func providerName(source string) string {
+	if scheme, _, ok := strings.Cut(source, "://"); ok {
+		return scheme
 	}
-	return fetched, errs, nil
+	return "unknown"
+}
+
+func newProviderFetch(provider string, start time.Time, failed bool) ipc.ProviderFetch {
+	return ipc.ProviderFetch{Provider: provider, Seconds: time.Since(start).Seconds(), Failed: failed}
 }
 
 var grantCmd = &cobra.Command{
@@ -425,6 +481,10 @@ For security, file-based leases are restricted to writing files only within the
 project root directory (the directory containing the env-lease.toml file).
 This can be overridden with the --destination-outside-root flag.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		// A dry run is a plan: nothing is fetched, journaled or written.
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			return runPlan(cmd)
+		}
 		resetConfirmState()
 		var (
 			cfg           *config.Config
@@ -443,6 +503,7 @@ This can be overridden with the --destination-outside-root flag.`,
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 		absConfigFile = filepath.Join(cfg.Root, filepath.Base(configFile))
+		applyProjectIdleTimeout(cfg)
 
 		interactive, _ := cmd.Flags().GetBool("interactive")
 		appendMode, _ := cmd.Flags().GetBool("append")
@@ -465,11 +526,16 @@ This can be overridden with the --destination-outside-root flag.`,
 				break
 			}
 		}
+		dialect, err := shellDialectFor(cmd)
+		if err != nil {
+			return err
+		}
 
-		client := ensureDaemonClient()
+		client := ensureDaemonClient(commandContext(cmd))
+		pending := beginGrantJournal(client, absConfigFile)
 
 		if interactive {
-			return interactiveGrant(cmd, cfg, absConfigFile, client)
+			return interactiveGrant(cmd, cfg, absConfigFile, client, pending)
 		}
 
 		continueOnError, _ := cmd.Flags().GetBool("continue-on-error")
@@ -477,7 +543,7 @@ This can be overridden with the --destination-outside-root flag.`,
 		var shellCommands []string
 		leases := make([]ipc.Lease, 0, len(cfg.Lease))
 
-		fetched, fetchErrs, fetchErr := fetchSecretsParallel(cfg.Lease, continueOnError, "non-interactive")
+		fetched, fetchErrs, fetches, fetchErr := fetchSecretsParallel(commandContext(cmd), cfg.Lease, continueOnError, "non-interactive")
 		errs = append(errs, fetchErrs...)
 		if fetchErr != nil {
 			return &GrantErrors{errs: errs}
@@ -492,7 +558,7 @@ This can be overridden with the --destination-outside-root flag.`,
 				}
 				continue
 			}
-			finalLeases, sc, err := processSingleLease(cmd, l, secretVal, cfg.Root, absConfigFile, false, &errs, continueOnError)
+			finalLeases, sc, err := processSingleLease(cmd, l, secretVal, cfg.Root, absConfigFile, false, &errs, continueOnError, pending)
 			if err != nil {
 				errs = append(errs, grantError{Source: l.Source, Err: err})
 				if !continueOnError {
@@ -515,6 +581,7 @@ This can be overridden with the --destination-outside-root flag.`,
 			Override:   override,
 			Append:     false,
 			ConfigFile: absConfigFile,
+			Fetches:    fetches,
 		}
 		// If in test mode, don't try to send to the daemon.
 		if os.Getenv("ENV_LEASE_TEST") == "1" {
@@ -527,9 +594,10 @@ This can be overridden with the --destination-outside-root flag.`,
 
 		if client != nil {
 			var resp ipc.GrantResponse
-			if err := client.Send(req, &resp); err != nil {
+			if err := client.Send(commandContext(cmd), req, &resp); err != nil {
 				handleClientError(err)
 			}
+			commitGrantJournal(pending)
 			for _, msg := range resp.Messages {
 				fmt.Fprintln(os.Stderr, msg)
 			}
@@ -546,10 +614,9 @@ This can be overridden with the --destination-outside-root flag.`,
 		}
 
 		if shellMode {
-			fmt.Fprintln(os.Stderr, "# When using shell lease types run this command like `eval $(env-lease grant)`")
-			for _, cmd := range shellCommands {
-				fmt.Println(cmd)
-			}
+			fmt.Fprintf(os.Stderr, "# When using shell lease types run this command like %s\n", dialect.usage("env-lease grant", false))
+			shellCommands = append(shellCommands, shellSessionCommands(dialect, leases)...)
+			fmt.Println(dialect.script(shellCommands, false))
 		}
 		fmt.Fprintln(os.Stderr, "Grant request sent successfully.")
 		return nil
@@ -573,7 +640,9 @@ This can be overridden with the --destination-outside-root flag.`,
 //     lease object to allow the daemon to associate the lease with a specific
 //     project, which is crucial for commands like `env-lease status` and
 //     `env-lease revoke` to correctly identify leases for the current project.
-func processLease(cmd *cobra.Command, l config.Lease, secretVal, projectRoot, configFile string) ([]ipc.Lease, []string, error) {
+//   - pending: The grant's journal entry, which records each lease before its
+//     secret is written. It is nil when the grant is not journaled.
+func processLease(cmd *cobra.Command, l config.Lease, secretVal, projectRoot, configFile string, pending *journal.Pending) ([]ipc.Lease, []string, error) {
 	var shellCommands []string
 	var leases []ipc.Lease
 	var absDest string
@@ -583,51 +652,27 @@ func processLease(cmd *cobra.Command, l config.Lease, secretVal, projectRoot, co
 	if l.LeaseType == "file" {
 		destinationOutsideRoot, _ := cmd.Flags().GetBool("destination-outside-root")
 		if !destinationOutsideRoot {
-			expandedDest, err := fileutil.ExpandPath(l.Destination)
-			if err != nil {
-				return nil, nil, fmt.Errorf("could not expand destination path: %w", err)
-			}
-			isInside, err := fileutil.IsPathInsideRoot(projectRoot, expandedDest)
-			if err != nil {
-				return nil, nil, fmt.Errorf("failed to validate destination path: %w", err)
-			}
-			if !isInside {
-				return nil, nil, fmt.Errorf("destination path '%s' is outside the project root. Use --destination-outside-root to override", l.Destination)
+			if err := checkDestinationInsideRoot(l, projectRoot); err != nil {
+				return nil, nil, err
 			}
 		}
 	}
 
 	if l.LeaseType == "shell" {
 		if l.Variable != "" {
-			shellCommands = append(shellCommands, fmt.Sprintf("export %s=%q", l.Variable, secretVal))
-		}
-		absDest = filepath.Join(projectRoot, "<shell>")
-	} else {
-		// For file/env leases, only write if there's a variable,
-		// or if it's a file lease. This prevents writing the
-		// parent/container lease of an explode.
-		if l.LeaseType == "file" || (l.LeaseType == "env" && l.Variable != "") {
-			override, _ := cmd.Flags().GetBool("override")
-			created, err := writeLease(l, secretVal, projectRoot, override)
+			dialect, err := shellDialectFor(cmd)
 			if err != nil {
-				return nil, nil, fmt.Errorf("failed to write lease: %w", err)
-			}
-			if created {
-				fmt.Fprintf(os.Stderr, "Created file: %s\n", l.Destination)
+				return nil, nil, err
 			}
+			shellCommands = append(shellCommands, dialect.set(l.Variable, secretVal))
 		}
-		absDest, err = fileutil.ExpandPath(l.Destination)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to expand path for %s: %w", l.Destination, err)
-		}
-		if !filepath.IsAbs(absDest) {
-			absDest = filepath.Join(projectRoot, absDest)
-		} else {
-			absDest = filepath.Clean(absDest)
-		}
+	}
+	absDest, err = leaseDestination(l, projectRoot)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	leases = append(leases, ipc.Lease{
+	lease := ipc.Lease{
 		Source:       l.Source,
 		Destination:  absDest,
 		Duration:     l.Duration,
@@ -638,10 +683,71 @@ func processLease(cmd *cobra.Command, l config.Lease, secretVal, projectRoot, co
 		FileMode:     l.FileMode,
 		ParentSource: l.ParentSource,
 		ConfigFile:   configFile,
-	})
+		RevokeOnLock: l.RevokeOnLock,
+		IdleTimeout:  l.IdleTimeout,
+	}
+	if l.LeaseType == "shell" {
+		lease.ShellSession = shellSessionID()
+	}
+
+	// For file/env leases, only write if there's a variable, or if it's a
+	// file lease. This prevents writing the parent/container lease of an
+	// explode.
+	if l.LeaseType == "file" || (l.LeaseType == "env" && l.Variable != "") {
+		// Journal the lease first so it is never on disk untracked.
+		if err := pending.Add(lease); err != nil {
+			return nil, nil, err
+		}
+		override, _ := cmd.Flags().GetBool("override")
+		created, err := writeLease(l, secretVal, projectRoot, override)
+		if err != nil {
+			if err := pending.Remove(lease); err != nil {
+				slog.Warn("Failed to drop unwritten lease from grant journal", "err", err)
+			}
+			return nil, nil, fmt.Errorf("failed to write lease: %w", err)
+		}
+		if created {
+			fmt.Fprintf(os.Stderr, "Created file: %s\n", l.Destination)
+		}
+	}
+
+	leases = append(leases, lease)
 	return leases, shellCommands, nil
 }
 
+// leaseDestination returns the absolute destination the daemon tracks a lease
+// by. Shell leases have none, so they get a placeholder in the project root.
+func leaseDestination(l config.Lease, projectRoot string) (string, error) {
+	if l.LeaseType == "shell" {
+		return filepath.Join(projectRoot, "<shell>"), nil
+	}
+	absDest, err := fileutil.ExpandPath(l.Destination)
+	if err != nil {
+		return "", fmt.Errorf("failed to expand path for %s: %w", l.Destination, err)
+	}
+	if !filepath.IsAbs(absDest) {
+		return filepath.Join(projectRoot, absDest), nil
+	}
+	return filepath.Clean(absDest), nil
+}
+
+// checkDestinationInsideRoot returns an error if the lease writes outside the
+// project root.
+func checkDestinationInsideRoot(l config.Lease, projectRoot string) error {
+	expandedDest, err := fileutil.ExpandPath(l.Destination)
+	if err != nil {
+		return fmt.Errorf("could not expand destination path: %w", err)
+	}
+	isInside, err := fileutil.IsPathInsideRoot(projectRoot, expandedDest)
+	if err != nil {
+		return fmt.Errorf("failed to validate destination path: %w", err)
+	}
+	if !isInside {
+		return fmt.Errorf("destination path '%s' is outside the project root. Use --destination-outside-root to override", l.Destination)
+	}
+	return nil
+}
+
 func init() {
 	grantCmd.Flags().Bool("override", false, "Override existing values in destination files.")
 	grantCmd.Flags().Bool("continue-on-error", false, "Continue granting leases even if one fails.")
@@ -651,6 +757,8 @@ func init() {
 	grantCmd.Flags().BoolP("interactive", "i", false, "Prompt for confirmation before granting each lease.")
 	grantCmd.Flags().Bool("append", false, "In interactive mode, keep existing granted leases and only add newly approved leases. Skipped prompts are left unchanged.")
 	grantCmd.Flags().Bool("destination-outside-root", false, "Allow file-based leases to write outside of the project root.")
+	grantCmd.Flags().Bool("dry-run", false, "Show what grant would change without changing anything, like 'env-lease plan'.")
+	grantCmd.Flags().String("shell", "", "Shell to print shell lease commands for: posix, fish, nu or powershell. Defaults to the shell in $SHELL.")
 	rootCmd.AddCommand(grantCmd)
 }
 
@@ -697,7 +805,7 @@ func getTransformSummary(transforms []string) string {
 // Round 1 and sub-leases from Round 2) into a single list and sends it to the
 // `env-lease` daemon to be activated. It also handles the output of any shell
 // commands for `shell` type leases.
-func interactiveGrant(cmd *cobra.Command, cfg *config.Config, absConfigFile string, client *ipc.Client) error {
+func interactiveGrant(cmd *cobra.Command, cfg *config.Config, absConfigFile string, client *ipc.Client, pending *journal.Pending) error {
 	slog.Debug("interactive grant: phase 1 start", "lease_count", len(cfg.Lease))
 	// ------- Phase 1: ROUND 1 – APPROVE SOURCES -------
 	selectedLeases := make([]config.Lease, 0, len(cfg.Lease))
@@ -739,7 +847,7 @@ func interactiveGrant(cmd *cobra.Command, cfg *config.Config, absConfigFile stri
 
 	var errs []grantError
 
-	fetched, fetchErrs, fetchErr := fetchSecretsParallel(selectedLeases, continueOnError, "interactive")
+	fetched, fetchErrs, fetches, fetchErr := fetchSecretsParallel(commandContext(cmd), selectedLeases, continueOnError, "interactive")
 	errs = append(errs, fetchErrs...)
 	if fetchErr != nil {
 		return &GrantErrors{errs: errs}
@@ -802,7 +910,7 @@ func interactiveGrant(cmd *cobra.Command, cfg *config.Config, absConfigFile stri
 			parentLeaseConfig := formatted
 			parentLeaseConfig.Variable = ""
 
-			parentLeases, _, err := processLease(cmd, parentLeaseConfig, "", cfg.Root, absConfigFile)
+			parentLeases, _, err := processLease(cmd, parentLeaseConfig, "", cfg.Root, absConfigFile, pending)
 			if err != nil {
 				errs = append(errs, grantError{Source: formatted.Source, Err: err})
 				if !continueOnError {
@@ -854,7 +962,7 @@ func interactiveGrant(cmd *cobra.Command, cfg *config.Config, absConfigFile stri
 	// First, materialize all simple leases (no new prompts)
 	for _, l := range simpleApproved {
 		val := fetched[l.Source]
-		leas, sc, err := processLease(cmd, l, val, cfg.Root, absConfigFile)
+		leas, sc, err := processLease(cmd, l, val, cfg.Root, absConfigFile, pending)
 		if err != nil {
 			errs = append(errs, grantError{Source: l.Source, Err: err})
 			if !continueOnError {
@@ -873,7 +981,7 @@ func interactiveGrant(cmd *cobra.Command, cfg *config.Config, absConfigFile stri
 		if !confirm(prompt) {
 			continue
 		}
-		leas, sc, err := processLease(cmd, ch.lease, ch.value, cfg.Root, absConfigFile)
+		leas, sc, err := processLease(cmd, ch.lease, ch.value, cfg.Root, absConfigFile, pending)
 		if err != nil {
 			errs = append(errs, grantError{Source: ch.lease.Source, Err: err})
 			if !continueOnError {
@@ -891,12 +999,13 @@ func interactiveGrant(cmd *cobra.Command, cfg *config.Config, absConfigFile stri
 
 	// ------- Phase 4: GRANT (single request) -------
 	slog.Debug("interactive grant: phase 4 start", "final_lease_count", len(finalLeases))
-	req := ipc.GrantRequest{Command: "grant", Leases: finalLeases, Override: override, Append: appendMode, ConfigFile: absConfigFile}
+	req := ipc.GrantRequest{Command: "grant", Leases: finalLeases, Override: override, Append: appendMode, ConfigFile: absConfigFile, Fetches: fetches}
 	if client != nil {
 		var resp ipc.GrantResponse
-		if err := client.Send(req, &resp); err != nil {
+		if err := client.Send(commandContext(cmd), req, &resp); err != nil {
 			handleClientError(err)
 		}
+		commitGrantJournal(pending)
 		for _, msg := range resp.Messages {
 			fmt.Fprintln(os.Stderr, msg)
 		}
@@ -912,16 +1021,33 @@ func interactiveGrant(cmd *cobra.Command, cfg *config.Config, absConfigFile stri
 	}
 
 	if shellMode {
-		fmt.Fprintln(os.Stderr, "# When using shell lease types run this command like `eval $(env-lease grant)`")
-		for _, c := range approvedShellCommands {
-			fmt.Println(c)
+		dialect, err := shellDialectFor(cmd)
+		if err != nil {
+			return err
 		}
+		fmt.Fprintf(os.Stderr, "# When using shell lease types run this command like %s\n", dialect.usage("env-lease grant", false))
+		approvedShellCommands = append(approvedShellCommands, shellSessionCommands(dialect, finalLeases)...)
+		fmt.Println(dialect.script(approvedShellCommands, false))
 	}
 
 	fmt.Fprintln(os.Stderr, "Grant request sent successfully.")
 	return nil
 }
 
+// applyProjectIdleTimeout gives leases without an idle_timeout that of their
+// project, so the daemon gets each lease's effective timeout and never has to
+// read config files itself.
+func applyProjectIdleTimeout(cfg *config.Config) {
+	if cfg.IdleTimeout == "" {
+		return
+	}
+	for i := range cfg.Lease {
+		if cfg.Lease[i].IdleTimeout == "" {
+			cfg.Lease[i].IdleTimeout = cfg.IdleTimeout
+		}
+	}
+}
+
 // hasExplode reports whether a lease has any explode transformation step.
 func hasExplode(steps []string) bool {
 	for _, t := range steps {
@@ -943,12 +1069,8 @@ func ensureLeaseFormat(l *config.Lease) error {
 		return nil
 	}
 
-	switch filepath.Base(l.Destination) {
-	case ".envrc":
-		l.Format = "export %s=%q"
-	case ".env":
-		l.Format = "%s=%q"
-	default:
+	l.Format = envfile.DefaultFor(l.Destination)
+	if l.Format == "" {
 		return fmt.Errorf("lease for '%s' has no format specified", l.Destination)
 	}
 	return nil
@@ -1,11 +1,20 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/daemon"
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/mblarsen/env-lease/internal/journal"
 )
 
 func TestGrantRunE(t *testing.T) {
@@ -41,7 +50,7 @@ duration = "1m"
 		}
 
 		content, _ := os.ReadFile(destFile)
-		expected := `export API_KEY="secret-for-mock"`
+		expected := `export API_KEY='secret-for-mock'`
 		if !strings.Contains(string(content), expected) {
 			t.Fatalf("expected content %q, got %q", expected, string(content))
 		}
@@ -64,7 +73,7 @@ duration = "1m"
 		}
 
 		content, _ := os.ReadFile(destFile)
-		expected := `API_KEY="secret-for-mock"`
+		expected := `API_KEY='secret-for-mock'`
 		if !strings.Contains(string(content), expected) {
 			t.Fatalf("expected content %q, got %q", expected, string(content))
 		}
@@ -315,3 +324,120 @@ duration = "1m"
 		t.Fatalf("expected daemon offline message, got %q", string(output))
 	}
 }
+
+func TestGrantDryRun(t *testing.T) {
+	t.Setenv("ENV_LEASE_TEST", "1")
+	tempDir := t.TempDir()
+	destFile := filepath.Join(tempDir, ".envrc")
+	configPath := filepath.Join(tempDir, "env-lease.toml")
+	configContent := `
+[[lease]]
+source = "mock"
+destination = "` + destFile + `"
+variable = "API_KEY"
+duration = "1m"
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	var out bytes.Buffer
+	grantCmd.SetOut(&out)
+	grantCmd.Flags().Set("config", configPath)
+	grantCmd.Flags().Set("dry-run", "true")
+	t.Cleanup(func() {
+		grantCmd.SetOut(nil)
+		grantCmd.Flags().Set("dry-run", "false")
+	})
+
+	if err := grantCmd.RunE(grantCmd, []string{}); err != nil {
+		t.Fatalf("grant --dry-run failed: %v", err)
+	}
+	if _, err := os.Stat(destFile); !os.IsNotExist(err) {
+		t.Fatalf("expected %s not to be written by a dry run", destFile)
+	}
+	if !strings.Contains(out.String(), "API_KEY") || !strings.Contains(out.String(), "1 to add") {
+		t.Fatalf("expected a plan adding API_KEY, got %q", out.String())
+	}
+}
+
+// TestGrantConflictIsNotAdopted checks that a lease whose write failed is not
+// left in the grant journal, where the daemon would adopt it once the CLI
+// exited and blank the user's own value when it expired.
+func TestGrantConflictIsNotAdopted(t *testing.T) {
+	tempDir := t.TempDir()
+	envrc := filepath.Join(tempDir, ".envrc")
+	if err := os.WriteFile(envrc, []byte("export API_KEY='mine'\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(tempDir, "env-lease.toml")
+	pendingDir := filepath.Join(tempDir, "pending")
+	j := journal.New(pendingDir)
+	pending := j.Begin(configFile)
+
+	grantCmd.Flags().Set("override", "false")
+	lease := config.Lease{Source: "mock", Destination: envrc, Duration: "1ms", LeaseType: "env", Variable: "API_KEY", Format: "posix-sh"}
+	if _, _, err := processLease(grantCmd, lease, "secret-for-mock", tempDir, configFile, pending); err == nil {
+		t.Fatal("expected the grant to fail on the existing value")
+	}
+
+	// The CLI exits with the error: make any entry it left look abandoned.
+	files, _ := filepath.Glob(filepath.Join(pendingDir, "*.json"))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var entry journal.Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			t.Fatal(err)
+		}
+		entry.PID = 1 << 30
+		data, _ = json.Marshal(entry)
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Starting the daemon replays the journal and revokes expired leases.
+	server, err := ipc.NewServer(filepath.Join(tempDir, "daemon.sock"), []byte("journal-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := daemon.NewDaemon(daemon.NewState(), filepath.Join(tempDir, "state.json"), &daemon.RealClock{}, server, &daemon.FileRevoker{}, nil)
+	d.SetGrantJournal(j)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = d.Run(ctx)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	<-done
+
+	content, err := os.ReadFile(envrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "export API_KEY='mine'") {
+		t.Fatalf("expected the user's value to survive, got %q", content)
+	}
+}
+
+func TestApplyProjectIdleTimeout(t *testing.T) {
+	cfg := &config.Config{
+		IdleTimeout: "10m",
+		Lease: []config.Lease{
+			{Source: "mock", Variable: "A"},
+			{Source: "mock", Variable: "B", IdleTimeout: "0"},
+		},
+	}
+	applyProjectIdleTimeout(cfg)
+	if got := cfg.Lease[0].IdleTimeout; got != "10m" {
+		t.Errorf("lease without idle_timeout: expected the project's '10m', got '%s'", got)
+	}
+	if got := cfg.Lease[1].IdleTimeout; got != "0" {
+		t.Errorf("lease with idle_timeout: expected its own '0', got '%s'", got)
+	}
+}
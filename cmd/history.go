@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/audit"
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/xdgpath"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show the audit log of lease lifecycle events.",
+	Long: `Show the audit log of lease lifecycle events.
+
+The daemon records every grant, renewal, revocation, expiry, failed revocation
+and orphan cleanup in an append-only log. Secret values are never recorded.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		auditPath, err := xdgpath.StatePath("audit.log")
+		if err != nil {
+			return fmt.Errorf("failed to get audit log path: %w", err)
+		}
+
+		var filter audit.Filter
+		if project, _ := cmd.Flags().GetBool("project"); project {
+			configFileFlag, _ := cmd.Flags().GetString("config")
+			filter.ConfigFile, err = config.ResolveConfigFile(configFileFlag)
+			if err != nil {
+				return err
+			}
+		}
+		if sinceFlag, _ := cmd.Flags().GetString("since"); sinceFlag != "" {
+			filter.Since, err = parseSince(sinceFlag, time.Now())
+			if err != nil {
+				return err
+			}
+		}
+
+		entries, err := audit.Read(auditPath, audit.DefaultMaxBackups, filter)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Println("No matching audit entries.")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "TIME\tACTION\tVARIABLE\tSOURCE\tDESTINATION\tACTOR")
+		for _, e := range entries {
+			variable := e.Variable
+			if variable == "" {
+				variable = "-"
+			}
+			actor := "daemon"
+			if e.ActorPID > 0 {
+				actor = fmt.Sprintf("pid %d", e.ActorPID)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format(time.DateTime), e.Action, variable, e.Source, e.Destination, actor)
+		}
+		return w.Flush()
+	},
+}
+
+// parseSince accepts either a duration relative to now (e.g. "24h") or an
+// absolute date or RFC 3339 timestamp.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value '%s': use a duration like '24h' or a date like '2006-01-02'", value)
+}
+
+func init() {
+	historyCmd.Flags().Bool("project", false, "Only show entries for the current project.")
+	historyCmd.Flags().String("since", "", "Only show entries newer than a duration (e.g. '24h') or date (e.g. '2006-01-02').")
+	historyCmd.Flags().StringP("config", "c", "env-lease.toml", "Path to config file.")
+	rootCmd.AddCommand(historyCmd)
+}
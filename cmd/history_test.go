@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	got, err := parseSince("24h", now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-24*time.Hour), got)
+
+	got, err = parseSince("2025-05-01T10:00:00Z", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC), got)
+
+	got, err = parseSince("2025-05-01", now)
+	require.NoError(t, err)
+	assert.Equal(t, 2025, got.Year())
+	assert.Equal(t, time.May, got.Month())
+
+	_, err = parseSince("yesterday", now)
+	assert.Error(t, err)
+}
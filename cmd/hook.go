@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// shellSessionEnv identifies the shell that evaluated a grant's output.
+	shellSessionEnv = "ENV_LEASE_SESSION"
+	// shellVarsEnv lists the shell lease variables the shell was given,
+	// separated by colons.
+	shellVarsEnv = "ENV_LEASE_SHELL_VARS"
+	// hookCheckTimeout keeps a slow daemon from holding up the prompt.
+	hookCheckTimeout = 2 * time.Second
+)
+
+var shellVariablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var (
+	shellSession     string
+	shellSessionOnce sync.Once
+)
+
+// shellSessionID returns the session ID of the shell running the command, or
+// a new one if it has none yet. grant exports it along with shell leases.
+func shellSessionID() string {
+	shellSessionOnce.Do(func() {
+		shellSession = os.Getenv(shellSessionEnv)
+		if shellSession == "" {
+			b := make([]byte, 16)
+			_, _ = rand.Read(b)
+			shellSession = hex.EncodeToString(b)
+		}
+	})
+	return shellSession
+}
+
+// shellSessionCommands returns the commands that record granted shell leases
+// in the shell's environment for 'env-lease hook'.
+func shellSessionCommands(dialect shellDialect, leases []ipc.Lease) []string {
+	vars := shellVars()
+	for _, l := range leases {
+		if l.LeaseType == "shell" && l.Variable != "" && !slices.Contains(vars, l.Variable) {
+			vars = append(vars, l.Variable)
+		}
+	}
+	if len(vars) == 0 {
+		return nil
+	}
+	slices.Sort(vars)
+	return []string{
+		dialect.set(shellSessionEnv, shellSessionID()),
+		dialect.set(shellVarsEnv, strings.Join(vars, ":")),
+	}
+}
+
+// shellVars returns the valid variable names in $ENV_LEASE_SHELL_VARS.
+func shellVars() []string {
+	var vars []string
+	for _, v := range strings.Split(os.Getenv(shellVarsEnv), ":") {
+		if shellVariablePattern.MatchString(v) {
+			vars = append(vars, v)
+		}
+	}
+	return vars
+}
+
+// hookScripts install a function that runs before each prompt and unsets
+// shell lease variables once their lease ends. The daemon is only asked while
+// the shell holds shell leases.
+var hookScripts = map[string]string{
+	"bash": `_env_lease_hook() {
+  local previous_exit_status=$?
+  if [ -n "$ENV_LEASE_SHELL_VARS" ]; then
+    eval "$(env-lease hook bash --check)"
+  fi
+  return $previous_exit_status
+}
+if [[ ";${PROMPT_COMMAND:-};" != *";_env_lease_hook;"* ]]; then
+  PROMPT_COMMAND="_env_lease_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+`,
+	"zsh": `_env_lease_hook() {
+  if [[ -n "$ENV_LEASE_SHELL_VARS" ]]; then
+    eval "$(env-lease hook zsh --check)"
+  fi
+}
+typeset -ag precmd_functions
+if (( ! ${precmd_functions[(I)_env_lease_hook]} )); then
+  precmd_functions=(_env_lease_hook $precmd_functions)
+fi
+`,
+	"fish": `function __env_lease_hook --on-event fish_prompt
+    if set -q ENV_LEASE_SHELL_VARS
+        env-lease hook fish --check | source
+    end
+end
+`,
+}
+
+var hookCmd = &cobra.Command{
+	Use:       "hook <bash|zsh|fish>",
+	Short:     "Print a shell hook that unsets shell leases when they end.",
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	Long: `Print a shell hook that unsets the variables of shell leases once they
+expire or are revoked. Add it to your shell's startup file:
+
+  bash:  eval "$(env-lease hook bash)"     in ~/.bashrc
+  zsh:   eval "$(env-lease hook zsh)"      in ~/.zshrc
+  fish:  env-lease hook fish | source      in ~/.config/fish/config.fish
+
+Before each prompt the hook asks the daemon which of the shell's leases are
+still active. It does nothing in shells that hold no shell leases.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		shell := args[0]
+		if check, _ := cmd.Flags().GetBool("check"); !check {
+			fmt.Fprint(cmd.OutOrStdout(), hookScripts[shell])
+			return nil
+		}
+
+		vars := shellVars()
+		session := os.Getenv(shellSessionEnv)
+		if len(vars) == 0 || session == "" {
+			return nil
+		}
+		client := newIPCClient()
+		if client == nil {
+			return nil
+		}
+		client.SetTimeout(hookCheckTimeout)
+		var resp ipc.ShellLeasesResponse
+		if err := client.Send(commandContext(cmd), ipc.ShellLeasesRequest{Command: "shell-leases", Session: session}, &resp); err != nil {
+			// Leave the variables alone rather than unset leases that may
+			// still be active.
+			slog.Debug("Could not check shell leases", "err", err)
+			return nil
+		}
+		writeHookUnsets(cmd.OutOrStdout(), cmd.ErrOrStderr(), shellDialects[shell], vars, resp.Variables)
+		return nil
+	},
+}
+
+// writeHookUnsets writes the commands that unset the variables in vars that
+// are no longer active, and tells the user which they were.
+func writeHookUnsets(out, errOut io.Writer, dialect shellDialect, vars, active []string) {
+	var ended, kept []string
+	for _, v := range vars {
+		if slices.Contains(active, v) {
+			kept = append(kept, v)
+		} else {
+			ended = append(ended, v)
+		}
+	}
+	if len(ended) == 0 {
+		return
+	}
+
+	for _, v := range ended {
+		fmt.Fprintln(out, dialect.unset(v))
+	}
+	if len(kept) == 0 {
+		fmt.Fprintln(out, dialect.unset(shellVarsEnv))
+	} else {
+		fmt.Fprintln(out, dialect.set(shellVarsEnv, strings.Join(kept, ":")))
+	}
+	fmt.Fprintf(errOut, "env-lease: unset %s (lease ended)\n", strings.Join(ended, ", "))
+}
+
+func init() {
+	hookCmd.Flags().Bool("check", false, "Print commands that unset ended shell leases. Used by the hook.")
+	_ = hookCmd.Flags().MarkHidden("check")
+	rootCmd.AddCommand(hookCmd)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellSessionCommands(t *testing.T) {
+	t.Setenv(shellSessionEnv, "abc123")
+	t.Setenv(shellVarsEnv, "OLD:bad name:ZED")
+	shellSessionOnce = sync.Once{}
+	t.Cleanup(func() { shellSessionOnce = sync.Once{} })
+
+	commands := shellSessionCommands(posixDialect, []ipc.Lease{
+		{LeaseType: "shell", Variable: "API_KEY"},
+		{LeaseType: "shell", Variable: "OLD"},
+		{LeaseType: "env", Variable: "DATABASE_URL"},
+	})
+	assert.Equal(t, []string{
+		"export ENV_LEASE_SESSION='abc123'",
+		"export ENV_LEASE_SHELL_VARS='API_KEY:OLD:ZED'",
+	}, commands)
+
+	t.Setenv(shellVarsEnv, "")
+	assert.Nil(t, shellSessionCommands(posixDialect, []ipc.Lease{{LeaseType: "env", Variable: "DATABASE_URL"}}))
+}
+
+func TestWriteHookUnsets(t *testing.T) {
+	tests := []struct {
+		shell  string
+		active []string
+		want   string
+	}{
+		{"zsh", []string{"API_KEY", "TOKEN"}, ""},
+		{"bash", []string{"API_KEY"}, "unset TOKEN\nexport ENV_LEASE_SHELL_VARS='API_KEY'\n"},
+		{"bash", nil, "unset API_KEY\nunset TOKEN\nunset ENV_LEASE_SHELL_VARS\n"},
+		{"fish", []string{"TOKEN"}, "set -e API_KEY\nset -gx ENV_LEASE_SHELL_VARS 'TOKEN'\n"},
+		{"fish", nil, "set -e API_KEY\nset -e TOKEN\nset -e ENV_LEASE_SHELL_VARS\n"},
+	}
+	for _, tt := range tests {
+		var out, errOut bytes.Buffer
+		writeHookUnsets(&out, &errOut, shellDialects[tt.shell], []string{"API_KEY", "TOKEN"}, tt.active)
+		assert.Equal(t, tt.want, out.String(), tt.shell)
+		if tt.want == "" {
+			assert.Empty(t, errOut.String())
+		} else {
+			assert.Contains(t, errOut.String(), "(lease ended)")
+		}
+	}
+}
+
+func TestHookScripts(t *testing.T) {
+	for _, shell := range hookCmd.ValidArgs {
+		assert.Contains(t, hookScripts[shell], "env-lease hook "+shell+" --check", shell)
+	}
+}
@@ -2,52 +2,100 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
 
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/mblarsen/env-lease/internal/xdgpath"
 	"github.com/spf13/cobra"
 )
 
 var idleCmd = &cobra.Command{
 	Use:   "idle",
-	Short: "Manage automatic lease revocation on system idle.",
-	Long:  `Manage the idle-based lease revocation service.`,
+	Short: "Inspect automatic lease revocation on system idle.",
+	Long:  `The daemon revokes leases once the user has been idle for idle_timeout, set in daemon.toml.`,
 }
 
 var idleInstallCmd = &cobra.Command{
-	Use:   "install",
-	Short: "Install and start the idle revocation service.",
-	Long:  `Installs and starts a system service that automatically revokes all leases after a specified period of user inactivity.`,
+	Use:        "install",
+	Short:      "Removed: set idle_timeout in daemon.toml instead.",
+	Deprecated: "idle revocation is built into the daemon; set idle_timeout in daemon.toml.",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// This will be implemented in the next steps.
-		fmt.Println("Installing idle service...")
-		return nil
+		path, err := xdgpath.ConfigPath("daemon.toml")
+		if err != nil {
+			return err
+		}
+		timeout, _ := cmd.Flags().GetString("timeout")
+		return fmt.Errorf("idle revocation is now built into the daemon: add idle_timeout = %q to %s and run 'env-lease daemon reload'", timeout, path)
 	},
 }
 
 var idleUninstallCmd = &cobra.Command{
 	Use:   "uninstall",
-	Short: "Uninstall the idle revocation service.",
-	Long:  `Stops and removes the idle-based lease revocation service.`,
+	Short: "Remove the idle revocation service installed by earlier versions.",
+	Long:  `Stops and removes the script and service that earlier versions of env-lease installed for idle revocation. To turn off the daemon's idle revocation, remove idle_timeout from daemon.toml.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// This will be implemented in the next steps.
-		fmt.Println("Uninstalling idle service...")
+		if err := uninstallLegacyIdleService(); err != nil {
+			return err
+		}
+		fmt.Println("Successfully uninstalled idle revocation service.")
 		return nil
 	},
 }
 
 var idleStatusCmd = &cobra.Command{
 	Use:   "status",
-	Short: "Check the status of the idle revocation service.",
-	Long:  `Checks whether the idle revocation service is installed and running.`,
+	Short: "Show how long the daemon has seen the user idle.",
+	Long:  `Shows the daemon's idle source, idle time and timeout.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// This will be implemented in the next steps.
-		fmt.Println("Checking idle service status...")
+		client := newIPCClient()
+		if client == nil {
+			fmt.Println("Idle status command running in test mode.")
+			return nil
+		}
+		var resp ipc.StatusResponse
+		if err := client.Send(commandContext(cmd), ipc.StatusRequest{Command: "status"}, &resp); err != nil {
+			handleClientError(err)
+		}
+		writeIdleStatus(os.Stdout, resp.Idle, time.Now())
 		return nil
 	},
 }
 
+// writeIdleStatus prints the daemon's idle state for `idle status`.
+func writeIdleStatus(out io.Writer, idle *ipc.IdleStatus, now time.Time) {
+	if idle == nil {
+		fmt.Fprintln(out, "Idle revocation is off: the daemon found no way to measure idle time. See idle_source in daemon.toml and the daemon log.")
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Source:\t%s\n", idle.Source)
+	fmt.Fprintf(w, "Timeout:\t%s\n", idleTimeoutLabel(idle.Timeout))
+	switch {
+	case idle.CheckedAt.IsZero():
+		fmt.Fprintf(w, "Idle:\tnot checked yet\n")
+	case idle.Error != "":
+		fmt.Fprintf(w, "Idle:\tunknown (%s)\n", idle.Error)
+	default:
+		fmt.Fprintf(w, "Idle:\t%s (checked %s ago)\n", idle.Idle.Truncate(time.Second), now.Sub(idle.CheckedAt).Truncate(time.Second))
+	}
+	w.Flush()
+}
+
+// idleTimeoutLabel describes the daemon's default idle timeout, which projects
+// and leases may override.
+func idleTimeoutLabel(timeout time.Duration) string {
+	if timeout == 0 {
+		return "none (set per project or lease)"
+	}
+	return timeout.String()
+}
+
 func init() {
 	idleInstallCmd.Flags().String("timeout", "1h", "Set the idle duration before leases are revoked (e.g., '1h', '30m').")
-	idleInstallCmd.Flags().String("check-interval", "5m", "Set the frequency for checking idle time (e.g., '1m', '5m').")
+	idleInstallCmd.Flags().String("check-interval", "5m", "Ignored.")
 
 	idleCmd.AddCommand(idleInstallCmd)
 	idleCmd.AddCommand(idleUninstallCmd)
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package cmd
+
+// uninstallLegacyIdleService has nothing to remove; earlier versions only
+// installed the idle service on Linux and macOS.
+func uninstallLegacyIdleService() error {
+	return nil
+}
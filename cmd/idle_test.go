@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteIdleStatus(t *testing.T) {
+	now := time.Date(2026, 10, 18, 11, 30, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	writeIdleStatus(&out, nil, now)
+	assert.Contains(t, out.String(), "Idle revocation is off")
+
+	out.Reset()
+	writeIdleStatus(&out, &ipc.IdleStatus{
+		Source:    "mutter",
+		Timeout:   30 * time.Minute,
+		Idle:      12*time.Minute + 1500*time.Millisecond,
+		CheckedAt: now.Add(-10 * time.Second),
+	}, now)
+	assert.Equal(t, "Source:   mutter\nTimeout:  30m0s\nIdle:     12m1s (checked 10s ago)\n", out.String())
+
+	out.Reset()
+	writeIdleStatus(&out, &ipc.IdleStatus{Source: "x11", Timeout: time.Hour, CheckedAt: now, Error: "x11: connection refused"}, now)
+	assert.Contains(t, out.String(), "Idle:     unknown (x11: connection refused)")
+
+	out.Reset()
+	writeIdleStatus(&out, &ipc.IdleStatus{Source: "logind"}, now)
+	assert.Contains(t, out.String(), "Timeout:  none (set per project or lease)")
+}
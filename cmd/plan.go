@@ -0,0 +1,441 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/envfile"
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/mblarsen/env-lease/internal/provider"
+	"github.com/mblarsen/env-lease/internal/transform"
+	"github.com/spf13/cobra"
+)
+
+// redactedValue stands in for secrets plan has not read.
+const redactedValue = "<redacted>"
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show what grant would change, without changing anything.",
+	Long: `Show what 'env-lease grant' would do: the files it would create, the lines it
+would add or replace, variables that already have a value and need --override,
+file destinations outside the project root, and the active leases the daemon
+would revoke because they are no longer in the config.
+
+Sources are checked at the provider without reading their values. Leases with
+an explode transform only list their variables with --fetch, which reads the
+secrets and runs the transforms like grant does. Values are never printed.
+
+Exits with an error if the grant would fail. 'grant --dry-run' is the same.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runPlan(cmd)
+	},
+}
+
+// planOptions are the grant flags that change the outcome of a plan.
+type planOptions struct {
+	override    bool
+	outsideRoot bool
+	fetch       bool
+}
+
+// planChange is one change plan predicts.
+type planChange struct {
+	// symbol is "+" for added, "~" for replaced, "=" for unchanged, "!" for
+	// a conflict, "-" for revoked and "?" for unknown.
+	symbol      string
+	destination string
+	variable    string
+	note        string
+}
+
+// plannedFile is what a destination holds as the plan's writes are applied.
+type plannedFile struct {
+	content []byte
+	exists  bool
+}
+
+// grantPlan is the outcome of running a grant without side effects.
+type grantPlan struct {
+	root     string
+	changes  []planChange
+	revokes  []planChange
+	problems []grantError
+	notes    []string
+
+	files   map[string]*plannedFile
+	planned map[string]bool
+	// unresolved holds the explode parents whose variables are unknown.
+	unresolved map[string]bool
+	active     map[string]ipc.Lease
+}
+
+func runPlan(cmd *cobra.Command) error {
+	configFileFlag, _ := cmd.Flags().GetString("config")
+	localConfigFileFlag, _ := cmd.Flags().GetString("local-config")
+	configFile, err := config.ResolveConfigFile(configFileFlag)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load(configFile, localConfigFileFlag)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	absConfigFile := filepath.Join(cfg.Root, filepath.Base(configFile))
+
+	var opts planOptions
+	opts.override, _ = cmd.Flags().GetBool("override")
+	opts.outsideRoot, _ = cmd.Flags().GetBool("destination-outside-root")
+	opts.fetch, _ = cmd.Flags().GetBool("fetch")
+
+	active, activeErr := planActiveLeases(commandContext(cmd), absConfigFile)
+	plan := buildGrantPlan(commandContext(cmd), cfg, opts, active)
+	if activeErr != nil {
+		plan.notes = append(plan.notes, fmt.Sprintf("Could not ask the daemon for active leases, so leases it would revoke are not shown: %v", activeErr))
+	}
+
+	plan.print(cmd.OutOrStdout(), absConfigFile)
+	if n := plan.failures(); n > 0 {
+		return fmt.Errorf("grant would fail: %d %s", n, pluralize(n, "problem", "problems"))
+	}
+	return nil
+}
+
+// planActiveLeases returns the project's active leases, or nil if there is no
+// daemon to ask.
+func planActiveLeases(ctx context.Context, configFile string) ([]ipc.Lease, error) {
+	client := newIPCClient()
+	if client == nil {
+		return nil, errors.New("no daemon in test mode")
+	}
+	var resp ipc.StatusResponse
+	if err := client.Send(ctx, ipc.StatusRequest{Command: "status", ConfigFile: configFile}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Leases, nil
+}
+
+// buildGrantPlan works out what grant would do with cfg. active are the
+// project's leases in the daemon.
+func buildGrantPlan(ctx context.Context, cfg *config.Config, opts planOptions, active []ipc.Lease) *grantPlan {
+	plan := &grantPlan{
+		root:       cfg.Root,
+		files:      make(map[string]*plannedFile),
+		planned:    make(map[string]bool),
+		unresolved: make(map[string]bool),
+		active:     make(map[string]ipc.Lease),
+	}
+	for _, l := range active {
+		plan.active[l.Source+"->"+l.Destination+"->"+l.Variable] = l
+	}
+
+	var values map[string]string
+	if opts.fetch {
+		var errs []grantError
+		values, errs, _, _ = fetchSecretsParallel(ctx, cfg.Lease, true, "plan")
+		plan.problems = append(plan.problems, errs...)
+	} else {
+		plan.problems = append(plan.problems, checkSources(ctx, cfg.Lease)...)
+	}
+
+	for _, l := range cfg.Lease {
+		value, known := values[l.Source]
+		if opts.fetch && !known {
+			// The failed fetch is already a problem.
+			continue
+		}
+		if err := plan.addLease(l, value, known, opts); err != nil {
+			plan.problems = append(plan.problems, grantError{Source: l.Source, Err: err})
+		}
+	}
+
+	for id, l := range plan.active {
+		if plan.planned[id] || plan.unresolved[l.ParentSource] {
+			continue
+		}
+		plan.revokes = append(plan.revokes, planChange{symbol: "-", destination: plan.display(l.Destination), variable: l.Variable, note: "removed from config"})
+	}
+	sort.Slice(plan.revokes, func(i, j int) bool {
+		a, b := plan.revokes[i], plan.revokes[j]
+		return a.destination+"\x00"+a.variable < b.destination+"\x00"+b.variable
+	})
+	return plan
+}
+
+// checkSources asks each provider that can whether the sources exist.
+func checkSources(ctx context.Context, leases []config.Lease) []grantError {
+	var errs []grantError
+	checked := make(map[string]bool)
+	for _, l := range leases {
+		if checked[l.Source] {
+			continue
+		}
+		checked[l.Source] = true
+
+		var p provider.SecretProvider
+		if os.Getenv("ENV_LEASE_TEST") == "1" {
+			p = &provider.MockProvider{}
+		} else {
+			p = &provider.OnePasswordCLI{Account: l.OpAccount}
+		}
+		checker, ok := p.(provider.SourceChecker)
+		if !ok {
+			continue
+		}
+		fetchCtx, cancel := fetchContext(ctx)
+		err := checker.Check(fetchCtx, l.Source)
+		cancel()
+		if err != nil {
+			errs = append(errs, grantError{Source: l.Source, Err: fmt.Errorf("source not found: %w", err)})
+		}
+	}
+	return errs
+}
+
+// addLease plans one lease from the config, mirroring processSingleLease and
+// processLease. value is the fetched secret if known is set.
+func (p *grantPlan) addLease(l config.Lease, value string, known bool, opts planOptions) error {
+	if _, err := time.ParseDuration(l.Duration); err != nil {
+		return fmt.Errorf("invalid duration '%s': %w", l.Duration, err)
+	}
+	if l.Format == "" {
+		l.Format = envfile.DefaultFor(l.Destination)
+		if l.Format == "" && l.LeaseType == "env" {
+			return fmt.Errorf("lease for '%s' has no format specified", l.Destination)
+		}
+	}
+	if l.LeaseType == "file" && !opts.outsideRoot {
+		if err := checkDestinationInsideRoot(l, p.root); err != nil {
+			return err
+		}
+	}
+	var pipeline *transform.Pipeline
+	if len(l.Transform) > 0 {
+		var err error
+		if pipeline, err = transform.NewPipeline(l.Transform); err != nil {
+			return fmt.Errorf("failed to create transform pipeline: %w", err)
+		}
+		// Without the secret the pipeline cannot run, but what each step
+		// gets and returns is known.
+		if err := pipeline.CheckShape(); err != nil {
+			return fmt.Errorf("invalid transform: %w", err)
+		}
+	}
+	explode := hasExplode(l.Transform)
+	if explode && l.LeaseType == "file" {
+		return fmt.Errorf("'explode' transform cannot be used with lease_type 'file'")
+	}
+	dest, err := leaseDestination(l, p.root)
+	if err != nil {
+		return err
+	}
+
+	if !known {
+		if explode {
+			p.planned[l.Source+"->"+dest+"->"] = true
+			p.unresolved[l.Source+"->"+dest] = true
+			p.changes = append(p.changes, planChange{symbol: "?", destination: p.display(dest), note: fmt.Sprintf("variables exploded from '%s' are known after fetching; use --fetch", l.Source)})
+			return nil
+		}
+		return p.addWrite(l, dest, l.Variable, redactedValue, false, opts)
+	}
+
+	var result any = value
+	if pipeline != nil {
+		if result, err = pipeline.Run(value); err != nil {
+			return fmt.Errorf("failed to transform secret: %w", err)
+		}
+	}
+	switch r := result.(type) {
+	case string:
+		return p.addWrite(l, dest, l.Variable, r, true, opts)
+	case transform.ExplodedData:
+		return p.addExploded(l, dest, r, opts)
+	default:
+		return fmt.Errorf("select returned structured data; select a value or end with 'to_json' or 'explode'")
+	}
+}
+
+// addExploded plans the variables of an explode, in name order.
+func (p *grantPlan) addExploded(l config.Lease, dest string, exploded transform.ExplodedData, opts planOptions) error {
+	p.planned[l.Source+"->"+dest+"->"] = true
+	keys := make([]string, 0, len(exploded))
+	for key := range exploded {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := p.addWrite(l, dest, key, exploded[key], true, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addWrite plans setting one variable, applying the write to the planned
+// file so later leases for the same destination see it.
+func (p *grantPlan) addWrite(l config.Lease, dest, variable, value string, known bool, opts planOptions) error {
+	id := l.Source + "->" + dest + "->" + variable
+	p.planned[id] = true
+	_, active := p.active[id]
+	change := planChange{destination: p.display(dest), variable: variable}
+
+	switch l.LeaseType {
+	case "shell":
+		change.symbol, change.note = "+", "export to shell"
+	case "file":
+		f, err := p.file(dest)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !f.exists:
+			change.symbol, change.note = "+", "create file"
+		case known && string(f.content) == value:
+			change.symbol, change.note = "=", "unchanged"
+		default:
+			change.symbol, change.note = "~", "overwrite file"
+		}
+		f.content, f.exists = []byte(value), true
+	case "env":
+		f, err := p.file(dest)
+		if err != nil {
+			return err
+		}
+		content, result, err := updateEnvContent(f.content, f.exists, variable, value, l.Format, opts.override)
+		var exists *valueExistsError
+		switch {
+		case errors.As(err, &exists) && !known && active:
+			change.symbol, change.note = "~", "renew; fails without --override if the secret changed"
+		case errors.As(err, &exists):
+			change.symbol, change.note = "!", "already has a value; use --override to replace it"
+		case err != nil:
+			return err
+		case result == envCreated:
+			change.symbol, change.note = "+", "create file"
+		case result == envAdded:
+			change.symbol, change.note = "+", "add"
+		case result == envReplaced:
+			change.symbol, change.note = "~", "replace"
+		default:
+			change.symbol, change.note = "=", "unchanged"
+		}
+		if err == nil {
+			f.content, f.exists = content, true
+		}
+	default:
+		return fmt.Errorf("unknown lease type: %s", l.LeaseType)
+	}
+	p.changes = append(p.changes, change)
+	return nil
+}
+
+// file returns the planned state of dest, reading it on first use.
+func (p *grantPlan) file(dest string) (*plannedFile, error) {
+	if f, ok := p.files[dest]; ok {
+		return f, nil
+	}
+	content, err := os.ReadFile(dest)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read existing file: %w", err)
+	}
+	f := &plannedFile{content: content, exists: err == nil}
+	p.files[dest] = f
+	return f, nil
+}
+
+// display shortens paths inside the project root.
+func (p *grantPlan) display(dest string) string {
+	if rel, err := filepath.Rel(p.root, dest); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return dest
+}
+
+// failures counts what would make the grant fail.
+func (p *grantPlan) failures() int {
+	n := len(p.problems)
+	for _, c := range p.changes {
+		if c.symbol == "!" {
+			n++
+		}
+	}
+	return n
+}
+
+func (p *grantPlan) print(w io.Writer, configFile string) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "Plan for %s:\n", configFile)
+	if len(p.changes) == 0 {
+		fmt.Fprintln(&out, "\n  No leases to grant.")
+	}
+	printPlanChanges(&out, p.changes)
+
+	if len(p.revokes) > 0 {
+		fmt.Fprintln(&out, "\nRevoked by reconciliation:")
+		printPlanChanges(&out, p.revokes)
+	}
+	if len(p.problems) > 0 {
+		fmt.Fprintln(&out, "\nProblems:")
+		for _, e := range p.problems {
+			fmt.Fprintf(&out, "  ✗ %s: %v\n", e.Source, e.Err)
+		}
+	}
+	for _, note := range p.notes {
+		fmt.Fprintf(&out, "\nNote: %s\n", note)
+	}
+
+	counts := make(map[string]int)
+	for _, c := range append(p.changes, p.revokes...) {
+		counts[c.symbol]++
+	}
+	fmt.Fprintf(&out, "\n%d to add, %d to replace, %d unchanged, %d to revoke, %d %s, %d %s.\n",
+		counts["+"], counts["~"], counts["="], counts["-"],
+		counts["!"], pluralize(counts["!"], "conflict", "conflicts"),
+		len(p.problems), pluralize(len(p.problems), "problem", "problems"))
+	_, _ = w.Write(out.Bytes())
+}
+
+// printPlanChanges lists changes under their destination, in the order the
+// destinations first appear.
+func printPlanChanges(w io.Writer, changes []planChange) {
+	var order []string
+	byDest := make(map[string][]planChange)
+	for _, c := range changes {
+		if _, ok := byDest[c.destination]; !ok {
+			order = append(order, c.destination)
+		}
+		byDest[c.destination] = append(byDest[c.destination], c)
+	}
+	for _, dest := range order {
+		fmt.Fprintf(w, "\n  %s\n", dest)
+		for _, c := range byDest[dest] {
+			fmt.Fprintf(w, "    %s %-24s %s\n", c.symbol, c.variable, c.note)
+		}
+	}
+}
+
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+func init() {
+	planCmd.Flags().Bool("fetch", false, "Read the secrets and run their transforms, to list exploded variables and unchanged values.")
+	planCmd.Flags().Bool("override", false, "Plan as if grant ran with --override.")
+	planCmd.Flags().Bool("destination-outside-root", false, "Plan as if grant ran with --destination-outside-root.")
+	planCmd.Flags().StringP("config", "c", "env-lease.toml", "Path to config file.")
+	planCmd.Flags().String("local-config", "", "Path to local override config file.")
+	rootCmd.AddCommand(planCmd)
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildGrantPlan(t *testing.T) {
+	t.Setenv("ENV_LEASE_TEST", "1")
+	root := t.TempDir()
+	envrc := filepath.Join(root, ".envrc")
+	require.NoError(t, os.WriteFile(envrc, []byte("export TOKEN='old'\nexport RENEWED='current'\n"), 0600))
+
+	cfg := &config.Config{
+		Root: root,
+		Lease: []config.Lease{
+			{Source: "mock", Destination: ".envrc", Variable: "API_KEY", Duration: "1h", LeaseType: "env"},
+			{Source: "mock", Destination: ".envrc", Variable: "TOKEN", Duration: "1h", LeaseType: "env"},
+			{Source: "mock", Destination: ".envrc", Variable: "RENEWED", Duration: "1h", LeaseType: "env"},
+			{Source: "mock-explode", Destination: ".env", Transform: []string{"json", "explode"}, Duration: "1h", LeaseType: "env"},
+			{Source: "mock-fail", Destination: "../key.pem", Duration: "1h", LeaseType: "file"},
+		},
+	}
+	active := []ipc.Lease{
+		{Source: "mock", Destination: envrc, Variable: "RENEWED"},
+		{Source: "old", Destination: envrc, Variable: "GONE"},
+		{Source: "mock-explode", Destination: filepath.Join(root, ".env"), Variable: "KEY1", ParentSource: "mock-explode->" + filepath.Join(root, ".env")},
+	}
+
+	t.Run("without fetching", func(t *testing.T) {
+		plan := buildGrantPlan(context.Background(), cfg, planOptions{}, active)
+		assert.Equal(t, []planChange{
+			{symbol: "+", destination: ".envrc", variable: "API_KEY", note: "add"},
+			{symbol: "!", destination: ".envrc", variable: "TOKEN", note: "already has a value; use --override to replace it"},
+			{symbol: "~", destination: ".envrc", variable: "RENEWED", note: "renew; fails without --override if the secret changed"},
+			{symbol: "?", destination: ".env", note: "variables exploded from 'mock-explode' are known after fetching; use --fetch"},
+		}, plan.changes)
+		// The exploded KEY1 may still be in the secret, so only GONE is
+		// known to be revoked.
+		assert.Equal(t, []planChange{{symbol: "-", destination: ".envrc", variable: "GONE", note: "removed from config"}}, plan.revokes)
+		require.Len(t, plan.problems, 2)
+		assert.ErrorContains(t, plan.problems[0].Err, "source not found")
+		assert.ErrorContains(t, plan.problems[1].Err, "outside the project root")
+		assert.Equal(t, 3, plan.failures())
+
+		var out bytes.Buffer
+		plan.print(&out, filepath.Join(root, "env-lease.toml"))
+		assert.Contains(t, out.String(), "1 to add, 1 to replace, 0 unchanged, 1 to revoke, 1 conflict, 2 problems.")
+		assert.NotContains(t, out.String(), "secret-for-mock")
+	})
+
+	t.Run("fetching with override", func(t *testing.T) {
+		plan := buildGrantPlan(context.Background(), cfg, planOptions{fetch: true, override: true, outsideRoot: true}, active)
+		assert.Equal(t, []planChange{
+			{symbol: "+", destination: ".envrc", variable: "API_KEY", note: "add"},
+			{symbol: "~", destination: ".envrc", variable: "TOKEN", note: "replace"},
+			{symbol: "~", destination: ".envrc", variable: "RENEWED", note: "replace"},
+			{symbol: "+", destination: ".env", variable: "KEY1", note: "create file"},
+			{symbol: "+", destination: ".env", variable: "KEY2", note: "add"},
+		}, plan.changes)
+		assert.Equal(t, []planChange{{symbol: "-", destination: ".envrc", variable: "GONE", note: "removed from config"}}, plan.revokes)
+		require.Len(t, plan.problems, 1)
+		assert.Equal(t, "mock-fail", plan.problems[0].Source)
+
+		content, err := os.ReadFile(envrc)
+		require.NoError(t, err)
+		assert.Equal(t, "export TOKEN='old'\nexport RENEWED='current'\n", string(content), "plan must not write")
+		assert.NoFileExists(t, filepath.Join(root, ".env"))
+	})
+}
+
+func TestBuildGrantPlanChecksTransformsWithoutFetching(t *testing.T) {
+	t.Setenv("ENV_LEASE_TEST", "1")
+	cfg := &config.Config{
+		Root: t.TempDir(),
+		Lease: []config.Lease{
+			{Source: "mock", Destination: ".envrc", Variable: "A", Duration: "1h", LeaseType: "env", Transform: []string{"select 'a'"}},
+			{Source: "mock", Destination: ".env", Duration: "1h", LeaseType: "env", Transform: []string{"base64-decode", "explode"}},
+			{Source: "mock", Destination: ".envrc", Variable: "B", Duration: "1h", LeaseType: "env", Transform: []string{"json"}},
+			{Source: "mock", Destination: ".envrc", Variable: "C", Duration: "1h", LeaseType: "env", Transform: []string{"json", "select 'c'"}},
+		},
+	}
+
+	plan := buildGrantPlan(context.Background(), cfg, planOptions{}, nil)
+	require.Len(t, plan.problems, 3)
+	assert.ErrorContains(t, plan.problems[0].Err, "select: input must be structured data")
+	assert.ErrorContains(t, plan.problems[1].Err, "explode: input must be structured data")
+	assert.ErrorContains(t, plan.problems[2].Err, "transforms produce structured data")
+	assert.Equal(t, []planChange{{symbol: "+", destination: ".envrc", variable: "C", note: "create file"}}, plan.changes)
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/template"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/promptcache"
+	"github.com/mblarsen/env-lease/internal/xdgpath"
+	"github.com/spf13/cobra"
+)
+
+const defaultPromptFormat = `🔑{{.Count}}{{if .Next}} ⏳{{.Next}}{{end}}{{if .Failed}} ⚠{{.Failed}}{{end}}`
+
+// promptSegment is the data 'env-lease prompt --format' templates see.
+type promptSegment struct {
+	// Count is the number of active leases.
+	Count int
+	// Next is the time until the first lease expires, e.g. "12m".
+	Next string
+	// NextExpiry is when the first lease expires.
+	NextExpiry time.Time
+	// Failed is the number of revocations that are being retried or were
+	// given up on.
+	Failed int
+}
+
+var promptCmd = &cobra.Command{
+	Use:   "prompt",
+	Short: "Print a short lease summary for the shell prompt.",
+	Long: `Print a short summary of the current project's leases for the shell prompt,
+like "🔑3 ⏳12m": three active leases, the first expiring in 12 minutes.
+
+It reads a cache the daemon keeps up to date instead of asking the daemon, so
+it is cheap enough to run on every prompt. It prints nothing when the project
+has no leases or the daemon isn't running.
+
+--format takes a Go template with the fields Count, Next, NextExpiry and
+Failed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		tmpl, err := template.New("prompt").Parse(format)
+		if err != nil {
+			return fmt.Errorf("invalid --format: %w", err)
+		}
+
+		configFileFlag, _ := cmd.Flags().GetString("config")
+		absConfigFile, err := config.ResolveConfigFile(configFileFlag)
+		if err != nil {
+			return err
+		}
+		cachePath, err := xdgpath.RuntimePath("prompt.json")
+		if err != nil {
+			return err
+		}
+		cache, err := promptcache.Read(cachePath)
+		if err != nil {
+			// No daemon, or one that predates the cache.
+			return nil
+		}
+		return writePrompt(cmd.OutOrStdout(), tmpl, cache, absConfigFile, time.Now())
+	},
+}
+
+// writePrompt renders the segment for configFile, or nothing if the project
+// has neither active leases nor failed revocations.
+func writePrompt(out io.Writer, tmpl *template.Template, cache promptcache.Cache, configFile string, now time.Time) error {
+	project, ok := cache.Find(configFile)
+	if !ok {
+		return nil
+	}
+	segment := promptSegment{Failed: project.Failed}
+	segment.Count, segment.NextExpiry = project.Active(now)
+	if segment.Count == 0 && segment.Failed == 0 {
+		return nil
+	}
+	if segment.Count > 0 {
+		segment.Next = compactDuration(segment.NextExpiry.Sub(now))
+	}
+	return tmpl.Execute(out, segment)
+}
+
+// compactDuration formats d in at most two units, rounded down, e.g. "45s",
+// "12m" or "1h5m".
+func compactDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	}
+	hours, minutes := int(d/time.Hour), int(d%time.Hour/time.Minute)
+	if minutes == 0 {
+		return fmt.Sprintf("%dh", hours)
+	}
+	return fmt.Sprintf("%dh%dm", hours, minutes)
+}
+
+func init() {
+	promptCmd.Flags().String("format", defaultPromptFormat, "Go template for the segment.")
+	promptCmd.Flags().StringP("config", "c", "env-lease.toml", "Path to config file.")
+	rootCmd.AddCommand(promptCmd)
+}
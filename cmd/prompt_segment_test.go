@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/promptcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritePrompt(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	cache := promptcache.Cache{Projects: map[string]promptcache.Project{
+		"/work/app/env-lease.toml": {Expires: []time.Time{now.Add(12*time.Minute + 30*time.Second), now.Add(time.Hour), now.Add(2 * time.Hour)}},
+		"/work/lib/env-lease.toml": {Expires: []time.Time{now.Add(-time.Minute)}, Failed: 1},
+		"/work/old/env-lease.toml": {Expires: []time.Time{now.Add(-time.Minute)}},
+	}}
+	tmpl := template.Must(template.New("prompt").Parse(defaultPromptFormat))
+	render := func(tmpl *template.Template, configFile string) string {
+		var out bytes.Buffer
+		require.NoError(t, writePrompt(&out, tmpl, cache, configFile, now))
+		return out.String()
+	}
+
+	assert.Equal(t, "🔑3 ⏳12m", render(tmpl, "/work/app/env-lease.toml"))
+	assert.Equal(t, "🔑3 ⏳12m", render(tmpl, "/work/app/src/env-lease.toml"))
+	assert.Equal(t, "🔑0 ⚠1", render(tmpl, "/work/lib/env-lease.toml"))
+	assert.Empty(t, render(tmpl, "/work/old/env-lease.toml"))
+	assert.Empty(t, render(tmpl, "/elsewhere/env-lease.toml"))
+
+	custom := template.Must(template.New("prompt").Parse("{{.Count}} until {{.NextExpiry.Format \"15:04\"}}"))
+	assert.Equal(t, "3 until 12:12", render(custom, "/work/app/env-lease.toml"))
+}
+
+func TestCompactDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		0:                               "0s",
+		45 * time.Second:                "45s",
+		12*time.Minute + 59*time.Second: "12m",
+		time.Hour + 5*time.Minute:       "1h5m",
+		3 * time.Hour:                   "3h",
+	} {
+		assert.Equal(t, want, compactDuration(d), d.String())
+	}
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/spf13/cobra"
+)
+
+var retryCmd = &cobra.Command{
+	Use:   "retry",
+	Short: "Retry failed revocations now.",
+	Long: `Retry failed revocations for the current project now.
+
+This includes revocations the daemon is still retrying and those it gave up on
+after the maximum number of attempts. Use 'env-lease status --failed' to list
+them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := newIPCClient()
+		if client == nil {
+			fmt.Println("Retry command running in test mode.")
+			return nil
+		}
+
+		configFileFlag, _ := cmd.Flags().GetString("config")
+		absConfigFile, err := config.ResolveConfigFile(configFileFlag)
+		if err != nil {
+			return err
+		}
+		all, _ := cmd.Flags().GetBool("all")
+
+		req := ipc.RetryRequest{Command: "retry", ConfigFile: absConfigFile, All: all}
+		var resp ipc.RetryResponse
+		if err := client.Send(commandContext(cmd), req, &resp); err != nil {
+			handleClientError(err)
+		}
+
+		for _, msg := range resp.Messages {
+			fmt.Println(msg)
+		}
+		if len(resp.Failed) > 0 {
+			printFailedRevocations(resp.Failed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	retryCmd.Flags().Bool("all", false, "Retry failed revocations for all projects.")
+	retryCmd.Flags().StringP("config", "c", "env-lease.toml", "Path to config file.")
+	rootCmd.AddCommand(retryCmd)
+}
@@ -17,7 +17,7 @@ var revokeCmd = &cobra.Command{
 	Long:  `Revoke all active leases for the current project.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		resetConfirmState()
-		client := ensureDaemonClient()
+		client := ensureDaemonClient(commandContext(cmd))
 
 		configFileFlag, _ := cmd.Flags().GetString("config")
 		absConfigFile, err := config.ResolveConfigFile(configFileFlag)
@@ -27,6 +27,10 @@ var revokeCmd = &cobra.Command{
 
 		all, _ := cmd.Flags().GetBool("all")
 		interactive, _ := cmd.Flags().GetBool("interactive")
+		dialect, err := shellDialectFor(cmd)
+		if err != nil {
+			return err
+		}
 
 		if client == nil {
 			fmt.Println("Revoke command running in test mode.")
@@ -38,7 +42,7 @@ var revokeCmd = &cobra.Command{
 				statusReq.ConfigFile = absConfigFile
 			}
 			var leasesResp ipc.StatusResponse
-			if err := client.Send(statusReq, &leasesResp); err != nil {
+			if err := client.Send(commandContext(cmd), statusReq, &leasesResp); err != nil {
 				handleClientError(err)
 			}
 
@@ -115,7 +119,7 @@ var revokeCmd = &cobra.Command{
 				Leases:     leasesToRevoke,
 			}
 			var revokeResp ipc.RevokeResponse
-			if err := client.Send(req, &revokeResp); err != nil {
+			if err := client.Send(commandContext(cmd), req, &revokeResp); err != nil {
 				handleClientError(err)
 			}
 			for _, msg := range revokeResp.Messages {
@@ -131,11 +135,12 @@ var revokeCmd = &cobra.Command{
 			All:        all,
 		}
 		var revokeResp ipc.RevokeResponse
-		if err := client.Send(req, &revokeResp); err != nil {
+		if err := client.Send(commandContext(cmd), req, &revokeResp); err != nil {
 			handleClientError(err)
 		}
 
-		isShellMode := len(revokeResp.ShellCommands) > 0
+		shellCommands := revokeShellCommands(dialect, revokeResp)
+		isShellMode := len(shellCommands) > 0
 
 		for _, msg := range revokeResp.Messages {
 			if isShellMode {
@@ -146,16 +151,14 @@ var revokeCmd = &cobra.Command{
 		}
 
 		if isShellMode {
-			fmt.Println("# When using shell lease types run this command like `eval $(env-lease revoke)`")
-			for _, shellCmd := range revokeResp.ShellCommands {
-				fmt.Println(shellCmd)
-			}
+			fmt.Fprintf(os.Stderr, "# When using shell lease types run this command like %s\n", dialect.usage("env-lease revoke", true))
+			fmt.Println(dialect.script(shellCommands, true))
 		}
 
 		// If all leases were revoked, check for .envrc and handle direnv
 		var leasesResp ipc.StatusResponse
 		statusReq := ipc.StatusRequest{Command: "status"}
-		if err := client.Send(statusReq, &leasesResp); err != nil {
+		if err := client.Send(commandContext(cmd), statusReq, &leasesResp); err != nil {
 			// If we can't get the status, we can't check for .envrc, so we'll just print the message and return.
 			handleClientError(err)
 		} else {
@@ -183,11 +186,25 @@ var revokeCmd = &cobra.Command{
 	},
 }
 
+// revokeShellCommands returns the commands that unset the revoked shell
+// leases. Daemons that predate ShellVariables only send POSIX commands.
+func revokeShellCommands(dialect shellDialect, resp ipc.RevokeResponse) []string {
+	if len(resp.ShellVariables) == 0 {
+		return resp.ShellCommands
+	}
+	commands := make([]string, 0, len(resp.ShellVariables))
+	for _, v := range resp.ShellVariables {
+		commands = append(commands, dialect.unset(v))
+	}
+	return commands
+}
+
 func init() {
 	revokeCmd.Flags().Bool("no-direnv", false, "Do not automatically run 'direnv allow'.")
 	revokeCmd.Flags().Bool("all", false, "Revoke all active leases, across all projects.")
 	revokeCmd.Flags().BoolP("interactive", "i", false, "Prompt for confirmation before revoking each lease.")
 	revokeCmd.Flags().StringP("config", "c", "env-lease.toml", "Path to config file.")
 	revokeCmd.Flags().String("local-config", "", "Path to local override config file.")
+	revokeCmd.Flags().String("shell", "", "Shell to print shell lease commands for: posix, fish, nu or powershell. Defaults to the shell in $SHELL.")
 	rootCmd.AddCommand(revokeCmd)
 }
@@ -4,11 +4,14 @@ import (
 	"context"
 	"log/slog"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/charmbracelet/fang"
 	"github.com/lmittmann/tint"
+	"github.com/mblarsen/env-lease/internal/xdgpath"
 	"github.com/spf13/cobra"
 )
 
@@ -19,7 +22,12 @@ var rootCmd = &cobra.Command{
 development files. It fetches secrets, injects them into files, and revokes
 them after a specified lease duration.`,
 	SilenceUsage: true,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, _ := cmd.Flags().GetString("instance")
+		if err := xdgpath.SetInstance(instance); err != nil {
+			return err
+		}
+
 		logLevel := slog.LevelWarn
 		if os.Getenv("ENV_LEASE_TEST") == "1" {
 			logLevel = slog.LevelDebug
@@ -40,11 +48,36 @@ them after a specified lease duration.`,
 				TimeFormat: time.Kitchen,
 			}),
 		))
+		return nil
 	},
 }
 
+func init() {
+	rootCmd.PersistentFlags().String("instance", "", "Daemon instance to use, each with its own socket, state and token (default: $ENV_LEASE_INSTANCE or 'default').")
+}
+
 func Execute() {
-	if err := fang.Execute(context.Background(), rootCmd); err != nil {
+	ctx, cancel := interruptContext()
+	defer cancel()
+	if err := fang.Execute(ctx, rootCmd); err != nil {
 		os.Exit(1)
 	}
 }
+
+// interruptContext returns a context that is cancelled by the first SIGINT or
+// SIGTERM, so in-flight secret fetches and daemon requests stop cleanly.
+// Later signals get the default behavior, so a second Ctrl-C always quits.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigs)
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"encoding/json"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print a JSON Schema for env-lease.toml.",
+	Long: `Print a JSON Schema for env-lease.toml, so Taplo and other TOML language
+servers can complete and check the config as it is typed.
+
+Save it next to the config and point the config at it:
+
+  env-lease schema > env-lease.schema.json
+
+and add this as the first line of env-lease.toml:
+
+  #:schema ./env-lease.schema.json
+
+The schema is built from the same rules as 'env-lease validate', which also
+checks what a schema cannot, like duplicate leases and destinations outside
+the project root.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(config.Schema())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// shellDialect writes the commands that set and unset shell lease variables
+// in one family of shells.
+type shellDialect struct {
+	// set assigns and exports value, quoted for the shell.
+	set func(name, value string) string
+	// unset removes the variable. It must not fail if the variable isn't set.
+	unset func(name string) string
+	// join turns the commands of set, or those of unset, into the text the
+	// shell reads. Nil prints one command per line.
+	join func(commands []string, unset bool) string
+	// usage shows how to run command so the shell applies its output, in
+	// backticks. unset tells whether the output comes from unset.
+	usage func(command string, unset bool) string
+}
+
+// script returns the text the shell reads to run commands.
+func (d shellDialect) script(commands []string, unset bool) string {
+	if d.join != nil {
+		return d.join(commands, unset)
+	}
+	return strings.Join(commands, "\n")
+}
+
+var (
+	posixDialect = shellDialect{
+		set: func(name, value string) string {
+			return fmt.Sprintf("export %s=%s", name, quotePosix(value))
+		},
+		unset: func(name string) string {
+			return "unset " + name
+		},
+		usage: func(command string, _ bool) string {
+			return fmt.Sprintf("`eval \"$(%s)\"`", command)
+		},
+	}
+	fishDialect = shellDialect{
+		set: func(name, value string) string {
+			return fmt.Sprintf("set -gx %s %s", name, quoteFish(value))
+		},
+		unset: func(name string) string {
+			return "set -e " + name
+		},
+		usage: func(command string, _ bool) string {
+			return fmt.Sprintf("`%s | source`", command)
+		},
+	}
+	// Nushell cannot evaluate text at runtime, so it is given JSON instead: a
+	// record of the variables to load, or a list of those to hide.
+	nushellDialect = shellDialect{
+		set: func(name, value string) string {
+			return quoteJSON(name) + ": " + quoteJSON(value)
+		},
+		unset: quoteJSON,
+		join: func(commands []string, unset bool) string {
+			if unset {
+				return "[" + strings.Join(commands, ", ") + "]"
+			}
+			return "{" + strings.Join(commands, ", ") + "}"
+		},
+		usage: func(command string, unset bool) string {
+			if unset {
+				return fmt.Sprintf("`hide-env -i ...(%s | from json)`", command)
+			}
+			return fmt.Sprintf("`%s | from json | load-env`", command)
+		},
+	}
+	powershellDialect = shellDialect{
+		set: func(name, value string) string {
+			return fmt.Sprintf("$env:%s = %s", name, quotePowerShell(value))
+		},
+		unset: func(name string) string {
+			return fmt.Sprintf("Remove-Item Env:%s -ErrorAction SilentlyContinue", name)
+		},
+		usage: func(command string, _ bool) string {
+			return fmt.Sprintf("`%s | Out-String | Invoke-Expression`", command)
+		},
+	}
+)
+
+// shellDialects maps the names accepted by --shell, and the shells $SHELL may
+// point to, to their dialect.
+var shellDialects = map[string]shellDialect{
+	"posix":      posixDialect,
+	"sh":         posixDialect,
+	"bash":       posixDialect,
+	"zsh":        posixDialect,
+	"dash":       posixDialect,
+	"ksh":        posixDialect,
+	"fish":       fishDialect,
+	"nu":         nushellDialect,
+	"nushell":    nushellDialect,
+	"powershell": powershellDialect,
+	"pwsh":       powershellDialect,
+}
+
+// shellDialectFor returns the dialect chosen with --shell, or the one of the
+// user's shell if the flag is empty or missing.
+func shellDialectFor(cmd *cobra.Command) (shellDialect, error) {
+	name, _ := cmd.Flags().GetString("shell")
+	if name == "" {
+		return detectShellDialect(), nil
+	}
+	dialect, ok := shellDialects[strings.ToLower(name)]
+	if !ok {
+		return shellDialect{}, fmt.Errorf("invalid --shell '%s': must be posix, bash, zsh, fish, nu or powershell", name)
+	}
+	return dialect, nil
+}
+
+// detectShellDialect picks the dialect of $SHELL. Shells it doesn't know get
+// POSIX, as does Windows without $SHELL, unless it runs PowerShell.
+func detectShellDialect() shellDialect {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		if runtime.GOOS == "windows" {
+			return powershellDialect
+		}
+		return posixDialect
+	}
+	name := strings.TrimSuffix(strings.ToLower(filepath.Base(shell)), ".exe")
+	if dialect, ok := shellDialects[name]; ok {
+		return dialect
+	}
+	return posixDialect
+}
+
+// quotePosix single-quotes s. Nothing is special inside single quotes, so a
+// quote is written as: end quote, escaped quote, start quote.
+func quotePosix(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// quoteFish single-quotes s. fish treats backslash and quote as escapes
+// inside single quotes.
+func quoteFish(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return "'" + r.Replace(s) + "'"
+}
+
+// quoteJSON encodes s as a JSON string.
+func quoteJSON(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// quotePowerShell single-quotes s. PowerShell also accepts the typographic
+// single quotes as delimiters, so they are doubled like the ASCII one.
+func quotePowerShell(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\'', '‘', '’', '‚', '‛':
+			sb.WriteRune(r)
+		}
+		sb.WriteRune(r)
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
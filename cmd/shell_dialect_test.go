@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os/exec"
+	"testing"
+
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShellDialects(t *testing.T) {
+	value := "it's a \"$HOME\" \\ `x`\n’"
+	tests := []struct {
+		shell string
+		set   string
+		unset string
+	}{
+		{"bash", `export API_KEY='it'\''s a "$HOME" \ ` + "`x`\n’'", "unset API_KEY"},
+		{"fish", `set -gx API_KEY 'it\'s a "$HOME" \\ ` + "`x`\n’'", "set -e API_KEY"},
+		{"nu", `"API_KEY": "it's a \"$HOME\" \\ ` + "`x`" + `\n’"`, `"API_KEY"`},
+		{"pwsh", `$env:API_KEY = 'it''s a "$HOME" \ ` + "`x`\n’’'", "Remove-Item Env:API_KEY -ErrorAction SilentlyContinue"},
+	}
+	for _, tt := range tests {
+		dialect := shellDialects[tt.shell]
+		assert.Equal(t, tt.set, dialect.set("API_KEY", value), tt.shell)
+		assert.Equal(t, tt.unset, dialect.unset("API_KEY"), tt.shell)
+	}
+}
+
+func TestShellDialectScript(t *testing.T) {
+	sets := []string{nushellDialect.set("API_KEY", "a\x1bb"), nushellDialect.set("TOKEN", "t")}
+	var record map[string]string
+	require.NoError(t, json.Unmarshal([]byte(nushellDialect.script(sets, false)), &record))
+	assert.Equal(t, map[string]string{"API_KEY": "a\x1bb", "TOKEN": "t"}, record)
+
+	unsets := []string{nushellDialect.unset("API_KEY"), nushellDialect.unset("TOKEN")}
+	var names []string
+	require.NoError(t, json.Unmarshal([]byte(nushellDialect.script(unsets, true)), &names))
+	assert.Equal(t, []string{"API_KEY", "TOKEN"}, names)
+
+	assert.Equal(t, "unset API_KEY\nunset TOKEN", posixDialect.script([]string{"unset API_KEY", "unset TOKEN"}, true))
+}
+
+func TestQuotePosixRoundTrip(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not installed")
+	}
+	for _, value := range []string{"", "plain", "it's", "a  b\n\tc", `$(echo no) "\"`, "'''"} {
+		script := posixDialect.set("API_KEY", value) + "\nprintf %s \"$API_KEY\""
+		out, err := exec.Command(bash, "--norc", "--noprofile", "-c", script).Output()
+		require.NoError(t, err, value)
+		assert.Equal(t, value, string(out))
+	}
+}
+
+func TestShellDialectFor(t *testing.T) {
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("shell", "", "")
+		return cmd
+	}
+
+	t.Setenv("SHELL", "/usr/local/bin/fish")
+	dialect, err := shellDialectFor(newCmd())
+	require.NoError(t, err)
+	assert.Equal(t, "set -e X", dialect.unset("X"))
+
+	t.Setenv("SHELL", "/bin/tcsh")
+	dialect, err = shellDialectFor(newCmd())
+	require.NoError(t, err)
+	assert.Equal(t, "unset X", dialect.unset("X"))
+
+	cmd := newCmd()
+	require.NoError(t, cmd.Flags().Set("shell", "PowerShell"))
+	dialect, err = shellDialectFor(cmd)
+	require.NoError(t, err)
+	assert.Equal(t, "$env:X = 'y'", dialect.set("X", "y"))
+
+	cmd = newCmd()
+	require.NoError(t, cmd.Flags().Set("shell", "csh"))
+	_, err = shellDialectFor(cmd)
+	assert.Error(t, err)
+}
+
+func TestRevokeShellCommands(t *testing.T) {
+	resp := ipc.RevokeResponse{ShellCommands: []string{"unset API_KEY"}, ShellVariables: []string{"API_KEY"}}
+	assert.Equal(t, []string{"set -e API_KEY"}, revokeShellCommands(fishDialect, resp))
+
+	// Older daemons only send POSIX commands.
+	resp.ShellVariables = nil
+	assert.Equal(t, []string{"unset API_KEY"}, revokeShellCommands(fishDialect, resp))
+}
@@ -15,8 +15,20 @@ import (
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show the status of active leases.",
-	Long:  `Show the status of active leases.`,
+	Long: `Show the status of active leases.
+
+Use --output json or --output yaml for scripts, or --output template=<go-template>
+to render your own format, e.g. for a shell prompt or tmux status line.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+		render, err := newStatusRenderer(output)
+		if err != nil {
+			return err
+		}
+		if failed, _ := cmd.Flags().GetBool("failed"); failed && render != nil {
+			return fmt.Errorf("--output cannot be combined with --failed")
+		}
+
 		client := newIPCClient()
 		if client == nil {
 			fmt.Println("Status command running in test mode.")
@@ -25,21 +37,38 @@ var statusCmd = &cobra.Command{
 
 		req := ipc.StatusRequest{Command: "status"}
 		var resp ipc.StatusResponse
-		if err := client.Send(req, &resp); err != nil {
+		if err := client.Send(commandContext(cmd), req, &resp); err != nil {
 			handleClientError(err)
 		}
 
-		if len(resp.Leases) == 0 {
-			fmt.Println("No active leases.")
-			return nil
-		}
-
 		configFileFlag, _ := cmd.Flags().GetString("config")
 		absConfigFile, err := config.ResolveConfigFile(configFileFlag)
 		if err != nil {
 			return err
 		}
 
+		if failed, _ := cmd.Flags().GetBool("failed"); failed {
+			showAll, _ := cmd.Flags().GetBool("all")
+			var failures []ipc.FailedRevocation
+			for _, f := range resp.Failed {
+				if showAll || f.Lease.ConfigFile == absConfigFile {
+					failures = append(failures, f)
+				}
+			}
+			if len(failures) == 0 {
+				fmt.Println("No failed revocations.")
+				return nil
+			}
+			printFailedRevocations(failures)
+			return nil
+		}
+
+		if len(resp.Leases) == 0 && render == nil {
+			fmt.Println("No active leases.")
+			printIdleSummary(resp.Idle)
+			return nil
+		}
+
 		// The status command doesn't need to load the config, it just needs the path
 		// to filter leases. So we don't call config.Load here. But if we did, it
 		// would look like this:
@@ -74,13 +103,18 @@ var statusCmd = &cobra.Command{
 			}
 		}
 
+		// Sort top-level leases by destination
+		sort.Slice(leasesToDisplay, func(i, j int) bool {
+			return leasesToDisplay[i].Destination < leasesToDisplay[j].Destination
+		})
+
+		if render != nil {
+			return render(os.Stdout, buildStatusDocument(leasesToDisplay, groupedLeases, time.Now()))
+		}
+
 		if len(leasesToDisplay) == 0 {
 			fmt.Println("No active leases for this project.")
 		} else {
-			// Sort top-level leases by destination
-			sort.Slice(leasesToDisplay, func(i, j int) bool {
-				return leasesToDisplay[i].Destination < leasesToDisplay[j].Destination
-			})
 			printLeases(leasesToDisplay, groupedLeases)
 		}
 
@@ -113,10 +147,29 @@ var statusCmd = &cobra.Command{
 			}
 		}
 
+		printIdleSummary(resp.Idle)
 		return nil
 	},
 }
 
+// printIdleSummary prints one line about idle revocation, if it is on.
+func printIdleSummary(idle *ipc.IdleStatus) {
+	// Without a default timeout the daemon only checks while a lease has
+	// one of its own.
+	if idle == nil || (idle.Timeout == 0 && idle.CheckedAt.IsZero()) {
+		return
+	}
+	timeout := idleTimeoutLabel(idle.Timeout)
+	switch {
+	case idle.Error != "":
+		fmt.Printf("Idle: unknown (%s); default timeout %s.\n", idle.Error, timeout)
+	case idle.CheckedAt.IsZero():
+		fmt.Printf("Idle: not checked yet; default timeout %s.\n", timeout)
+	default:
+		fmt.Printf("Idle: %s, default timeout %s (%s).\n", idle.Idle.Truncate(time.Second), timeout, idle.Source)
+	}
+}
+
 func printLeases(leases []ipc.Lease, children map[string][]ipc.Lease) {
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
 	fmt.Fprintln(w, "VARIABLE\tSOURCE\tDESTINATION\tEXPIRES IN")
@@ -153,9 +206,33 @@ func printLeases(leases []ipc.Lease, children map[string][]ipc.Lease) {
 	w.Flush()
 }
 
+func printFailedRevocations(failures []ipc.FailedRevocation) {
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].InitialFailure.Before(failures[j].InitialFailure)
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "VARIABLE\tSOURCE\tDESTINATION\tATTEMPTS\tSTATE\tLAST ERROR")
+	for _, f := range failures {
+		variable := f.Lease.Variable
+		if variable == "" {
+			variable = "<file>"
+		}
+		state := fmt.Sprintf("retry in %s", time.Until(f.NextRetryTime).Round(time.Second))
+		if f.DeadLetter {
+			state = "gave up"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", variable, f.Lease.Source, f.Lease.Destination, f.Attempts, state, f.LastError)
+	}
+	w.Flush()
+	fmt.Println("Run 'env-lease retry' to retry these revocations now.")
+}
+
 func init() {
+	statusCmd.Flags().Bool("failed", false, "Show revocations that failed and are being retried or were given up on.")
 	statusCmd.Flags().Bool("all", false, "Show all active leases.")
 	statusCmd.Flags().StringP("config", "c", "env-lease.toml", "Path to config file.")
 	statusCmd.Flags().String("local-config", "", "Path to local override config file.")
+	statusCmd.Flags().StringP("output", "o", "table", "Output format: table, json, yaml or template=<go-template>.")
 	rootCmd.AddCommand(statusCmd)
 }
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"gopkg.in/yaml.v3"
+)
+
+// statusDocument is what 'status --output' renders. Templates see the Go
+// field names, e.g. {{range .Leases}}{{.Variable}}{{end}}.
+type statusDocument struct {
+	Leases []statusLease `json:"leases" yaml:"leases"`
+}
+
+// statusLease is one lease in a statusDocument. Leases exploded from a parent
+// are listed under its Children and name it in Parent.
+type statusLease struct {
+	Variable         string        `json:"variable,omitempty" yaml:"variable,omitempty"`
+	Source           string        `json:"source" yaml:"source"`
+	Destination      string        `json:"destination" yaml:"destination"`
+	Type             string        `json:"type" yaml:"type"`
+	ConfigFile       string        `json:"config_file" yaml:"config_file"`
+	ExpiresAt        time.Time     `json:"expires_at" yaml:"expires_at"`
+	Remaining        string        `json:"remaining" yaml:"remaining"`
+	RemainingSeconds int64         `json:"remaining_seconds" yaml:"remaining_seconds"`
+	Parent           string        `json:"parent,omitempty" yaml:"parent,omitempty"`
+	Children         []statusLease `json:"children,omitempty" yaml:"children,omitempty"`
+}
+
+// statusRenderer writes a statusDocument in the format chosen with --output.
+type statusRenderer func(w io.Writer, doc statusDocument) error
+
+// newStatusRenderer parses the value of --output. It returns nil for the
+// default table.
+func newStatusRenderer(output string) (statusRenderer, error) {
+	if text, ok := strings.CutPrefix(output, "template="); ok {
+		tmpl, err := template.New("status").Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --output template: %w", err)
+		}
+		return func(w io.Writer, doc statusDocument) error {
+			return tmpl.Execute(w, doc)
+		}, nil
+	}
+
+	switch output {
+	case "", "table":
+		return nil, nil
+	case "json":
+		return func(w io.Writer, doc statusDocument) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(doc)
+		}, nil
+	case "yaml":
+		return func(w io.Writer, doc statusDocument) error {
+			enc := yaml.NewEncoder(w)
+			enc.SetIndent(2)
+			if err := enc.Encode(doc); err != nil {
+				return err
+			}
+			return enc.Close()
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid --output '%s': must be table, json, yaml or template=<go-template>", output)
+	}
+}
+
+// buildStatusDocument arranges the top-level leases and their exploded
+// children in the same order as the status table.
+func buildStatusDocument(leases []ipc.Lease, children map[string][]ipc.Lease, now time.Time) statusDocument {
+	doc := statusDocument{Leases: make([]statusLease, 0, len(leases))}
+	for _, lease := range leases {
+		entry := newStatusLease(lease, now)
+		uniqueParentID := lease.Source + "->" + lease.Destination
+		childLeases := append([]ipc.Lease(nil), children[uniqueParentID]...)
+		sort.Slice(childLeases, func(i, j int) bool {
+			return childLeases[i].Variable < childLeases[j].Variable
+		})
+		for _, child := range childLeases {
+			entry.Children = append(entry.Children, newStatusLease(child, now))
+		}
+		doc.Leases = append(doc.Leases, entry)
+	}
+	return doc
+}
+
+func newStatusLease(lease ipc.Lease, now time.Time) statusLease {
+	remaining := lease.ExpiresAt.Sub(now).Round(time.Second)
+	return statusLease{
+		Variable:         lease.Variable,
+		Source:           lease.Source,
+		Destination:      lease.Destination,
+		Type:             lease.LeaseType,
+		ConfigFile:       lease.ConfigFile,
+		ExpiresAt:        lease.ExpiresAt,
+		Remaining:        remaining.String(),
+		RemainingSeconds: int64(remaining / time.Second),
+		Parent:           lease.ParentSource,
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestStatusOutput(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	leases := []ipc.Lease{
+		{Source: "op://vault/app/env", Destination: "/work/app/.envrc", LeaseType: "env", ConfigFile: "/work/app/env-lease.toml", ExpiresAt: now.Add(time.Hour)},
+		{Source: "op://vault/app/cert", Destination: "/work/app/cert.pem", LeaseType: "file", ConfigFile: "/work/app/env-lease.toml", ExpiresAt: now.Add(90 * time.Second)},
+	}
+	parent := "op://vault/app/env->/work/app/.envrc"
+	children := map[string][]ipc.Lease{
+		parent: {
+			{Source: "op://vault/app/env", Destination: "/work/app/.envrc", Variable: "TOKEN", LeaseType: "env", ParentSource: parent, ExpiresAt: now.Add(time.Hour)},
+			{Source: "op://vault/app/env", Destination: "/work/app/.envrc", Variable: "API_KEY", LeaseType: "env", ParentSource: parent, ExpiresAt: now.Add(time.Hour)},
+		},
+	}
+	doc := buildStatusDocument(leases, children, now)
+
+	t.Run("json", func(t *testing.T) {
+		render, err := newStatusRenderer("json")
+		require.NoError(t, err)
+		var out bytes.Buffer
+		require.NoError(t, render(&out, doc))
+
+		var decoded map[string][]map[string]any
+		require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+		require.Len(t, decoded["leases"], 2)
+		first := decoded["leases"][0]
+		assert.Equal(t, "env", first["type"])
+		assert.Equal(t, "1h0m0s", first["remaining"])
+		assert.Equal(t, float64(3600), first["remaining_seconds"])
+		assert.Equal(t, "2026-10-18T13:00:00Z", first["expires_at"])
+		children := first["children"].([]any)
+		require.Len(t, children, 2)
+		assert.Equal(t, "API_KEY", children[0].(map[string]any)["variable"])
+		assert.Equal(t, parent, children[0].(map[string]any)["parent"])
+		assert.NotContains(t, decoded["leases"][1], "variable")
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		render, err := newStatusRenderer("yaml")
+		require.NoError(t, err)
+		var out bytes.Buffer
+		require.NoError(t, render(&out, doc))
+
+		var decoded statusDocument
+		require.NoError(t, yaml.Unmarshal(out.Bytes(), &decoded))
+		assert.Equal(t, doc, decoded)
+		assert.Contains(t, out.String(), "config_file: /work/app/env-lease.toml")
+	})
+
+	t.Run("template", func(t *testing.T) {
+		render, err := newStatusRenderer(`template={{len .Leases}} {{range .Leases}}{{.Type}}:{{.Remaining}} {{end}}`)
+		require.NoError(t, err)
+		var out bytes.Buffer
+		require.NoError(t, render(&out, doc))
+		assert.Equal(t, "2 env:1h0m0s file:1m30s ", out.String())
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		render, err := newStatusRenderer("json")
+		require.NoError(t, err)
+		var out bytes.Buffer
+		require.NoError(t, render(&out, buildStatusDocument(nil, nil, now)))
+		assert.JSONEq(t, `{"leases": []}`, out.String())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		render, err := newStatusRenderer("table")
+		assert.NoError(t, err)
+		assert.Nil(t, render)
+
+		_, err = newStatusRenderer("xml")
+		assert.ErrorContains(t, err, "invalid --output 'xml'")
+
+		_, err = newStatusRenderer("template={{.Leases")
+		assert.ErrorContains(t, err, "invalid --output template")
+	})
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file for problems.",
+	Long: `Check env-lease.toml and its local override for everything grant would reject:
+missing keys, invalid durations and idle timeouts, unknown lease types, formats
+and transforms, misplaced explode transforms, env files without a format, file
+destinations outside the project root and leases that write the same variable
+or file twice. Unknown keys are reported as warnings. Use
+--destination-outside-root to allow file destinations outside the project
+root, as with grant.
+
+Every problem is reported at once, with its line and column. No secrets are
+read and the daemon is not contacted.
+
+Use --json for editor integration. Exits with an error if there are errors.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configFileFlag, _ := cmd.Flags().GetString("config")
+		localConfigFileFlag, _ := cmd.Flags().GetString("local-config")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		destinationOutsideRoot, _ := cmd.Flags().GetBool("destination-outside-root")
+
+		configFile, err := config.ResolveConfigFile(configFileFlag)
+		if err != nil {
+			return err
+		}
+		issues, err := config.Validate(configFile, localConfigFileFlag, destinationOutsideRoot)
+		if err != nil {
+			return fmt.Errorf("failed to read config: %w", err)
+		}
+
+		if asJSON {
+			if issues == nil {
+				issues = []config.Issue{}
+			}
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(issues); err != nil {
+				return err
+			}
+		} else {
+			printIssues(cmd.OutOrStdout(), configFile, issues)
+		}
+
+		if errs := countIssues(issues, config.SeverityError); errs > 0 {
+			return fmt.Errorf("config has %d %s", errs, pluralize(errs, "error", "errors"))
+		}
+		return nil
+	},
+}
+
+// printIssues prints issues the way compilers do, so terminals and editors
+// can jump to them. Paths are relative to the working directory.
+func printIssues(w io.Writer, configFile string, issues []config.Issue) {
+	if len(issues) == 0 {
+		fmt.Fprintf(w, "%s is valid.\n", displayPath(configFile))
+		return
+	}
+	for _, issue := range issues {
+		issue.File = displayPath(issue.File)
+		fmt.Fprintln(w, issue)
+	}
+	errs := countIssues(issues, config.SeverityError)
+	warnings := countIssues(issues, config.SeverityWarning)
+	fmt.Fprintf(w, "\n%d %s, %d %s.\n", errs, pluralize(errs, "error", "errors"), warnings, pluralize(warnings, "warning", "warnings"))
+}
+
+func countIssues(issues []config.Issue, severity config.Severity) int {
+	n := 0
+	for _, issue := range issues {
+		if issue.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+// displayPath returns path relative to the working directory if it is below
+// it.
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+func init() {
+	validateCmd.Flags().StringP("config", "c", "env-lease.toml", "Path to config file.")
+	validateCmd.Flags().String("local-config", "", "Path to local override config file.")
+	validateCmd.Flags().Bool("destination-outside-root", false, "Allow file-based leases to write outside of the project root, as grant does with the same flag.")
+	validateCmd.Flags().Bool("json", false, "Print the issues as a JSON array of objects with file, line, column, severity, key and message.")
+	rootCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintIssues(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	configFile := filepath.Join(dir, "env-lease.toml")
+
+	var out bytes.Buffer
+	printIssues(&out, configFile, nil)
+	assert.Equal(t, "env-lease.toml is valid.\n", out.String())
+
+	out.Reset()
+	printIssues(&out, configFile, []config.Issue{
+		{File: configFile, Position: config.Position{Line: 5, Column: 1}, Severity: config.SeverityError, Message: "invalid duration '1x'"},
+		{File: "/elsewhere/env-lease.local.toml", Position: config.Position{Line: 2, Column: 3}, Severity: config.SeverityWarning, Message: "unknown key 'lease_typ'"},
+	})
+	assert.Equal(t, "env-lease.toml:5:1: error: invalid duration '1x'\n"+
+		"/elsewhere/env-lease.local.toml:2:3: warning: unknown key 'lease_typ'\n"+
+		"\n1 error, 1 warning.\n", out.String())
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/spf13/cobra"
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show the CLI and daemon versions.",
+	Long: `Show the version and IPC protocol of the CLI and of the running daemon,
+along with the capabilities the daemon supports.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fmt.Printf("CLI:    %s (protocol %d)\n", ipc.BuildVersion(), ipc.ProtocolVersion)
+
+		client := newIPCClient()
+		if client == nil {
+			fmt.Println("Version command running in test mode.")
+			return nil
+		}
+
+		hello, err := client.Hello(commandContext(cmd))
+		if err != nil {
+			var connErr *ipc.ConnectionError
+			if errors.As(err, &connErr) {
+				fmt.Println("Daemon: not running")
+				return nil
+			}
+			handleClientError(err)
+		}
+		fmt.Printf("Daemon: %s (protocol %d, accepts %d-%d)\n",
+			hello.DaemonVersion, hello.ProtocolVersion, hello.MinProtocolVersion, hello.ProtocolVersion)
+		fmt.Printf("Capabilities: %s\n", strings.Join(hello.Capabilities, ", "))
+		for old, replacement := range hello.Deprecated {
+			fmt.Printf("Deprecated: '%s' is replaced by '%s'\n", old, replacement)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+}
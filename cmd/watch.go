@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Stream lease events from the daemon.",
+	Long: `Stream lease events from the daemon as JSON, one event per line.
+
+Event types are granted, renewed, warning, expired, revoked, revoke-failed,
+orphaned and config-changed. By default only events for the current project
+are shown. Use --all to show events for every project.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := newIPCClient()
+		if client == nil {
+			fmt.Println("Watch command running in test mode.")
+			return nil
+		}
+
+		req := ipc.SubscribeRequest{Command: "subscribe"}
+		if all, _ := cmd.Flags().GetBool("all"); !all {
+			configFileFlag, _ := cmd.Flags().GetString("config")
+			absConfigFile, err := config.ResolveConfigFile(configFileFlag)
+			if err != nil {
+				return err
+			}
+			req.ConfigFile = absConfigFile
+		}
+
+		ctx := commandContext(cmd)
+		enc := json.NewEncoder(os.Stdout)
+		err := client.Subscribe(ctx, req, func(payload json.RawMessage) error {
+			var event ipc.Event
+			if err := json.Unmarshal(payload, &event); err != nil {
+				return fmt.Errorf("failed to decode event: %w", err)
+			}
+			return enc.Encode(event)
+		})
+		if err != nil && ctx.Err() == nil {
+			handleClientError(err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	watchCmd.Flags().Bool("all", false, "Stream events for all projects.")
+	watchCmd.Flags().StringP("config", "c", "env-lease.toml", "Path to config file.")
+	rootCmd.AddCommand(watchCmd)
+}
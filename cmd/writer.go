@@ -10,6 +10,7 @@ import (
 	"unsafe"
 
 	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/envfile"
 	"github.com/mblarsen/env-lease/internal/fileutil"
 )
 
@@ -59,26 +60,62 @@ func writeEnvFile(path, key, value, format string, override bool, fileModeStr st
 		return false, err
 	}
 
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		content := fmt.Sprintf(format+"\n", key, value)
-		_, err := fileutil.AtomicWriteFile(path, []byte(content), fileMode)
-		return true, err
-	}
-
 	content, err := os.ReadFile(path)
-	if err != nil {
+	exists := !os.IsNotExist(err)
+	if err != nil && exists {
 		return false, fmt.Errorf("failed to read existing file: %w", err)
 	}
 
+	output, change, err := updateEnvContent(content, exists, key, value, format, override)
+	if err != nil || change == envUnchanged {
+		return false, err
+	}
+	_, err = fileutil.AtomicWriteFile(path, output, fileMode)
+	return change == envCreated, err
+}
+
+// envChange is what setting a variable does to an env file.
+type envChange int
+
+const (
+	envUnchanged envChange = iota
+	// envCreated creates the file.
+	envCreated
+	// envAdded appends the variable.
+	envAdded
+	// envReplaced replaces the variable's line.
+	envReplaced
+)
+
+// valueExistsError refuses to replace a variable's value without --override.
+type valueExistsError struct {
+	key string
+}
+
+func (e *valueExistsError) Error() string {
+	return fmt.Sprintf("variable '%s' already has a value; use --override to replace it", e.key)
+}
+
+// updateEnvContent returns content, the env file's current content, with key
+// set to value. It does no I/O, so 'env-lease plan' can use it to predict what
+// grant will write.
+func updateEnvContent(content []byte, exists bool, key, value, format string, override bool) ([]byte, envChange, error) {
+	if dialect, ok := envfile.Lookup(format); ok {
+		return updateDialectContent(content, exists, key, value, dialect, override)
+	}
+
+	if !exists {
+		return []byte(fmt.Sprintf(format+"\n", key, value)), envCreated, nil
+	}
+
 	lines := strings.Split(string(content), "\n")
-	keyExists := false
+	change := envAdded
 	prefix := strings.Split(format, "%")[0] + key + "="
 	for i, line := range lines {
 		if strings.HasPrefix(line, prefix) {
-			keyExists = true
 			newLine := fmt.Sprintf(format, key, value)
 			if line == newLine {
-				return false, nil
+				return content, envUnchanged, nil
 			}
 
 			// Check if the line has a value.
@@ -86,15 +123,16 @@ func writeEnvFile(path, key, value, format string, override bool, fileModeStr st
 			hasValue := len(parts) > 1 && strings.Trim(parts[1], `""`) != ""
 
 			if hasValue && !override {
-				return false, fmt.Errorf("variable '%s' already has a value; use --override to replace it", key)
+				return nil, envUnchanged, &valueExistsError{key: key}
 			}
 
 			lines[i] = newLine
+			change = envReplaced
 			break
 		}
 	}
 
-	if !keyExists {
+	if change == envAdded {
 		lines = append(lines, fmt.Sprintf(format, key, value))
 	}
 
@@ -105,9 +143,34 @@ func writeEnvFile(path, key, value, format string, override bool, fileModeStr st
 		}
 	}
 
-	output := strings.Join(nonEmptyLines, "\n") + "\n"
-	_, err = fileutil.AtomicWriteFile(path, []byte(output), fileMode)
-	return false, err
+	return []byte(strings.Join(nonEmptyLines, "\n") + "\n"), change, nil
+}
+
+// updateDialectContent is updateEnvContent for a named format dialect.
+func updateDialectContent(content []byte, exists bool, key, value string, dialect envfile.Dialect, override bool) ([]byte, envChange, error) {
+	current, found, err := envfile.Get(dialect, content, key)
+	if err != nil {
+		return nil, envUnchanged, fmt.Errorf("failed to parse file as %s: %w", dialect.Name(), err)
+	}
+	if found && current == value {
+		return content, envUnchanged, nil
+	}
+	if found && current != "" && !override {
+		return nil, envUnchanged, &valueExistsError{key: key}
+	}
+
+	output, err := dialect.Set(content, key, value)
+	if err != nil {
+		return nil, envUnchanged, fmt.Errorf("failed to write '%s' as %s: %w", key, dialect.Name(), err)
+	}
+	switch {
+	case !exists:
+		return output, envCreated, nil
+	case found:
+		return output, envReplaced, nil
+	default:
+		return output, envAdded, nil
+	}
 }
 
 func parseFileMode(fileModeStr string, defaultMode os.FileMode) (os.FileMode, error) {
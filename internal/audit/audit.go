@@ -0,0 +1,199 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxSize is the size in bytes at which the log is rotated.
+	DefaultMaxSize = 10 * 1024 * 1024
+	// DefaultMaxBackups is the number of rotated files kept next to the log.
+	DefaultMaxBackups = 5
+)
+
+// Entry is a single audit record. It never contains secret values.
+type Entry struct {
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	ConfigFile  string    `json:"config_file,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	Variable    string    `json:"variable,omitempty"`
+	LeaseType   string    `json:"lease_type,omitempty"`
+	// ActorPID is the PID of the process that asked for the change. It is zero
+	// when the daemon acted on its own, e.g. when a lease expired.
+	ActorPID int    `json:"actor_pid,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// Log appends entries as JSON lines to a file and rotates it by size.
+type Log struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens, or creates, the audit log at path.
+func Open(path string, maxSize int64, maxBackups int) (*Log, error) {
+	l := &Log{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	l.file = f
+	l.size = info.Size()
+	return nil
+}
+
+// Write appends an entry to the log.
+func (l *Log) Write(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return errors.New("audit log is closed")
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// rotate shifts audit.log.N to audit.log.N+1, dropping the oldest, and starts
+// a new empty log.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+	l.file = nil
+
+	if l.maxBackups > 0 {
+		_ = os.Remove(backupPath(l.path, l.maxBackups))
+		for i := l.maxBackups - 1; i >= 1; i-- {
+			if err := os.Rename(backupPath(l.path, i), backupPath(l.path, i+1)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to rotate audit log: %w", err)
+			}
+		}
+		if err := os.Rename(l.path, backupPath(l.path, 1)); err != nil {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	return l.open()
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// Filter selects entries when reading the log.
+type Filter struct {
+	// ConfigFile limits entries to a single project.
+	ConfigFile string
+	// Since drops entries older than this time.
+	Since time.Time
+}
+
+func (f Filter) match(e Entry) bool {
+	if f.ConfigFile != "" && e.ConfigFile != f.ConfigFile {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// Read returns the entries matching filter from the log at path and its
+// rotated backups, oldest first. Lines that cannot be parsed are skipped.
+func Read(path string, maxBackups int, filter Filter) ([]Entry, error) {
+	var entries []Entry
+	for i := maxBackups; i >= 0; i-- {
+		p := path
+		if i > 0 {
+			p = backupPath(path, i)
+		}
+		fileEntries, err := readFile(p, filter)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fileEntries...)
+	}
+	return entries, nil
+}
+
+func readFile(path string, filter Filter) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if filter.match(e) {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogWriteAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := Open(path, DefaultMaxSize, DefaultMaxBackups)
+	require.NoError(t, err)
+	defer log.Close()
+
+	now := time.Now()
+	require.NoError(t, log.Write(Entry{Time: now.Add(-2 * time.Hour), Action: "granted", ConfigFile: "/a/env-lease.toml", Variable: "OLD"}))
+	require.NoError(t, log.Write(Entry{Time: now, Action: "granted", ConfigFile: "/a/env-lease.toml", Variable: "NEW"}))
+	require.NoError(t, log.Write(Entry{Time: now, Action: "expired", ConfigFile: "/b/env-lease.toml", Variable: "OTHER"}))
+
+	all, err := Read(path, DefaultMaxBackups, Filter{})
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	filtered, err := Read(path, DefaultMaxBackups, Filter{ConfigFile: "/a/env-lease.toml", Since: now.Add(-time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, filtered, 1)
+	assert.Equal(t, "NEW", filtered[0].Variable)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestLogRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := Open(path, 200, 2)
+	require.NoError(t, err)
+	defer log.Close()
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, log.Write(Entry{Time: time.Now(), Action: "granted", Source: "op://vault/item/field"}))
+	}
+
+	_, err = os.Stat(backupPath(path, 1))
+	assert.NoError(t, err)
+	_, err = os.Stat(backupPath(path, 2))
+	assert.NoError(t, err)
+	_, err = os.Stat(backupPath(path, 3))
+	assert.True(t, os.IsNotExist(err), "only maxBackups files should be kept")
+
+	entries, err := Read(path, 2, Filter{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, entries)
+	assert.Less(t, len(entries), 20)
+}
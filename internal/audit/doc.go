@@ -0,0 +1,2 @@
+// Package audit implements the append-only log of lease lifecycle events.
+package audit
@@ -15,8 +15,9 @@ import (
 
 // Config represents the structure of the env-lease.toml file.
 type Config struct {
-	Lease []Lease `toml:"lease"`
-	Root  string  `toml:"-"`
+	IdleTimeout string  `toml:"idle_timeout"`
+	Lease       []Lease `toml:"lease"`
+	Root        string  `toml:"-"`
 }
 
 // Lease represents a single lease block in the config.
@@ -31,10 +32,14 @@ type Lease struct {
 	Transform     []string   `toml:"transform"`
 	FileMode      string     `toml:"file_mode"`
 	OpAccount     string     `toml:"op_account" json:"op_account,omitempty"`
+	RevokeOnLock  bool       `toml:"revoke_on_lock" json:"revoke_on_lock,omitempty"`
+	IdleTimeout   string     `toml:"idle_timeout" json:"idle_timeout,omitempty"`
 	ExpiresAt     time.Time  `toml:"-" json:"expires_at"`
+	GrantedAt     time.Time  `toml:"-" json:"granted_at,omitempty"`
 	OrphanedSince *time.Time `toml:"-" json:"orphaned_since,omitempty"`
 	ConfigFile    string     `toml:"-" json:"config_file"`
 	ParentSource  string     `toml:"-" json:"parent_source,omitempty"`
+	ShellSessions []string   `toml:"-" json:"shell_sessions,omitempty"`
 }
 
 // Load reads a TOML file from the given path, validates it, and returns a Config struct.
@@ -42,13 +47,20 @@ func Load(path, localPath string) (*Config, error) {
 	return loadAndMerge(path, localPath, 0)
 }
 
+// ParseIdleTimeout parses an idle_timeout value. "0" disables idle
+// revocation.
+func ParseIdleTimeout(value string) (time.Duration, error) {
+	return parseTimeout(value)
+}
+
 func loadAndMerge(path, localPath string, depth int) (*Config, error) {
 	if depth > 10 {
 		return nil, fmt.Errorf("max include depth exceeded")
 	}
 
 	var rawConfig struct {
-		Lease []Lease `toml:"lease"`
+		IdleTimeout string  `toml:"idle_timeout"`
+		Lease       []Lease `toml:"lease"`
 	}
 
 	absPath, err := filepath.Abs(path)
@@ -74,57 +86,24 @@ func loadAndMerge(path, localPath string, depth int) (*Config, error) {
 	}
 
 	config := Config{
-		Lease: rawConfig.Lease,
-		Root:  filepath.Dir(absPath),
+		IdleTimeout: rawConfig.IdleTimeout,
+		Lease:       rawConfig.Lease,
+		Root:        filepath.Dir(absPath),
 	}
 
-	for i := range config.Lease {
-		lease := &config.Lease[i]
-		expandedDest, err := fileutil.ExpandPath(lease.Destination)
-		if err != nil {
-			return nil, fmt.Errorf("lease %d: could not expand destination path: %w", i, err)
-		}
-		lease.Destination = expandedDest
-
-		// Backward compatibility for encoding
-		if len(lease.Transform) == 0 && lease.Format == "base64" {
-			lease.Transform = []string{"base64-encode"}
-		}
-
-		// Set default lease type
-		if lease.LeaseType == "" {
-			lease.LeaseType = "env"
-		}
-
-		// Set default provider
-		if lease.Provider == "" {
-			lease.Provider = "1password"
-		}
-
-		// Validate required fields
-		if lease.Source == "" {
-			return nil, fmt.Errorf("lease %d: source is required", i)
-		}
-
-		if lease.LeaseType == "env" && lease.Destination == "" {
-			return nil, fmt.Errorf("lease %d: destination is required for lease_type '%s'", i, lease.LeaseType)
-		}
-
-		if lease.LeaseType == "file" && lease.Destination == "" {
-			lease.Destination = filepath.Base(lease.Source)
-		}
+	if err := checkIdleTimeout(config.IdleTimeout); err != nil {
+		return nil, err
+	}
 
-		isExplode := false
-		for _, t := range lease.Transform {
-			if strings.HasPrefix(t, "explode") {
-				isExplode = true
-				break
+	// Leases get the same checks as Validate; the first error fails the load.
+	for i := range config.Lease {
+		target := leaseTarget{lease: config.Lease[i], file: absPath, index: i}
+		for _, issue := range checkLease(&target) {
+			if issue.Severity == SeverityError {
+				return nil, fmt.Errorf("lease %d: %s", i, issue.Message)
 			}
 		}
-
-		if (lease.LeaseType == "env" || lease.LeaseType == "shell") && lease.Variable == "" && !isExplode {
-			return nil, fmt.Errorf("lease %d: variable is required for lease_type '%s'", i, lease.LeaseType)
-		}
+		config.Lease[i] = target.lease
 	}
 
 	if depth == 0 {
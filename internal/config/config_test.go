@@ -113,6 +113,87 @@ lease_type = "env"
 			t.Fatal("expected an error, got nil")
 		}
 	})
+
+	t.Run("idle timeouts", func(t *testing.T) {
+		content := `
+idle_timeout = "10m"
+
+[[lease]]
+source = "op://vault/item/secret"
+destination = ".envrc"
+duration = "1h"
+variable = "API_KEY"
+idle_timeout = "0"
+`
+		path := createTempConfig(t, content)
+
+		config, err := Load(path, "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if config.IdleTimeout != "10m" {
+			t.Errorf("expected project idle_timeout '10m', got %q", config.IdleTimeout)
+		}
+		if config.Lease[0].IdleTimeout != "0" {
+			t.Errorf("expected lease idle_timeout '0', got %q", config.Lease[0].IdleTimeout)
+		}
+	})
+
+	t.Run("format dialects", func(t *testing.T) {
+		for format, valid := range map[string]bool{
+			"systemd-env":   true,
+			"export %s=%q":  true,
+			"shell-escaped": false,
+		} {
+			content := "[[lease]]\nsource = \"op://vault/item/secret\"\ndestination = \"app.env\"\nvariable = \"API_KEY\"\nduration = \"1h\"\nformat = \"" + format + "\"\n"
+			path := createTempConfig(t, content)
+			_, err := Load(path, "")
+			if valid && err != nil {
+				t.Errorf("expected no error for format %q, got %v", format, err)
+			}
+			if !valid && err == nil {
+				t.Errorf("expected an error for format %q, got nil", format)
+			}
+		}
+	})
+
+	t.Run("invalid idle timeout", func(t *testing.T) {
+		for _, content := range []string{
+			"idle_timeout = \"soon\"\n",
+			"[[lease]]\nsource = \"op://vault/item/secret\"\ndestination = \".envrc\"\nvariable = \"API_KEY\"\nduration = \"1h\"\nidle_timeout = \"-5m\"\n",
+		} {
+			path := createTempConfig(t, content)
+			if _, err := Load(path, ""); err == nil {
+				t.Errorf("expected an error for %q, got nil", content)
+			}
+		}
+	})
+
+	t.Run("same lease rules as validate", func(t *testing.T) {
+		for content, expected := range map[string]string{
+			"[[lease]]\nsource = \"op://vault/item/secret\"\ndestination = \".envrc\"\nvariable = \"API_KEY\"\nduration = \"0s\"\n":                            "lease 0: invalid duration '0s': must be positive",
+			"[[lease]]\nsource = \"op://vault/item/secret\"\ndestination = \".envrc\"\nvariable = \"API_KEY\"\n":                                               "lease 0: duration is required",
+			"[[lease]]\nsource = \"op://vault/item/secret\"\ndestination = \".envrc\"\nduration = \"1h\"\ntransform = [\"json\", \"explode\"]\n":               "",
+			"[[lease]]\nsource = \"op://vault/item/secret\"\ndestination = \".envrc\"\nvariable = \"API_KEY\"\nduration = \"1h\"\ntransform = [\"unknown\"]\n": "lease 0: invalid transform: unknown transformer: unknown",
+		} {
+			path := createTempConfig(t, content)
+			_, err := Load(path, "")
+			if expected == "" {
+				if err != nil {
+					t.Errorf("expected no error for %q, got %v", content, err)
+				}
+				continue
+			}
+			if err == nil || err.Error() != expected {
+				t.Errorf("expected error %q for %q, got %v", expected, content, err)
+			}
+
+			issues, verr := Validate(path, "", false)
+			if verr != nil || len(issues) == 0 || "lease 0: "+issues[0].Message != expected {
+				t.Errorf("expected validate to report %q for %q, got %v", expected, content, issues)
+			}
+		}
+	})
 }
 
 func createTempConfig(t *testing.T, content string) string {
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Shutdown policies control what the daemon does with active leases when it
+// stops.
+const (
+	// ShutdownPolicyRevoke revokes every active lease and clears the state file.
+	ShutdownPolicyRevoke = "revoke"
+	// ShutdownPolicyPersist keeps the state file so leases survive a restart and
+	// are expired on the next start.
+	ShutdownPolicyPersist = "persist"
+	// ShutdownPolicyRevokeOnLogout revokes leases when the user session ends
+	// but persists them when the system is shutting down or rebooting.
+	ShutdownPolicyRevokeOnLogout = "revoke-on-logout-only"
+)
+
+// State encryption modes control how the daemon state file is stored at rest.
+const (
+	// StateEncryptionOff stores the state file as plaintext JSON.
+	StateEncryptionOff = "off"
+	// StateEncryptionToken encrypts the state file with a key derived from
+	// auth.token.
+	StateEncryptionToken = "token"
+	// StateEncryptionKeyring encrypts the state file with a random key kept in
+	// the OS keyring.
+	StateEncryptionKeyring = "keyring"
+)
+
+// Session revoke modes control which leases are revoked when the screen
+// locks, the system suspends or the user's last session ends.
+const (
+	// SessionRevokeMarked revokes only leases with revoke_on_lock = true.
+	SessionRevokeMarked = "marked"
+	// SessionRevokeAll revokes every active lease.
+	SessionRevokeAll = "all"
+	// SessionRevokeOff ignores session events.
+	SessionRevokeOff = "off"
+)
+
+// Idle sources select how the daemon measures how long the user has been
+// idle.
+const (
+	// IdleSourceAuto uses the first source that works on this system.
+	IdleSourceAuto = "auto"
+	// IdleSourceMutter asks GNOME's Mutter IdleMonitor on the session bus.
+	IdleSourceMutter = "mutter"
+	// IdleSourceX11 asks the X server's MIT-SCREEN-SAVER extension.
+	IdleSourceX11 = "x11"
+	// IdleSourceLogind reads the user's IdleHint from systemd-logind.
+	IdleSourceLogind = "logind"
+	// IdleSourceIOKit reads the HID idle time on macOS.
+	IdleSourceIOKit = "iokit"
+)
+
+// DefaultRetryMaxAttempts is the number of times a failed revocation is tried
+// before it is given up on.
+const DefaultRetryMaxAttempts = 10
+
+// DaemonConfig represents the structure of the daemon.toml file.
+type DaemonConfig struct {
+	ShutdownPolicy   string `toml:"shutdown_policy"`
+	RetryMaxAttempts int    `toml:"retry_max_attempts"`
+	// MetricsListen is where the metrics endpoint is served: either
+	// "unix:<path>" or a loopback "host:port". Empty disables it.
+	MetricsListen string `toml:"metrics_listen"`
+	// IPCIOTimeout bounds reading a request from, and writing a response to,
+	// a client.
+	IPCIOTimeout string `toml:"ipc_io_timeout"`
+	// IPCHandlerTimeout bounds how long a request may wait for and hold the
+	// daemon before it is abandoned.
+	IPCHandlerTimeout string `toml:"ipc_handler_timeout"`
+	// StateEncryption selects how the state file is encrypted at rest. See
+	// the StateEncryption* constants.
+	StateEncryption string `toml:"state_encryption"`
+	// SessionRevoke selects which leases are revoked on screen lock, suspend
+	// and logout. See the SessionRevoke* constants.
+	SessionRevoke string `toml:"session_revoke"`
+	// IdleTimeout is how long the user may be idle before leases are
+	// revoked. Empty or "0" disables idle revocation.
+	IdleTimeout string `toml:"idle_timeout"`
+	// IdleSource selects how idle time is measured. See the IdleSource*
+	// constants.
+	IdleSource string `toml:"idle_source"`
+}
+
+// DefaultDaemonConfig returns the daemon configuration used when no
+// daemon.toml file exists.
+func DefaultDaemonConfig() *DaemonConfig {
+	return &DaemonConfig{
+		ShutdownPolicy:    ShutdownPolicyRevoke,
+		RetryMaxAttempts:  DefaultRetryMaxAttempts,
+		IPCIOTimeout:      "5s",
+		IPCHandlerTimeout: "20s",
+		StateEncryption:   StateEncryptionOff,
+		SessionRevoke:     SessionRevokeMarked,
+		IdleSource:        IdleSourceAuto,
+	}
+}
+
+// LoadDaemonConfig reads the daemon configuration from path. A missing file is
+// not an error; the defaults are returned instead.
+func LoadDaemonConfig(path string) (*DaemonConfig, error) {
+	cfg := DefaultDaemonConfig()
+
+	meta, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return DefaultDaemonConfig(), nil
+		}
+		return nil, fmt.Errorf("failed to load daemon config: %w", err)
+	}
+
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		return nil, fmt.Errorf("unknown keys in daemon config: %s", strings.Join(keys, ", "))
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the daemon configuration for invalid values.
+func (c *DaemonConfig) Validate() error {
+	switch c.ShutdownPolicy {
+	case ShutdownPolicyRevoke, ShutdownPolicyPersist, ShutdownPolicyRevokeOnLogout:
+	default:
+		return fmt.Errorf("invalid shutdown_policy '%s': must be one of '%s', '%s' or '%s'",
+			c.ShutdownPolicy, ShutdownPolicyRevoke, ShutdownPolicyPersist, ShutdownPolicyRevokeOnLogout)
+	}
+	if c.RetryMaxAttempts < 1 {
+		return fmt.Errorf("invalid retry_max_attempts %d: must be at least 1", c.RetryMaxAttempts)
+	}
+	switch c.StateEncryption {
+	case StateEncryptionOff, StateEncryptionToken, StateEncryptionKeyring:
+	default:
+		return fmt.Errorf("invalid state_encryption '%s': must be one of '%s', '%s' or '%s'",
+			c.StateEncryption, StateEncryptionOff, StateEncryptionToken, StateEncryptionKeyring)
+	}
+	switch c.SessionRevoke {
+	case SessionRevokeMarked, SessionRevokeAll, SessionRevokeOff:
+	default:
+		return fmt.Errorf("invalid session_revoke '%s': must be one of '%s', '%s' or '%s'",
+			c.SessionRevoke, SessionRevokeMarked, SessionRevokeAll, SessionRevokeOff)
+	}
+	switch c.IdleSource {
+	case IdleSourceAuto, IdleSourceMutter, IdleSourceX11, IdleSourceLogind, IdleSourceIOKit:
+	default:
+		return fmt.Errorf("invalid idle_source '%s': must be one of '%s', '%s', '%s', '%s' or '%s'",
+			c.IdleSource, IdleSourceAuto, IdleSourceMutter, IdleSourceX11, IdleSourceLogind, IdleSourceIOKit)
+	}
+	if c.IdleTimeout != "" {
+		if _, err := parseTimeout(c.IdleTimeout); err != nil {
+			return fmt.Errorf("invalid idle_timeout '%s': %w", c.IdleTimeout, err)
+		}
+	}
+	for key, value := range map[string]string{
+		"ipc_io_timeout":      c.IPCIOTimeout,
+		"ipc_handler_timeout": c.IPCHandlerTimeout,
+	} {
+		if _, err := parseTimeout(value); err != nil {
+			return fmt.Errorf("invalid %s '%s': %w", key, value, err)
+		}
+	}
+	if c.MetricsListen != "" {
+		if _, _, err := ParseMetricsListen(c.MetricsListen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseMetricsListen splits a metrics_listen value into a network and address
+// suitable for net.Listen. TCP addresses must be on a loopback interface so
+// metrics are never exposed beyond the local machine.
+func ParseMetricsListen(value string) (network, address string, err error) {
+	if path, ok := strings.CutPrefix(value, "unix:"); ok {
+		if path == "" {
+			return "", "", fmt.Errorf("invalid metrics_listen '%s': missing socket path", value)
+		}
+		return "unix", path, nil
+	}
+
+	host, _, err := net.SplitHostPort(value)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid metrics_listen '%s': %w", value, err)
+	}
+	if host != "localhost" {
+		ip := net.ParseIP(host)
+		if ip == nil || !ip.IsLoopback() {
+			return "", "", fmt.Errorf("invalid metrics_listen '%s': host must be a loopback address", value)
+		}
+	}
+	return "tcp", value, nil
+}
+
+// IPCTimeouts returns the parsed IPC timeouts. It must only be called on a
+// validated configuration.
+func (c *DaemonConfig) IPCTimeouts() (io, handler time.Duration) {
+	io, _ = parseTimeout(c.IPCIOTimeout)
+	handler, _ = parseTimeout(c.IPCHandlerTimeout)
+	return io, handler
+}
+
+// IdleTimeoutDuration returns the parsed idle timeout, or 0 when idle
+// revocation is disabled. It must only be called on a validated
+// configuration.
+func (c *DaemonConfig) IdleTimeoutDuration() time.Duration {
+	if c.IdleTimeout == "" {
+		return 0
+	}
+	d, _ := parseTimeout(c.IdleTimeout)
+	return d
+}
+
+// parseTimeout parses a duration string. "0" disables the timeout.
+func parseTimeout(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return d, nil
+}
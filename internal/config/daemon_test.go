@@ -0,0 +1,162 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadDaemonConfig(t *testing.T) {
+	t.Run("missing file returns defaults", func(t *testing.T) {
+		cfg, err := LoadDaemonConfig(filepath.Join(t.TempDir(), "daemon.toml"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cfg.ShutdownPolicy != ShutdownPolicyRevoke {
+			t.Errorf("expected default shutdown policy %q, got %q", ShutdownPolicyRevoke, cfg.ShutdownPolicy)
+		}
+	})
+
+	t.Run("valid shutdown policy", func(t *testing.T) {
+		path := createTempConfig(t, `shutdown_policy = "persist"`)
+
+		cfg, err := LoadDaemonConfig(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cfg.ShutdownPolicy != ShutdownPolicyPersist {
+			t.Errorf("expected shutdown policy %q, got %q", ShutdownPolicyPersist, cfg.ShutdownPolicy)
+		}
+	})
+
+	t.Run("invalid shutdown policy", func(t *testing.T) {
+		path := createTempConfig(t, `shutdown_policy = "keep"`)
+
+		if _, err := LoadDaemonConfig(path); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+
+	t.Run("invalid retry attempts", func(t *testing.T) {
+		path := createTempConfig(t, `retry_max_attempts = 0`)
+
+		if _, err := LoadDaemonConfig(path); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+
+	t.Run("state encryption", func(t *testing.T) {
+		path := createTempConfig(t, `state_encryption = "keyring"`)
+
+		cfg, err := LoadDaemonConfig(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cfg.StateEncryption != StateEncryptionKeyring {
+			t.Errorf("expected state encryption %q, got %q", StateEncryptionKeyring, cfg.StateEncryption)
+		}
+	})
+
+	t.Run("invalid state encryption", func(t *testing.T) {
+		path := createTempConfig(t, `state_encryption = "aes"`)
+
+		if _, err := LoadDaemonConfig(path); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+
+	t.Run("session revoke", func(t *testing.T) {
+		path := createTempConfig(t, `session_revoke = "all"`)
+
+		cfg, err := LoadDaemonConfig(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cfg.SessionRevoke != SessionRevokeAll {
+			t.Errorf("expected session revoke %q, got %q", SessionRevokeAll, cfg.SessionRevoke)
+		}
+
+		path = createTempConfig(t, `session_revoke = "sometimes"`)
+		if _, err := LoadDaemonConfig(path); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+
+	t.Run("idle timeout", func(t *testing.T) {
+		path := createTempConfig(t, "idle_timeout = \"30m\"\nidle_source = \"logind\"")
+
+		cfg, err := LoadDaemonConfig(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cfg.IdleTimeoutDuration() != 30*time.Minute || cfg.IdleSource != IdleSourceLogind {
+			t.Errorf("expected 30m from logind, got %s from %q", cfg.IdleTimeoutDuration(), cfg.IdleSource)
+		}
+
+		for _, content := range []string{`idle_timeout = "soon"`, `idle_source = "xprintidle"`} {
+			if _, err := LoadDaemonConfig(createTempConfig(t, content)); err == nil {
+				t.Errorf("expected an error for %s, got nil", content)
+			}
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		path := createTempConfig(t, `shutdown_polcy = "persist"`)
+
+		if _, err := LoadDaemonConfig(path); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+}
+
+func TestParseMetricsListen(t *testing.T) {
+	tests := []struct {
+		value   string
+		network string
+		wantErr bool
+	}{
+		{value: "unix:/run/user/1000/env-lease/metrics.sock", network: "unix"},
+		{value: "127.0.0.1:9464", network: "tcp"},
+		{value: "localhost:9464", network: "tcp"},
+		{value: "[::1]:9464", network: "tcp"},
+		{value: "0.0.0.0:9464", wantErr: true},
+		{value: "example.com:9464", wantErr: true},
+		{value: "unix:", wantErr: true},
+		{value: "9464", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			network, _, err := ParseMetricsListen(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if network != tt.network {
+				t.Errorf("expected network %q, got %q", tt.network, network)
+			}
+		})
+	}
+}
+
+func TestDaemonConfig_IPCTimeouts(t *testing.T) {
+	path := createTempConfig(t, "ipc_io_timeout = \"2s\"\nipc_handler_timeout = \"0\"")
+
+	cfg, err := LoadDaemonConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	io, handler := cfg.IPCTimeouts()
+	if io != 2*time.Second || handler != 0 {
+		t.Errorf("expected 2s and 0, got %s and %s", io, handler)
+	}
+
+	path = createTempConfig(t, `ipc_io_timeout = "soon"`)
+	if _, err := LoadDaemonConfig(path); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Position is a 1-based line and column in a config file.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// keyPattern matches the key of a "key = value" line.
+var keyPattern = regexp.MustCompile(`^(\s*)([A-Za-z0-9_-]+|"[^"]*"|'[^']*')\s*=`)
+
+// tablePositions records where a table and its keys are defined.
+type tablePositions struct {
+	header Position
+	keys   map[string]Position
+}
+
+// key returns where key is defined, or the table header if it is not.
+func (t tablePositions) key(name string) Position {
+	if pos, ok := t.keys[name]; ok {
+		return pos
+	}
+	return t.header
+}
+
+// documentPositions records where the top-level keys and [[lease]] tables of
+// a TOML document are. BurntSushi/toml does not expose key positions, so the
+// document is scanned line by line. It only has to be good enough to point
+// at a line: a value it cannot place falls back to the enclosing table.
+type documentPositions struct {
+	top    tablePositions
+	leases []tablePositions
+}
+
+func scanPositions(content string) *documentPositions {
+	doc := &documentPositions{
+		top: tablePositions{header: Position{Line: 1, Column: 1}, keys: make(map[string]Position)},
+	}
+	current := &doc.top
+	var multiline string
+	for i, line := range strings.Split(content, "\n") {
+		if multiline != "" {
+			if strings.Count(line, multiline)%2 == 1 {
+				multiline = ""
+			}
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		column := len(line) - len(strings.TrimLeft(line, " \t")) + 1
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			continue
+		case strings.HasPrefix(trimmed, "[["):
+			current = nil
+			if tableName(trimmed, "[[", "]]") == "lease" {
+				doc.leases = append(doc.leases, tablePositions{
+					header: Position{Line: i + 1, Column: column},
+					keys:   make(map[string]Position),
+				})
+				current = &doc.leases[len(doc.leases)-1]
+			}
+			continue
+		case strings.HasPrefix(trimmed, "["):
+			current = nil
+			continue
+		}
+		if m := keyPattern.FindStringSubmatchIndex(line); m != nil && current != nil {
+			key := strings.Trim(line[m[4]:m[5]], `"'`)
+			if _, ok := current.keys[key]; !ok {
+				current.keys[key] = Position{Line: i + 1, Column: m[4] + 1}
+			}
+		}
+		for _, delim := range []string{`"""`, `'''`} {
+			if strings.Count(line, delim)%2 == 1 {
+				multiline = delim
+				break
+			}
+		}
+	}
+	return doc
+}
+
+// tableName returns the name in a table header like "[[ lease ]] # comment".
+func tableName(header, open, close string) string {
+	header = strings.TrimPrefix(header, open)
+	if end := strings.Index(header, close); end >= 0 {
+		header = header[:end]
+	}
+	return strings.Trim(strings.TrimSpace(header), `"'`)
+}
+
+// lease returns the positions of the i-th lease. Leases that are not in a
+// [[lease]] table, like an inline array of tables, point at the lease key.
+func (d *documentPositions) lease(i int) tablePositions {
+	if i < len(d.leases) {
+		return d.leases[i]
+	}
+	return tablePositions{header: d.top.key("lease")}
+}
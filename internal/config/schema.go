@@ -0,0 +1,199 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mblarsen/env-lease/internal/envfile"
+	"github.com/mblarsen/env-lease/internal/transform"
+)
+
+// JSONSchema is the part of JSON Schema (draft-07) the config schema uses.
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Const                string                 `json:"const,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Default              any                    `json:"default,omitempty"`
+	Examples             []string               `json:"examples,omitempty"`
+	AnyOf                []*JSONSchema          `json:"anyOf,omitempty"`
+	If                   *JSONSchema            `json:"if,omitempty"`
+	Then                 *JSONSchema            `json:"then,omitempty"`
+	// Taplo completes these keys when a new table is added.
+	Taplo map[string]any `json:"x-taplo,omitempty"`
+}
+
+// Providers are the valid values of provider. The first is the default.
+var Providers = []string{"1password"}
+
+// requiredLeaseKeys must be set in every lease.
+var requiredLeaseKeys = []string{"source", "duration"}
+
+// DurationPattern matches what time.ParseDuration accepts, without a minus
+// sign. Validate also rejects a zero lease duration.
+const DurationPattern = `^\+?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+)$`
+
+// keyInfo is what the schema says about a key beyond its Go type.
+type keyInfo struct {
+	description string
+	enum        []string
+	pattern     string
+	def         any
+	examples    []string
+}
+
+// topLevelKeys describes the keys of Config.
+var topLevelKeys = map[string]keyInfo{
+	"idle_timeout": {
+		description: "Revoke the project's leases after you have been idle this long. Overrides the daemon setting; \"0\" disables it.",
+		pattern:     DurationPattern,
+		examples:    []string{"10m"},
+	},
+	"lease": {description: "A secret to lease."},
+}
+
+// leaseKeys describes the keys of Lease.
+var leaseKeys = map[string]keyInfo{
+	"provider": {
+		description: "The secret provider.",
+		enum:        Providers,
+		def:         Providers[0],
+	},
+	"source": {
+		description: "The URI of the secret: an op:// reference, or op+file://<item>/<file> for a document attachment.",
+		examples:    []string{"op://vault/item/secret", "op+file://My Item/file.json"},
+	},
+	"destination": {
+		description: "The file to write, relative to the project root. Required for env leases; file leases default to the source's file name.",
+		examples:    []string{".envrc", ".env"},
+	},
+	"duration": {
+		description: "How long the lease lasts, like \"10m\", \"1h\" or \"8h\". Must be more than zero.",
+		pattern:     DurationPattern,
+		examples:    []string{"1h"},
+	},
+	"lease_type": {
+		description: "env writes a variable to a file, file writes the secret as a file and shell prints a command that sets a variable in your shell.",
+		enum:        LeaseTypes,
+		def:         LeaseTypes[0],
+	},
+	"variable": {
+		description: "The name of the environment variable. Required for env and shell leases unless the secret is exploded.",
+		examples:    []string{"API_KEY"},
+	},
+	"format": {
+		description: "How env leases write the variable: a format dialect or a Go format string like \"%s=%q\". .envrc defaults to posix-sh and .env to dotenv.",
+	},
+	"transform": {
+		description: "Steps that transform the secret before it is written, in order, like [\"json\", \"select 'key'\"].",
+	},
+	"file_mode": {
+		description: "The octal permissions of the written file.",
+		pattern:     `^[0-7]+$`,
+		def:         "0600",
+	},
+	"op_account": {description: "The 1Password account to use. Overrides OP_ACCOUNT."},
+	"revoke_on_lock": {
+		description: "Revoke the lease when the screen locks, the system suspends or you log out (Linux only).",
+		def:         false,
+	},
+	"idle_timeout": {
+		description: "Revoke the lease after you have been idle this long. Overrides the project and daemon setting; \"0\" exempts the lease.",
+		pattern:     DurationPattern,
+		examples:    []string{"10m"},
+	},
+}
+
+// Schema returns a JSON Schema for the config file. It is built from the
+// same structs, key lists and transform syntax Load and Validate use.
+func Schema() *JSONSchema {
+	lease := objectSchema(reflect.TypeOf(Lease{}), leaseKeys)
+	lease.Required = requiredLeaseKeys
+	lease.Properties["format"].AnyOf = formatSchemas()
+	lease.Properties["transform"].Items = transformSchema()
+	// An env lease, the default, needs a destination.
+	lease.If = &JSONSchema{Properties: map[string]*JSONSchema{"lease_type": {Const: LeaseTypes[0]}}}
+	lease.Then = &JSONSchema{Required: []string{"destination"}}
+	lease.Taplo = map[string]any{"initKeys": []string{"source", "destination", "variable", "duration"}}
+
+	top := objectSchema(reflect.TypeOf(Config{}), topLevelKeys)
+	top.Schema = "http://json-schema.org/draft-07/schema#"
+	top.Title = "env-lease.toml"
+	top.Description = "The leases env-lease grants for a project."
+	top.Properties["lease"].Items = lease
+	return top
+}
+
+// objectSchema describes the toml keys of t. Nested types are left for the
+// caller to fill in.
+func objectSchema(t reflect.Type, keys map[string]keyInfo) *JSONSchema {
+	closed := false
+	schema := &JSONSchema{
+		Type:                 "object",
+		Properties:           make(map[string]*JSONSchema),
+		AdditionalProperties: &closed,
+	}
+	for key, index := range tomlFields(t) {
+		info := keys[key]
+		schema.Properties[key] = &JSONSchema{
+			Type:        jsonType(t.Field(index).Type),
+			Description: info.description,
+			Enum:        info.enum,
+			Pattern:     info.pattern,
+			Default:     info.def,
+			Examples:    info.examples,
+		}
+	}
+	return schema
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice:
+		return "array"
+	default:
+		return "string"
+	}
+}
+
+// formatSchemas accepts the formats Validate accepts: a dialect, a format
+// string or the old "base64".
+func formatSchemas() []*JSONSchema {
+	return []*JSONSchema{
+		{Enum: envfile.Names(), Description: "A format dialect that quotes values the way the file's reader expects."},
+		{Pattern: "%", Description: "A Go format string that gets the variable and the value."},
+		{Const: "base64", Description: "Deprecated: use transform = [\"base64-encode\"]."},
+	}
+}
+
+// transformSchema accepts the steps in transform.Steps.
+func transformSchema() *JSONSchema {
+	var names []string
+	var descriptions []string
+	schema := &JSONSchema{Type: "string"}
+	for _, step := range transform.Steps {
+		if step.Pattern == "" {
+			names = append(names, step.Name)
+			descriptions = append(descriptions, fmt.Sprintf("%s: %s", step.Name, step.Description))
+			continue
+		}
+		schema.AnyOf = append(schema.AnyOf, &JSONSchema{
+			Pattern:     step.Pattern,
+			Description: step.Description,
+			Examples:    []string{step.Example},
+		})
+	}
+	steps := &JSONSchema{Enum: names, Description: strings.Join(descriptions, "\n")}
+	schema.AnyOf = append([]*JSONSchema{steps}, schema.AnyOf...)
+	return schema
+}
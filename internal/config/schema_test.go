@@ -0,0 +1,98 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSchema(t *testing.T) {
+	t.Run("describes every key", func(t *testing.T) {
+		for typ, keys := range map[reflect.Type]map[string]keyInfo{
+			reflect.TypeOf(Config{}): topLevelKeys,
+			reflect.TypeOf(Lease{}):  leaseKeys,
+		} {
+			fields := tomlFields(typ)
+			for key := range fields {
+				if keys[key].description == "" {
+					t.Errorf("%s key %q has no description", typ.Name(), key)
+				}
+			}
+			for key := range keys {
+				if _, ok := fields[key]; !ok {
+					t.Errorf("%s has no key %q", typ.Name(), key)
+				}
+			}
+		}
+	})
+
+	t.Run("duration pattern agrees with time.ParseDuration", func(t *testing.T) {
+		pattern := regexp.MustCompile(DurationPattern)
+		for _, value := range []string{
+			"0", "0s", "10m", "1h30m", "1.5h", ".5h", "2.h", "+1h", "300ms", "10us", "10µs", "1h0m0s",
+			"", "1", "-1h", "1 h", "1hour", "h", "1d", "1h-5m", " 1h", "0x10s", "1e3s",
+		} {
+			d, err := time.ParseDuration(value)
+			accepted := err == nil && d >= 0
+			if pattern.MatchString(value) != accepted {
+				t.Errorf("%q: pattern matches: %v, ParseDuration accepts: %v", value, pattern.MatchString(value), accepted)
+			}
+		}
+	})
+
+	t.Run("enum values validate", func(t *testing.T) {
+		lease := Schema().Properties["lease"].Items
+		for _, leaseType := range lease.Properties["lease_type"].Enum {
+			assertValid(t, fmt.Sprintf("lease_type = %q\ndestination = \"app.env\"\nvariable = \"API_KEY\"\nformat = \"dotenv\"", leaseType))
+		}
+		for _, provider := range lease.Properties["provider"].Enum {
+			assertValid(t, fmt.Sprintf("provider = %q\ndestination = \".envrc\"\nvariable = \"API_KEY\"", provider))
+		}
+		for _, format := range lease.Properties["format"].AnyOf[0].Enum {
+			assertValid(t, fmt.Sprintf("format = %q\ndestination = \"app.env\"\nvariable = \"API_KEY\"", format))
+		}
+		for _, step := range lease.Properties["transform"].Items.AnyOf[0].Enum {
+			// Parsing steps need a step that turns their result back into a
+			// string, and to_* steps need structured input.
+			transforms := fmt.Sprintf("[%q]", step)
+			switch step {
+			case "json", "toml", "yaml":
+				transforms = fmt.Sprintf("[%q, \"to_json\"]", step)
+			case "to_json", "to_yaml", "to_toml":
+				transforms = fmt.Sprintf("[\"json\", %q]", step)
+			}
+			assertValid(t, fmt.Sprintf("transform = %s\ndestination = \".envrc\"\nvariable = \"API_KEY\"", transforms))
+		}
+	})
+
+	t.Run("marshals", func(t *testing.T) {
+		out, err := json.Marshal(Schema())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc map[string]any
+		if err := json.Unmarshal(out, &doc); err != nil {
+			t.Fatal(err)
+		}
+		if doc["$schema"] != "http://json-schema.org/draft-07/schema#" {
+			t.Errorf("unexpected $schema %v", doc["$schema"])
+		}
+	})
+}
+
+// assertValid validates a config with a single lease made of keys and a
+// source and duration.
+func assertValid(t *testing.T, keys string) {
+	t.Helper()
+	path := createTempConfig(t, "[[lease]]\nsource = \"op://vault/item/secret\"\nduration = \"1h\"\n"+keys+"\n")
+	issues, err := Validate(path, "", false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("expected no issues for\n%s\ngot %v", keys, issues)
+	}
+}
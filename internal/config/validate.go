@@ -0,0 +1,433 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/mblarsen/env-lease/internal/envfile"
+	"github.com/mblarsen/env-lease/internal/fileutil"
+	"github.com/mblarsen/env-lease/internal/transform"
+)
+
+// Severity tells whether an Issue stops a grant.
+type Severity string
+
+const (
+	// SeverityError is an issue that makes grant fail.
+	SeverityError Severity = "error"
+	// SeverityWarning is an issue grant works around, like an unknown key.
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a problem Validate found in a config file.
+type Issue struct {
+	File string `json:"file"`
+	Position
+	Severity Severity `json:"severity"`
+	// Key is the key the issue is about, like "lease[1].duration".
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", i.File, i.Line, i.Column, i.Severity, i.Message)
+}
+
+// LeaseTypes are the valid values of lease_type. The first is the default.
+var LeaseTypes = []string{"env", "file", "shell"}
+
+// maxRecommendedDuration is the longest lease grant does not warn about.
+const maxRecommendedDuration = 12 * time.Hour
+
+// leaseTarget is a validated lease and where it came from.
+type leaseTarget struct {
+	lease Lease
+	file  string
+	index int
+	pos   tablePositions
+	// invalid holds the keys whose value has the wrong type, so they are
+	// not also reported as missing.
+	invalid map[string]bool
+}
+
+// issueAt returns an issue about key in the lease.
+func (t leaseTarget) issueAt(severity Severity, key, format string, args ...any) Issue {
+	issue := Issue{
+		File:     t.file,
+		Position: t.pos.key(key),
+		Severity: severity,
+		Key:      fmt.Sprintf("lease[%d]", t.index),
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if key != "" {
+		issue.Key += "." + key
+	}
+	return issue
+}
+
+// Validate loads the config at path and its local override like Load does,
+// but instead of stopping at the first problem it returns every problem it
+// finds, including the ones grant would only run into later. File leases
+// outside the project root are allowed if destinationOutsideRoot is set, as
+// with grant's --destination-outside-root. The error is only set if a config
+// file cannot be read.
+func Validate(path, localPath string, destinationOutsideRoot bool) ([]Issue, error) {
+	absPath, err := expandAndAbs(path)
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Dir(absPath)
+
+	issues, leases, err := validateFile(absPath, root, destinationOutsideRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	localConfigPath, err := resolveLocalConfigFile(absPath, localPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve local config path: %w", err)
+	}
+	if localConfigPath != "" {
+		localIssues, localLeases, err := validateFile(localConfigPath, root, destinationOutsideRoot)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		issues = append(issues, localIssues...)
+		leases = append(leases, localLeases...)
+	}
+
+	issues = append(issues, checkDuplicates(leases, root)...)
+
+	fileOrder := map[string]int{absPath: 0, localConfigPath: 1}
+	sort.SliceStable(issues, func(i, j int) bool {
+		a, b := issues[i], issues[j]
+		if a.File != b.File {
+			return fileOrder[a.File] < fileOrder[b.File]
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return issues, nil
+}
+
+// validateFile checks a single config file. Leases are checked against the
+// project root, which is the directory of the main config.
+func validateFile(path, root string, destinationOutsideRoot bool) ([]Issue, []leaseTarget, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var top map[string]toml.Primitive
+	md, err := toml.Decode(string(content), &top)
+	if err != nil {
+		issue := Issue{File: path, Position: Position{Line: 1, Column: 1}, Severity: SeverityError, Message: err.Error()}
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			issue.Position = Position{Line: parseErr.Position.Line, Column: parseErr.Position.Col}
+			issue.Message = parseErr.Message
+		}
+		return []Issue{issue}, nil, nil
+	}
+	positions := scanPositions(string(content))
+
+	var cfg Config
+	issues := decodeTable(md, top, reflect.ValueOf(&cfg).Elem(), path, positions.top, "")
+	if err := checkIdleTimeout(cfg.IdleTimeout); err != nil {
+		issues = append(issues, Issue{
+			File:     path,
+			Position: positions.top.key("idle_timeout"),
+			Severity: SeverityError,
+			Key:      "idle_timeout",
+			Message:  err.Error(),
+		})
+	}
+
+	// Leases are decoded one key at a time so a value of the wrong type is
+	// reported where it is instead of hiding everything after it.
+	var leases []leaseTarget
+	if prim, ok := top["lease"]; ok {
+		var tables []map[string]toml.Primitive
+		if err := md.PrimitiveDecode(prim, &tables); err != nil {
+			return append(issues, Issue{
+				File:     path,
+				Position: positions.top.key("lease"),
+				Severity: SeverityError,
+				Key:      "lease",
+				Message:  "lease must be an array of tables: use [[lease]]",
+			}), nil, nil
+		}
+		for i, table := range tables {
+			target := leaseTarget{file: path, index: i, pos: positions.lease(i), invalid: make(map[string]bool)}
+			prefix := fmt.Sprintf("lease[%d].", i)
+			for _, issue := range decodeTable(md, table, reflect.ValueOf(&target.lease).Elem(), path, target.pos, prefix) {
+				if issue.Severity == SeverityError {
+					target.invalid[strings.TrimPrefix(issue.Key, prefix)] = true
+				}
+				issues = append(issues, issue)
+			}
+			issues = append(issues, checkLease(&target)...)
+			issues = append(issues, checkDestination(target, root, destinationOutsideRoot)...)
+			leases = append(leases, target)
+		}
+	}
+	return issues, leases, nil
+}
+
+// decodeTable decodes each key of table into the field of dst with the same
+// toml tag. Keys without a field are reported as unknown.
+func decodeTable(md toml.MetaData, table map[string]toml.Primitive, dst reflect.Value, file string, pos tablePositions, prefix string) []Issue {
+	fields := tomlFields(dst.Type())
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var issues []Issue
+	for _, key := range keys {
+		if prefix == "" && key == "lease" {
+			continue
+		}
+		index, ok := fields[key]
+		if !ok {
+			issues = append(issues, Issue{
+				File:     file,
+				Position: pos.key(key),
+				Severity: SeverityWarning,
+				Key:      prefix + key,
+				Message:  fmt.Sprintf("unknown key '%s'", key),
+			})
+			continue
+		}
+		if err := md.PrimitiveDecode(table[key], dst.Field(index).Addr().Interface()); err != nil {
+			issues = append(issues, Issue{
+				File:     file,
+				Position: pos.key(key),
+				Severity: SeverityError,
+				Key:      prefix + key,
+				Message:  fmt.Sprintf("%s: %s", key, decodeErrorMessage(err)),
+			})
+		}
+	}
+	return issues
+}
+
+// tomlFields maps the toml tags of t to field indexes.
+func tomlFields(t reflect.Type) map[string]int {
+	fields := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("toml"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}
+
+var decodeErrorPrefix = regexp.MustCompile(`^toml: (line \d+ )?(\(last key "[^"]*"\): )?`)
+
+// decodeErrorMessage strips the "toml: line N (last key ...)" prefix. The
+// issue has its own position and key, and the line is not the key's.
+func decodeErrorMessage(err error) string {
+	return decodeErrorPrefix.ReplaceAllString(err.Error(), "")
+}
+
+// checkLease applies the defaults to the lease and reports what makes it
+// invalid. Load fails on the first error it reports.
+func checkLease(t *leaseTarget) []Issue {
+	var issues []Issue
+	l := &t.lease
+	errorf := func(key, format string, args ...any) {
+		issues = append(issues, t.issueAt(SeverityError, key, format, args...))
+	}
+	warnf := func(key, format string, args ...any) {
+		issues = append(issues, t.issueAt(SeverityWarning, key, format, args...))
+	}
+
+	expandedDest, err := fileutil.ExpandPath(l.Destination)
+	if err != nil {
+		errorf("destination", "could not expand destination path: %v", err)
+	}
+	l.Destination = expandedDest
+	if len(l.Transform) == 0 && l.Format == "base64" {
+		l.Transform = []string{"base64-encode"}
+	}
+	if l.LeaseType == "" {
+		l.LeaseType = LeaseTypes[0]
+	}
+	if l.Provider == "" {
+		l.Provider = Providers[0]
+	}
+
+	fields := tomlFields(reflect.TypeOf(*l))
+	for _, key := range requiredLeaseKeys {
+		if reflect.ValueOf(*l).Field(fields[key]).IsZero() && !t.invalid[key] {
+			errorf("", "%s is required", key)
+		}
+	}
+	if !slices.Contains(Providers, l.Provider) {
+		errorf("provider", "unknown provider '%s': use one of %s", l.Provider, strings.Join(Providers, ", "))
+	}
+	if !slices.Contains(LeaseTypes, l.LeaseType) {
+		errorf("lease_type", "unknown lease_type '%s': use one of %s", l.LeaseType, strings.Join(LeaseTypes, ", "))
+	}
+	if l.LeaseType == "env" && l.Destination == "" && !t.invalid["destination"] {
+		errorf("", "destination is required for lease_type '%s'", l.LeaseType)
+	}
+	if l.LeaseType == "file" && l.Destination == "" && l.Source != "" {
+		l.Destination = filepath.Base(l.Source)
+	}
+
+	explode := -1
+	for i, step := range l.Transform {
+		if strings.HasPrefix(strings.TrimSpace(step), "explode") {
+			explode = i
+			break
+		}
+	}
+	if (l.LeaseType == "env" || l.LeaseType == "shell") && l.Variable == "" && explode < 0 && !t.invalid["variable"] {
+		errorf("", "variable is required for lease_type '%s'", l.LeaseType)
+	}
+
+	if l.Duration == "" {
+		// Reported as required above.
+	} else if d, err := time.ParseDuration(l.Duration); err != nil {
+		errorf("duration", "invalid duration '%s': %v", l.Duration, err)
+	} else if d <= 0 {
+		errorf("duration", "invalid duration '%s': must be positive", l.Duration)
+	} else if d > maxRecommendedDuration {
+		warnf("duration", "leases longer than %s are discouraged for security reasons", maxRecommendedDuration)
+	}
+
+	if err := checkIdleTimeout(l.IdleTimeout); err != nil {
+		errorf("idle_timeout", "%v", err)
+	}
+
+	// Formats without a verb name a dialect; "base64" is the old way of
+	// asking for the base64-encode transform.
+	if l.Format != "" && !strings.Contains(l.Format, "%") && l.Format != "base64" {
+		if _, ok := envfile.Lookup(l.Format); !ok {
+			errorf("format", "unknown format '%s': use one of %s, or a format string like \"%%s=%%q\"", l.Format, strings.Join(envfile.Names(), ", "))
+		}
+	}
+	if l.FileMode != "" {
+		if _, err := strconv.ParseUint(l.FileMode, 8, 32); err != nil {
+			errorf("file_mode", "invalid file_mode '%s': must be an octal mode like \"0600\"", l.FileMode)
+		}
+	}
+
+	if len(l.Transform) > 0 {
+		if pipeline, err := transform.NewPipeline(l.Transform); err != nil {
+			errorf("transform", "invalid transform: %v", err)
+		} else if err := pipeline.CheckShape(); err != nil {
+			errorf("transform", "invalid transform: %v", err)
+		}
+	}
+	if explode >= 0 {
+		if l.LeaseType == "file" {
+			errorf("transform", "'explode' transform cannot be used with lease_type 'file'")
+		}
+		if l.Variable != "" {
+			warnf("variable", "variable is ignored when the secret is exploded")
+		}
+	}
+	return issues
+}
+
+// checkDestination reports what grant only rejects when it writes the lease:
+// an env file it has no format for, and a file outside the project root
+// unless destinationOutsideRoot is set. Load leaves these to grant, so the
+// leases of a config that has them can still be listed and revoked.
+func checkDestination(t leaseTarget, root string, destinationOutsideRoot bool) []Issue {
+	l := t.lease
+	if l.Destination == "" {
+		return nil
+	}
+	if l.LeaseType == "env" && l.Format == "" && envfile.DefaultFor(l.Destination) == "" {
+		return []Issue{t.issueAt(SeverityError, "destination", "lease for '%s' has no format specified: set format to one of %s", l.Destination, strings.Join(envfile.Names(), ", "))}
+	}
+	if l.LeaseType != "file" || destinationOutsideRoot {
+		return nil
+	}
+	inside, err := fileutil.IsPathInsideRoot(root, l.Destination)
+	if err != nil {
+		return []Issue{t.issueAt(SeverityError, "destination", "failed to validate destination path: %v", err)}
+	}
+	if !inside {
+		return []Issue{t.issueAt(SeverityError, "destination", "destination path '%s' is outside the project root. Use --destination-outside-root to override", l.Destination)}
+	}
+	return nil
+}
+
+// checkIdleTimeout returns an error if value is set and isn't a valid
+// idle_timeout.
+func checkIdleTimeout(value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := ParseIdleTimeout(value); err != nil {
+		return fmt.Errorf("invalid idle_timeout '%s': %w", value, err)
+	}
+	return nil
+}
+
+// checkDuplicates reports leases that write the same thing as an earlier
+// lease: the same file, or the same variable in the same file or shell.
+func checkDuplicates(leases []leaseTarget, root string) []Issue {
+	var issues []Issue
+	seen := make(map[string]leaseTarget)
+	for _, t := range leases {
+		l := t.lease
+		var target string
+		switch l.LeaseType {
+		case "file":
+			target = "file;" + leaseDestination(root, l.Destination)
+		case "env":
+			target = "env;" + leaseDestination(root, l.Destination) + ";" + l.Variable
+			if l.Variable == "" {
+				target += ";" + l.Source
+			}
+		case "shell":
+			target = "shell;" + l.Variable
+		default:
+			continue
+		}
+		first, ok := seen[target]
+		if !ok {
+			seen[target] = t
+			continue
+		}
+		where := fmt.Sprintf("%s:%d", first.file, first.pos.header.Line)
+		what := "variable"
+		if l.LeaseType == "file" {
+			what = "file"
+		}
+		if first.lease.Source == l.Source {
+			issues = append(issues, t.issueAt(SeverityError, "", "duplicate of the lease at %s", where))
+		} else {
+			issues = append(issues, t.issueAt(SeverityError, "", "writes the same %s as the lease at %s", what, where))
+		}
+	}
+	return issues
+}
+
+// leaseDestination returns the absolute path of a lease destination.
+func leaseDestination(root, destination string) string {
+	if filepath.IsAbs(destination) {
+		return filepath.Clean(destination)
+	}
+	return filepath.Join(root, destination)
+}
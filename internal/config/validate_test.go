@@ -0,0 +1,169 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	t.Run("reports every issue with its position", func(t *testing.T) {
+		content := `idle_timeout = "soon"
+
+[[lease]]
+source = "op://vault/item/secret"
+destination = ".envrc"
+variable = "API_KEY"
+duration = "1 hour"
+
+[[lease]]
+source = "op://vault/item/config"
+destination = ".env"
+variable = "IGNORED"
+duration = "1h"
+transform = [
+  "base64-decode",
+  "explode",
+]
+
+  [[lease]]
+  source = "op://vault/item/cert"
+  lease_type = "file"
+  destination = "../cert.pem"
+  duration = 60
+  file_mod = "0600"
+
+[[lease]]
+source = "op://vault/item/secret"
+destination = ".envrc"
+variable = "API_KEY"
+duration = "1h"
+format = "shell"
+transform = ["uppercase"]
+
+[[lease]]
+source = "op://vault/item/other"
+destination = "app.conf"
+variable = "OTHER"
+duration = "1h"
+
+[[lease]]
+source = "op://vault/item/other"
+variable = "OTHER"
+duration = "1h"
+lease_type = "environment"
+`
+		path := createTempConfig(t, content)
+		issues, err := Validate(path, "", false)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		type found struct {
+			line, column int
+			severity     Severity
+			key          string
+		}
+		var got []found
+		for _, issue := range issues {
+			if issue.File != path {
+				t.Errorf("expected file %s, got %s", path, issue.File)
+			}
+			got = append(got, found{issue.Line, issue.Column, issue.Severity, issue.Key})
+		}
+		expected := []found{
+			{1, 1, SeverityError, "idle_timeout"},
+			{7, 1, SeverityError, "lease[0].duration"},
+			{12, 1, SeverityWarning, "lease[1].variable"},
+			{14, 1, SeverityError, "lease[1].transform"},
+			{22, 3, SeverityError, "lease[2].destination"},
+			{23, 3, SeverityError, "lease[2].duration"},
+			{24, 3, SeverityWarning, "lease[2].file_mod"},
+			{26, 1, SeverityError, "lease[3]"},
+			{31, 1, SeverityError, "lease[3].format"},
+			{32, 1, SeverityError, "lease[3].transform"},
+			{36, 1, SeverityError, "lease[4].destination"},
+			{44, 1, SeverityError, "lease[5].lease_type"},
+		}
+		if !reflect.DeepEqual(got, expected) {
+			for _, issue := range issues {
+				t.Log(issue)
+			}
+			t.Fatalf("expected issues\n%v\ngot\n%v", expected, got)
+		}
+	})
+
+	t.Run("includes the local override", func(t *testing.T) {
+		path := createTempConfig(t, "[[lease]]\nsource = \"op://vault/item/secret\"\ndestination = \".envrc\"\nvariable = \"API_KEY\"\nduration = \"1h\"\n")
+		localPath := filepath.Join(filepath.Dir(path), "env-lease.local.toml")
+		if err := os.WriteFile(localPath, []byte("\n[[lease]]\nsource = \"op://vault/item/secret\"\ndestination = \".envrc\"\nvariable = \"API_KEY\"\nduration = \"1h\"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		issues, err := Validate(path, "", false)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(issues) != 1 {
+			t.Fatalf("expected 1 issue, got %v", issues)
+		}
+		expected := Issue{
+			File:     localPath,
+			Position: Position{Line: 2, Column: 1},
+			Severity: SeverityError,
+			Key:      "lease[0]",
+			Message:  "duplicate of the lease at " + path + ":1",
+		}
+		if issues[0] != expected {
+			t.Errorf("expected %+v, got %+v", expected, issues[0])
+		}
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		path := createTempConfig(t, "[[lease]]\nsource = \"op://vault/item/secret\ndestination = \".envrc\"\n")
+		issues, err := Validate(path, "", false)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(issues) != 1 || issues[0].Line != 2 || issues[0].Severity != SeverityError {
+			t.Fatalf("expected a syntax error on line 2, got %v", issues)
+		}
+	})
+
+	t.Run("valid config", func(t *testing.T) {
+		path := createTempConfig(t, "idle_timeout = \"10m\"\n[[lease]]\nsource = \"op://vault/item/config\"\ndestination = \".env\"\nduration = \"1h\"\ntransform = [\"json\", \"select 'app'\", \"explode(prefix=APP_)\"]\n")
+		issues, err := Validate(path, "", false)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(issues) != 0 {
+			t.Errorf("expected no issues, got %v", issues)
+		}
+	})
+
+	t.Run("destination outside root", func(t *testing.T) {
+		path := createTempConfig(t, "[[lease]]\nsource = \"op://vault/item/cert\"\nlease_type = \"file\"\ndestination = \"../cert.pem\"\nduration = \"1h\"\n")
+		issues, err := Validate(path, "", false)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(issues) != 1 || issues[0].Key != "lease[0].destination" {
+			t.Fatalf("expected a destination error, got %v", issues)
+		}
+
+		issues, err = Validate(path, "", true)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(issues) != 0 {
+			t.Errorf("expected no issues with destinationOutsideRoot, got %v", issues)
+		}
+	})
+
+	t.Run("missing config", func(t *testing.T) {
+		if _, err := Validate(filepath.Join(t.TempDir(), "env-lease.toml"), "", false); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+}
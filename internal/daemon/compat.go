@@ -0,0 +1,70 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/mblarsen/env-lease/internal/ipc"
+)
+
+// capabilities lists what the daemon supports, reported in the hello
+// response.
+var capabilities = []string{
+	ipc.CapabilityGrant,
+	ipc.CapabilityRevoke,
+	ipc.CapabilityRenew,
+	ipc.CapabilityStatus,
+	ipc.CapabilityCleanup,
+	ipc.CapabilityRetry,
+	ipc.CapabilitySubscribe,
+	ipc.CapabilityMetrics,
+	ipc.CapabilityShellLeases,
+}
+
+// deprecatedCommands maps commands that were renamed or replaced to the
+// command that now handles them. Old clients keep working while an entry is
+// present; remove it once ipc.MinProtocolVersion is raised past the version
+// that introduced the replacement. No command has been replaced yet; clients
+// on an unsupported protocol version are told so by the IPC server instead.
+var deprecatedCommands = map[string]string{}
+
+// upgradeCommand rewrites a request for a deprecated command into a request
+// for its replacement. Requests for current commands are returned unchanged.
+func upgradeCommand(command string, payload []byte) (string, []byte, error) {
+	replacement, ok := deprecatedCommands[command]
+	if !ok {
+		return command, payload, nil
+	}
+	slog.Warn("Client used a deprecated command", "command", command, "replacement", replacement)
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return "", nil, fmt.Errorf("failed to unmarshal command: %w", err)
+	}
+	fields["Command"], _ = json.Marshal(replacement)
+	upgraded, err := json.Marshal(fields)
+	if err != nil {
+		return "", nil, err
+	}
+	return replacement, upgraded, nil
+}
+
+func (d *Daemon) handleHello(payload []byte) ([]byte, error) {
+	var req ipc.HelloRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal hello request: %w", err)
+	}
+	slog.Debug("Received hello", "client_version", req.ClientVersion, "client_protocol", req.ProtocolVersion)
+
+	resp := ipc.HelloResponse{
+		ProtocolVersion:    ipc.ProtocolVersion,
+		MinProtocolVersion: ipc.MinProtocolVersion,
+		DaemonVersion:      ipc.BuildVersion(),
+		Capabilities:       capabilities,
+	}
+	if len(deprecatedCommands) > 0 {
+		resp.Deprecated = deprecatedCommands
+	}
+	return json.Marshal(resp)
+}
@@ -0,0 +1,52 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleIPC_Hello(t *testing.T) {
+	d := NewDaemon(NewState(), "/dev/null", &mockClock{now: time.Now()}, nil, &mockRevoker{}, nil)
+
+	payload, _ := json.Marshal(ipc.HelloRequest{Command: "hello", ProtocolVersion: ipc.ProtocolVersion})
+	respBytes, err := d.handleIPC(context.Background(), payload)
+	require.NoError(t, err)
+
+	var resp ipc.HelloResponse
+	require.NoError(t, json.Unmarshal(respBytes, &resp))
+	assert.Equal(t, ipc.ProtocolVersion, resp.ProtocolVersion)
+	assert.Equal(t, ipc.MinProtocolVersion, resp.MinProtocolVersion)
+	assert.True(t, resp.Supports(ipc.CapabilitySubscribe))
+}
+
+func TestHandleIPC_UnknownCommand(t *testing.T) {
+	d := NewDaemon(NewState(), "/dev/null", &mockClock{now: time.Now()}, nil, &mockRevoker{}, nil)
+
+	_, err := d.handleIPC(context.Background(), []byte(`{"Command":"frobnicate"}`))
+	var unknown *ipc.UnknownCommandError
+	require.True(t, errors.As(err, &unknown))
+	assert.Equal(t, "frobnicate", unknown.Command)
+}
+
+func TestHandleIPC_DeprecatedCommand(t *testing.T) {
+	deprecatedCommands["list"] = "status"
+	t.Cleanup(func() { delete(deprecatedCommands, "list") })
+
+	d := NewDaemon(NewState(), "/dev/null", &mockClock{now: time.Now()}, nil, &mockRevoker{}, nil)
+
+	respBytes, err := d.handleIPC(context.Background(), []byte(`{"Command":"list","ConfigFile":"/project/env-lease.toml"}`))
+	require.NoError(t, err)
+	var resp ipc.StatusResponse
+	require.NoError(t, json.Unmarshal(respBytes, &resp))
+
+	hello, err := d.handleHello([]byte(`{"Command":"hello"}`))
+	require.NoError(t, err)
+	assert.Contains(t, string(hello), `"list":"status"`)
+}
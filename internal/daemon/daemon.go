@@ -10,9 +10,10 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/mblarsen/env-lease/internal/audit"
 	"github.com/mblarsen/env-lease/internal/config"
-	"github.com/mblarsen/env-lease/internal/fileutil"
 	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/mblarsen/env-lease/internal/journal"
 )
 
 // Clock is an interface for time-related functions to allow for mocking.
@@ -36,23 +37,95 @@ func (c *RealClock) Ticker(d time.Duration) *time.Ticker {
 type Daemon struct {
 	state     *State
 	statePath string
+	store     *StateStore
 	clock     Clock
 	ipcServer *ipc.Server
 	revoker   Revoker
 	notifier  Notifier
 	mu        sync.Mutex
+
+	shutdownPolicy   string
+	shutdownDetector ShutdownDetector
+	sessionWatcher   SessionWatcher
+	sessionPolicy    string
+	idleSource       IdleSource
+	idleTimeout      time.Duration
+	idle             idleState
+	maxRetryAttempts int
+	jitter           func(time.Duration) time.Duration
+
+	auditLog       *audit.Log
+	events         *eventBus
+	warned         map[string]struct{}
+	configModTimes map[string]time.Time
+
+	metrics     *daemonMetrics
+	journal     *journal.Journal
+	promptCache string
 }
 
 // NewDaemon creates a new daemon.
 func NewDaemon(state *State, statePath string, clock Clock, ipcServer *ipc.Server, revoker Revoker, notifier Notifier) *Daemon {
-	return &Daemon{
+	d := &Daemon{
 		state:     normalizeState(state),
 		statePath: statePath,
+		store:     NewStateStore(statePath, config.StateEncryptionOff, nil),
 		clock:     clock,
 		ipcServer: ipcServer,
 		revoker:   revoker,
 		notifier:  notifier,
+
+		shutdownPolicy:   config.ShutdownPolicyRevoke,
+		sessionPolicy:    config.SessionRevokeMarked,
+		maxRetryAttempts: config.DefaultRetryMaxAttempts,
+		jitter:           equalJitter,
+
+		events:         newEventBus(),
+		warned:         make(map[string]struct{}),
+		configModTimes: make(map[string]time.Time),
+	}
+	d.metrics = newDaemonMetrics(d)
+	return d
+}
+
+// SetShutdownPolicy sets what happens to active leases when the daemon stops.
+// See the config.ShutdownPolicy* constants.
+func (d *Daemon) SetShutdownPolicy(policy string) {
+	d.shutdownPolicy = policy
+}
+
+// SetMaxRetryAttempts sets how many times a failed revocation is retried
+// before it is moved to the dead-letter list.
+func (d *Daemon) SetMaxRetryAttempts(attempts int) {
+	d.maxRetryAttempts = attempts
+}
+
+// SetAuditLog sets the log that lease lifecycle events are recorded in.
+func (d *Daemon) SetAuditLog(log *audit.Log) {
+	d.auditLog = log
+}
+
+// SetStateStore sets the store the state is persisted through, replacing the
+// plaintext store for the state path passed to NewDaemon.
+func (d *Daemon) SetStateStore(store *StateStore) {
+	d.store = store
+	d.statePath = store.Path()
+}
+
+// SetShutdownDetector sets the detector used by the revoke-on-logout-only
+// shutdown policy to tell a logout apart from a system shutdown.
+func (d *Daemon) SetShutdownDetector(detector ShutdownDetector) {
+	d.shutdownDetector = detector
+}
+
+// saveState persists the state through the daemon's store. The caller must
+// hold d.mu.
+func (d *Daemon) saveState() error {
+	if err := d.store.Save(d.state); err != nil {
+		return err
 	}
+	d.writePromptCache()
+	return nil
 }
 
 // Run starts the daemon's main loop.
@@ -62,8 +135,14 @@ func (d *Daemon) Run(ctx context.Context) error {
 	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
 	defer signal.Stop(sigs)
 
+	d.ipcServer.HandleStream(d.handleSubscribe)
 	go d.ipcServer.Listen(d.handleIPC)
 
+	d.mu.Lock()
+	d.writePromptCache()
+	d.mu.Unlock()
+
+	d.replayGrantJournal()
 	d.revokeExpiredLeases()
 	d.processRetryQueue()
 	d.cleanupOrphanedLeases()
@@ -74,6 +153,13 @@ func (d *Daemon) Run(ctx context.Context) error {
 	cleanupTicker := d.clock.Ticker(24 * time.Hour)
 	defer cleanupTicker.Stop()
 
+	journalTicker := d.clock.Ticker(journalReplayInterval)
+	defer journalTicker.Stop()
+
+	sessionEvents := d.sessionEvents()
+	idleTicks, stopIdleTicks := d.idleTicks()
+	defer stopIdleTicks()
+
 	lastCheckTime := d.clock.Now()
 	for {
 		slog.Debug("Daemon run loop tick")
@@ -90,11 +176,18 @@ func (d *Daemon) Run(ctx context.Context) error {
 
 		select {
 		case <-ticker.C:
+			d.warnExpiringLeases()
 			d.revokeExpiredLeases()
 			d.processRetryQueue()
 			d.revokeOrphanedLeases()
 		case <-cleanupTicker.C:
 			d.cleanupOrphanedLeases()
+		case <-journalTicker.C:
+			d.replayGrantJournal()
+		case ev := <-sessionEvents:
+			d.handleSessionEvent(ev)
+		case <-idleTicks:
+			d.checkIdle()
 		case sig := <-sigs:
 			slog.Info("Received shutdown signal, beginning graceful shutdown", "signal", sig)
 			return d.Shutdown()
@@ -121,6 +214,8 @@ func (d *Daemon) revokeOrphanedLeases() {
 
 	stateChanged := false
 	for configFile := range configFiles {
+		d.detectConfigChange(configFile)
+
 		// Load the current configuration from disk
 		resolvedConfigFile, err := config.ResolveConfigFile(configFile)
 		if err != nil {
@@ -140,8 +235,10 @@ func (d *Daemon) revokeOrphanedLeases() {
 				}
 				if err := d.revoker.Revoke(lease); err != nil {
 					slog.Error("Failed to revoke orphaned lease", "key", key, "err", err)
+					d.emit(ipc.EventRevokeFailed, lease, err.Error())
 				} else {
 					slog.Info("Revoked orphaned lease", "key", key)
+					d.emit(ipc.EventOrphaned, lease, "Config file is gone; lease was revoked.")
 					delete(d.state.Leases, key)
 					stateChanged = true
 				}
@@ -191,8 +288,10 @@ func (d *Daemon) revokeOrphanedLeases() {
 			}
 			if err := d.revoker.Revoke(activeLease); err != nil {
 				slog.Error("Failed to revoke orphaned lease", "key", key, "err", err)
+				d.emit(ipc.EventRevokeFailed, activeLease, err.Error())
 				// Optionally, add to a retry queue here as well
 			} else {
+				d.emit(ipc.EventOrphaned, activeLease, "Lease was removed from config and revoked.")
 				delete(d.state.Leases, key)
 				stateChanged = true
 			}
@@ -200,14 +299,39 @@ func (d *Daemon) revokeOrphanedLeases() {
 	}
 
 	if stateChanged {
-		if err := d.state.SaveState(d.statePath); err != nil {
+		if err := d.saveState(); err != nil {
 			slog.Error("Failed to save state after revoking orphaned leases", "err", err)
 		}
 	}
 	slog.Debug("Finished checking for orphaned leases.")
 }
 
+// revokeOnShutdown reports whether the configured shutdown policy requires
+// active leases to be revoked now.
+func (d *Daemon) revokeOnShutdown() bool {
+	switch d.shutdownPolicy {
+	case config.ShutdownPolicyPersist:
+		return false
+	case config.ShutdownPolicyRevokeOnLogout:
+		if d.shutdownDetector == nil {
+			slog.Warn("No shutdown detector available; revoking leases on shutdown")
+			return true
+		}
+		if d.shutdownDetector.SystemShuttingDown() {
+			slog.Info("System is shutting down; keeping leases for the next start")
+			return false
+		}
+		return true
+	default:
+		return true
+	}
+}
+
 func (d *Daemon) Shutdown() error {
+	if !d.revokeOnShutdown() {
+		return d.persistAndShutdown()
+	}
+
 	slog.Info("Starting graceful shutdown: revoking active leases and clearing state.")
 
 	if d.ipcServer != nil {
@@ -220,7 +344,7 @@ func (d *Daemon) Shutdown() error {
 	d.mu.Lock()
 
 	if d.statePath != "" {
-		if reloaded, err := LoadState(d.statePath); err != nil {
+		if reloaded, err := d.store.Load(); err != nil {
 			slog.Warn("Failed to reload state from disk during shutdown; continuing with in-memory state", "err", err)
 		} else {
 			d.state = reloaded
@@ -240,42 +364,27 @@ func (d *Daemon) Shutdown() error {
 		delete(d.state.Leases, key)
 	}
 
-	retryItems := d.state.RetryQueue
+	retryItems := append(d.state.RetryQueue, d.state.DeadLetters...)
 	d.state.RetryQueue = nil
+	d.state.DeadLetters = nil
 
 	d.mu.Unlock()
 
 	for _, lease := range leasesToRevoke {
-		if lease.LeaseType == "shell" {
-			slog.Debug("Skipping shell lease during shutdown", "source", lease.Source)
-			continue
-		}
-		if err := d.revoker.Revoke(lease); err != nil {
-			slog.Error("Failed to revoke lease during shutdown", "source", lease.Source, "destination", lease.Destination, "err", err)
-		} else {
-			slog.Info("Revoked lease during shutdown", "source", lease.Source, "destination", lease.Destination)
-		}
+		d.revokeForShutdown(lease)
 	}
-
 	for _, retry := range retryItems {
-		if retry.Lease == nil {
-			continue
-		}
-		if retry.Lease.LeaseType == "shell" {
-			slog.Debug("Skipping shell lease from retry queue during shutdown", "source", retry.Lease.Source)
-			continue
-		}
-		if err := d.revoker.Revoke(retry.Lease); err != nil {
-			slog.Error("Failed to revoke lease from retry queue during shutdown", "source", retry.Lease.Source, "destination", retry.Lease.Destination, "err", err)
-		} else {
-			slog.Info("Revoked lease from retry queue during shutdown", "source", retry.Lease.Source, "destination", retry.Lease.Destination)
+		if retry.Lease != nil {
+			d.revokeForShutdown(retry.Lease)
 		}
 	}
 
 	d.mu.Lock()
 	d.state.Leases = make(map[string]*config.Lease)
 	d.state.RetryQueue = nil
-	err := d.state.SaveState(d.statePath)
+	d.state.DeadLetters = nil
+	err := d.saveState()
+	d.removePromptCache()
 	d.mu.Unlock()
 
 	if err != nil {
@@ -294,6 +403,48 @@ func (d *Daemon) Shutdown() error {
 	return nil
 }
 
+// revokeForShutdown revokes lease and reports it like any other revocation.
+// Nothing is left to retry a failure, so it is only reported.
+func (d *Daemon) revokeForShutdown(lease *config.Lease) {
+	var err error
+	if lease.LeaseType != "shell" {
+		err = d.revoker.Revoke(lease)
+	}
+	if err != nil {
+		slog.Error("Failed to revoke lease during shutdown", "source", lease.Source, "destination", lease.Destination, "err", err)
+		d.emit(ipc.EventRevokeFailed, lease, err.Error())
+		return
+	}
+	slog.Info("Revoked lease during shutdown", "source", lease.Source, "destination", lease.Destination)
+	d.emit(ipc.EventRevoked, lease, "Revoked on shutdown.")
+}
+
+// persistAndShutdown stops the daemon without revoking anything. The state file
+// is kept so that the next start can pick up the leases and expire them on
+// time.
+func (d *Daemon) persistAndShutdown() error {
+	slog.Info("Starting graceful shutdown: persisting active leases.")
+
+	if d.ipcServer != nil {
+		if err := d.ipcServer.Close(); err != nil {
+			slog.Error("Failed to close IPC server during shutdown", "err", err)
+		}
+		d.ipcServer = nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.saveState()
+	d.removePromptCache()
+	if err != nil {
+		slog.Error("Failed to save state during shutdown", "err", err)
+		return nil
+	}
+	slog.Info("State persisted; shutdown complete.", "leases", len(d.state.Leases), "retry_queue", len(d.state.RetryQueue))
+	return nil
+}
+
 func (d *Daemon) cleanupOrphanedLeases() {
 	slog.Debug("Starting orphaned lease cleanup...")
 	d.mu.Lock()
@@ -316,6 +467,7 @@ func (d *Daemon) cleanupOrphanedLeases() {
 				lease.OrphanedSince = &now
 				d.state.Leases[id] = lease
 				stateChanged = true
+				d.emit(ipc.EventOrphaned, lease, "Config file no longer exists.")
 			}
 		} else {
 			// The file exists, so if it was marked as orphaned, un-mark it.
@@ -334,6 +486,9 @@ func (d *Daemon) cleanupOrphanedLeases() {
 			// Here we just delete it from the state.
 			if err := d.revoker.Revoke(lease); err != nil {
 				slog.Error("Failed to revoke purged lease", "id", id, "err", err)
+				d.emit(ipc.EventRevokeFailed, lease, err.Error())
+			} else {
+				d.emit(ipc.EventOrphaned, lease, "Purged lease orphaned for more than 30 days.")
 			}
 			delete(d.state.Leases, id)
 			stateChanged = true
@@ -341,7 +496,7 @@ func (d *Daemon) cleanupOrphanedLeases() {
 	}
 
 	if stateChanged {
-		if err := d.state.SaveState(d.statePath); err != nil {
+		if err := d.saveState(); err != nil {
 			slog.Error("Failed to save state after cleaning up orphaned leases", "err", err)
 		}
 	}
@@ -361,16 +516,20 @@ func (d *Daemon) revokeExpiredLeases() {
 				err = d.revoker.Revoke(lease)
 			}
 
+			delete(d.warned, id)
 			if err != nil {
 				slog.Error("Failed to revoke lease, adding to retry queue", "id", id, "err", err)
+				d.emit(ipc.EventRevokeFailed, lease, err.Error())
 				d.state.RetryQueue = append(d.state.RetryQueue, RetryItem{
 					Lease:          lease,
 					Attempts:       1,
-					NextRetryTime:  now.Add(2 * time.Second),
+					NextRetryTime:  now.Add(d.retryBackoff(1)),
 					InitialFailure: now,
+					LastError:      err.Error(),
 				})
 			} else {
 				slog.Info("Lease expired and was revoked", "id", id)
+				d.emit(ipc.EventExpired, lease, "")
 				if d.notifier != nil {
 					title := "Lease Expired"
 					message := fmt.Sprintf("Lease for %s has expired and was revoked.", lease.Source)
@@ -380,7 +539,7 @@ func (d *Daemon) revokeExpiredLeases() {
 				}
 			}
 			delete(d.state.Leases, id)
-			if err := d.state.SaveState(d.statePath); err != nil {
+			if err := d.saveState(); err != nil {
 				slog.Error("Failed to save state after lease expiration", "err", err)
 			}
 		}
@@ -388,45 +547,57 @@ func (d *Daemon) revokeExpiredLeases() {
 	slog.Debug("Finished checking for expired leases.")
 }
 
-func (d *Daemon) processRetryQueue() {
-	slog.Debug("Processing retry queue...")
-	d.mu.Lock()
-	defer d.mu.Unlock()
-
+// revokeMatching revokes every lease match selects, emitting message with
+// each revocation. Leases that fail to revoke go on the retry queue. It
+// returns the revoked leases; the caller must hold d.mu and save the state.
+func (d *Daemon) revokeMatching(match func(*config.Lease) bool, message string) (revoked []*config.Lease, failed int) {
 	now := d.clock.Now()
-	stateChanged := false
-	for i := len(d.state.RetryQueue) - 1; i >= 0; i-- {
-		item := d.state.RetryQueue[i]
-		if now.After(item.NextRetryTime) {
-			var err error
-			if item.Lease.LeaseType != "shell" {
-				err = d.revoker.Revoke(item.Lease)
-			}
-
-			if err != nil {
-				item.Attempts++
-				item.NextRetryTime = now.Add(time.Duration(item.Attempts*2) * time.Second) // Exponential backoff
-				d.state.RetryQueue[i] = item
-				stateChanged = true
+	for id, lease := range d.state.Leases {
+		if !match(lease) {
+			continue
+		}
+		var err error
+		if lease.LeaseType != "shell" {
+			err = d.revoker.Revoke(lease)
+		}
 
-				// Create failure file if necessary
-				if now.Sub(item.InitialFailure) > 5*time.Minute {
-					failureFile := item.Lease.Destination + ".env-lease-REVOCATION-FAILURE"
-					content := fmt.Sprintf("Failed to revoke lease for %s at %s", item.Lease.Source, now.Format(time.RFC3339))
-					fileutil.AtomicWriteFile(failureFile, []byte(content), 0644)
-				}
-			} else {
-				// Success, remove from queue
-				d.state.RetryQueue = append(d.state.RetryQueue[:i], d.state.RetryQueue[i+1:]...)
-				stateChanged = true
-			}
+		delete(d.warned, id)
+		delete(d.state.Leases, id)
+		if err != nil {
+			slog.Error("Failed to revoke lease, adding to retry queue", "id", id, "err", err)
+			d.emit(ipc.EventRevokeFailed, lease, err.Error())
+			d.state.RetryQueue = append(d.state.RetryQueue, RetryItem{
+				Lease:          lease,
+				Attempts:       1,
+				NextRetryTime:  now.Add(d.retryBackoff(1)),
+				InitialFailure: now,
+				LastError:      err.Error(),
+			})
+			failed++
+			continue
 		}
+		revoked = append(revoked, lease)
+		d.emit(ipc.EventRevoked, lease, message)
 	}
+	return revoked, failed
+}
 
-	if stateChanged {
-		if err := d.state.SaveState(d.statePath); err != nil {
-			slog.Error("Failed to save state after processing retry queue", "err", err)
-		}
+// detectConfigChange sends a config-changed event when a tracked config file
+// was modified since the last check.
+func (d *Daemon) detectConfigChange(configFile string) {
+	info, err := os.Stat(configFile)
+	if err != nil {
+		delete(d.configModTimes, configFile)
+		return
+	}
+	previous, seen := d.configModTimes[configFile]
+	d.configModTimes[configFile] = info.ModTime()
+	if seen && !previous.Equal(info.ModTime()) {
+		slog.Debug("Config file changed", "config", configFile)
+		d.events.publish(ipc.Event{
+			Type:       ipc.EventConfigChanged,
+			Time:       d.clock.Now(),
+			ConfigFile: configFile,
+		})
 	}
-	slog.Debug("Finished processing retry queue.")
 }
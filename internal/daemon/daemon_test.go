@@ -419,6 +419,65 @@ func TestDaemon_ShutdownRevokesLeasesAndClearsState(t *testing.T) {
 	assert.NotContains(t, string(envContent), "value", "env variable should be cleared during shutdown")
 }
 
+type fakeShutdownDetector struct {
+	shuttingDown bool
+}
+
+func (f *fakeShutdownDetector) SystemShuttingDown() bool {
+	return f.shuttingDown
+}
+
+func TestDaemon_ShutdownPolicies(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		detector    ShutdownDetector
+		wantRevoked bool
+	}{
+		{name: "revoke", policy: config.ShutdownPolicyRevoke, wantRevoked: true},
+		{name: "persist", policy: config.ShutdownPolicyPersist, wantRevoked: false},
+		{name: "logout", policy: config.ShutdownPolicyRevokeOnLogout, detector: &fakeShutdownDetector{}, wantRevoked: true},
+		{name: "reboot", policy: config.ShutdownPolicyRevokeOnLogout, detector: &fakeShutdownDetector{shuttingDown: true}, wantRevoked: false},
+		{name: "logout without detector", policy: config.ShutdownPolicyRevokeOnLogout, wantRevoked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statePath := filepath.Join(t.TempDir(), "state.json")
+			state := NewState()
+			state.Leases["env"] = &config.Lease{
+				Source:      "onepassword://vault/item/env",
+				Destination: "/tmp/env",
+				LeaseType:   "env",
+				Variable:    "ENV_VAR",
+				ExpiresAt:   time.Now().Add(time.Hour),
+			}
+			require.NoError(t, state.SaveState(statePath))
+
+			revoker := &mockRevoker{}
+			d := NewDaemon(state, statePath, &mockClock{now: time.Now()}, nil, revoker, nil)
+			d.SetShutdownPolicy(tt.policy)
+			if tt.detector != nil {
+				d.SetShutdownDetector(tt.detector)
+			}
+
+			require.NoError(t, d.Shutdown())
+
+			if tt.wantRevoked {
+				assert.Equal(t, 1, revoker.RevokeCount)
+				_, err := os.Stat(statePath)
+				assert.True(t, os.IsNotExist(err), "state file should be removed")
+				return
+			}
+
+			assert.Equal(t, 0, revoker.RevokeCount)
+			reloaded, err := LoadState(statePath)
+			require.NoError(t, err)
+			assert.Contains(t, reloaded.Leases, "env", "lease should survive shutdown")
+		})
+	}
+}
+
 func TestDaemon_processRetryQueue_PersistsBackoffUpdate(t *testing.T) {
 	tempDir := t.TempDir()
 	statePath := filepath.Join(tempDir, "state.json")
@@ -443,6 +502,7 @@ func TestDaemon_processRetryQueue_PersistsBackoffUpdate(t *testing.T) {
 		return fmt.Errorf("revoke failed")
 	}}
 	d := NewDaemon(state, statePath, &mockClock{now: now}, nil, revoker, nil)
+	d.jitter = func(delay time.Duration) time.Duration { return delay }
 
 	d.processRetryQueue()
 
@@ -0,0 +1,160 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/audit"
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/ipc"
+)
+
+// expiryWarningThreshold is how long before expiry a warning event is sent.
+const expiryWarningThreshold = 5 * time.Minute
+
+// subscriberBuffer is the number of events buffered per subscriber. A
+// subscriber that falls further behind misses events rather than blocking the
+// daemon.
+const subscriberBuffer = 64
+
+// eventBus fans events out to subscribers.
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[chan ipc.Event]struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[chan ipc.Event]struct{})}
+}
+
+func (b *eventBus) subscribe() chan ipc.Event {
+	ch := make(chan ipc.Event, subscriberBuffer)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *eventBus) unsubscribe(ch chan ipc.Event) {
+	b.mu.Lock()
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+}
+
+func (b *eventBus) publish(event ipc.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			slog.Warn("Event subscriber is too slow; dropping event", "type", event.Type)
+		}
+	}
+}
+
+// emit publishes an event about a lease that the daemon changed on its own.
+func (d *Daemon) emit(eventType string, lease *config.Lease, message string) {
+	d.emitFor(context.Background(), eventType, lease, message)
+}
+
+// emitFor publishes an event about a lease changed on behalf of the IPC peer
+// in ctx, and records it in the audit log.
+func (d *Daemon) emitFor(ctx context.Context, eventType string, lease *config.Lease, message string) {
+	event := ipc.Event{
+		Type:    eventType,
+		Time:    d.clock.Now(),
+		Message: message,
+	}
+	if lease != nil {
+		expiresAt := lease.ExpiresAt
+		event.Source = lease.Source
+		event.Destination = lease.Destination
+		event.Variable = lease.Variable
+		event.LeaseType = lease.LeaseType
+		event.ConfigFile = lease.ConfigFile
+		event.ExpiresAt = &expiresAt
+	}
+	d.events.publish(event)
+	d.metrics.observeEvent(eventType, lease)
+
+	if d.auditLog != nil && eventType != ipc.EventWarning {
+		entry := audit.Entry{
+			Time:    event.Time,
+			Action:  eventType,
+			Message: message,
+		}
+		if lease != nil {
+			entry.ConfigFile = lease.ConfigFile
+			entry.Source = lease.Source
+			entry.Destination = lease.Destination
+			entry.Variable = lease.Variable
+			entry.LeaseType = lease.LeaseType
+		}
+		if peer, ok := ipc.PeerFromContext(ctx); ok && peer.PID > 0 {
+			entry.ActorPID = peer.PID
+		}
+		if err := d.auditLog.Write(entry); err != nil {
+			slog.Error("Failed to write audit log entry", "err", err)
+		}
+	}
+}
+
+// warnExpiringLeases sends a warning event once for every lease that is about
+// to expire.
+func (d *Daemon) warnExpiringLeases() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now()
+	for id, lease := range d.state.Leases {
+		if lease.ExpiresAt.Sub(now) > expiryWarningThreshold {
+			delete(d.warned, id)
+			continue
+		}
+		if _, ok := d.warned[id]; ok || now.After(lease.ExpiresAt) {
+			continue
+		}
+		d.warned[id] = struct{}{}
+		remaining := lease.ExpiresAt.Sub(now).Round(time.Second)
+		d.emit(ipc.EventWarning, lease, fmt.Sprintf("Lease expires in %s.", remaining))
+	}
+}
+
+func (d *Daemon) handleSubscribe(ctx context.Context, payload []byte, send func([]byte) error) error {
+	var req ipc.SubscribeRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return fmt.Errorf("failed to unmarshal subscribe request: %w", err)
+	}
+	if req.Command != "subscribe" {
+		return fmt.Errorf("command %s cannot be streamed", req.Command)
+	}
+	slog.Debug("Received subscribe request", "config_file", req.ConfigFile)
+
+	ch := d.events.subscribe()
+	defer d.events.unsubscribe(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Debug("Subscriber disconnected")
+			return nil
+		case event := <-ch:
+			if req.ConfigFile != "" && event.ConfigFile != req.ConfigFile {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return fmt.Errorf("failed to marshal event: %w", err)
+			}
+			if err := send(data); err != nil {
+				slog.Debug("Failed to send event; closing subscription", "err", err)
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/audit"
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receiveEvents(ch chan ipc.Event) []ipc.Event {
+	var events []ipc.Event
+	for {
+		select {
+		case e := <-ch:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestHandleGrant_EmitsGrantedThenRenewed(t *testing.T) {
+	clock := &mockClock{now: time.Now()}
+	d := NewDaemon(NewState(), "/dev/null", clock, nil, &mockRevoker{}, &mockNotifier{})
+	ch := d.events.subscribe()
+	defer d.events.unsubscribe(ch)
+
+	req := ipc.GrantRequest{
+		Command:    "grant",
+		ConfigFile: "/project/env-lease.toml",
+		Leases: []ipc.Lease{
+			{Source: "op://vault/item/field", Destination: "/project/.envrc", LeaseType: "env", Variable: "API_KEY", Duration: "1h"},
+		},
+	}
+	payload, _ := json.Marshal(req)
+
+	_, err := d.handleGrant(context.Background(), payload)
+	require.NoError(t, err)
+	_, err = d.handleGrant(context.Background(), payload)
+	require.NoError(t, err)
+
+	events := receiveEvents(ch)
+	require.Len(t, events, 2)
+	assert.Equal(t, ipc.EventGranted, events[0].Type)
+	assert.Equal(t, ipc.EventRenewed, events[1].Type)
+	assert.Equal(t, "API_KEY", events[1].Variable)
+	assert.Equal(t, "/project/env-lease.toml", events[1].ConfigFile)
+}
+
+func TestDaemon_warnExpiringLeases_WarnsOnce(t *testing.T) {
+	clock := &mockClock{now: time.Now()}
+	state := NewState()
+	state.Leases["soon"] = &config.Lease{Source: "soon", ExpiresAt: clock.now.Add(2 * time.Minute)}
+	state.Leases["later"] = &config.Lease{Source: "later", ExpiresAt: clock.now.Add(time.Hour)}
+	d := NewDaemon(state, "/dev/null", clock, nil, &mockRevoker{}, nil)
+	ch := d.events.subscribe()
+	defer d.events.unsubscribe(ch)
+
+	d.warnExpiringLeases()
+	d.warnExpiringLeases()
+
+	events := receiveEvents(ch)
+	require.Len(t, events, 1)
+	assert.Equal(t, ipc.EventWarning, events[0].Type)
+	assert.Equal(t, "soon", events[0].Source)
+}
+
+func TestDaemon_revokeExpiredLeases_EmitsRevokeFailed(t *testing.T) {
+	clock := &mockClock{now: time.Now()}
+	state := NewState()
+	state.Leases["expired"] = &config.Lease{Source: "expired", LeaseType: "env", ExpiresAt: clock.now.Add(-time.Minute)}
+	revoker := &mockRevoker{RevokeFunc: func(*config.Lease) error { return assert.AnError }}
+	d := NewDaemon(state, "/dev/null", clock, nil, revoker, nil)
+	ch := d.events.subscribe()
+	defer d.events.unsubscribe(ch)
+
+	d.revokeExpiredLeases()
+
+	events := receiveEvents(ch)
+	require.Len(t, events, 1)
+	assert.Equal(t, ipc.EventRevokeFailed, events[0].Type)
+}
+
+func TestHandleGrant_WritesAuditLogWithActor(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := audit.Open(auditPath, audit.DefaultMaxSize, audit.DefaultMaxBackups)
+	require.NoError(t, err)
+	defer auditLog.Close()
+
+	d := NewDaemon(NewState(), "/dev/null", &mockClock{now: time.Now()}, nil, &mockRevoker{}, &mockNotifier{})
+	d.SetAuditLog(auditLog)
+
+	req := ipc.GrantRequest{
+		Command:    "grant",
+		ConfigFile: "/project/env-lease.toml",
+		Leases: []ipc.Lease{
+			{Source: "op://vault/item/field", Destination: "/project/.envrc", LeaseType: "env", Variable: "API_KEY", Duration: "1h"},
+		},
+	}
+	payload, _ := json.Marshal(req)
+	ctx := ipc.ContextWithPeer(context.Background(), ipc.Peer{PID: 4242, UID: 1000})
+
+	_, err = d.handleGrant(ctx, payload)
+	require.NoError(t, err)
+
+	entries, err := audit.Read(auditPath, audit.DefaultMaxBackups, audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, ipc.EventGranted, entries[0].Action)
+	assert.Equal(t, 4242, entries[0].ActorPID)
+	assert.Equal(t, "API_KEY", entries[0].Variable)
+	assert.Equal(t, "/project/env-lease.toml", entries[0].ConfigFile)
+}
+
+func TestDaemon_Shutdown_AuditsRevocations(t *testing.T) {
+	dir := t.TempDir()
+	auditPath := filepath.Join(dir, "audit.log")
+	auditLog, err := audit.Open(auditPath, audit.DefaultMaxSize, audit.DefaultMaxBackups)
+	require.NoError(t, err)
+	defer auditLog.Close()
+
+	state := NewState()
+	state.Leases["env"] = &config.Lease{Source: "op://vault/item/env", LeaseType: "env", Variable: "API_KEY"}
+	state.RetryQueue = []RetryItem{{Lease: &config.Lease{Source: "op://vault/item/retry", LeaseType: "file"}}}
+	revoker := &mockRevoker{RevokeFunc: func(lease *config.Lease) error {
+		if lease.LeaseType == "file" {
+			return assert.AnError
+		}
+		return nil
+	}}
+	statePath := filepath.Join(dir, "state.json")
+	require.NoError(t, state.SaveState(statePath))
+	d := NewDaemon(state, statePath, &mockClock{now: time.Now()}, nil, revoker, nil)
+	d.SetAuditLog(auditLog)
+
+	require.NoError(t, d.Shutdown())
+
+	entries, err := audit.Read(auditPath, audit.DefaultMaxBackups, audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, ipc.EventRevoked, entries[0].Action)
+	assert.Equal(t, "Revoked on shutdown.", entries[0].Message)
+	assert.Equal(t, "API_KEY", entries[0].Variable)
+	assert.Equal(t, ipc.EventRevokeFailed, entries[1].Action)
+	assert.Equal(t, "op://vault/item/retry", entries[1].Source)
+}
@@ -1,16 +1,18 @@
 package daemon
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/mblarsen/env-lease/internal/config"
 	"github.com/mblarsen/env-lease/internal/ipc"
 )
 
-func (d *Daemon) handleIPC(payload []byte) ([]byte, error) {
+func (d *Daemon) handleIPC(ctx context.Context, payload []byte) ([]byte, error) {
 	var req struct {
 		Command string
 	}
@@ -18,24 +20,72 @@ func (d *Daemon) handleIPC(payload []byte) ([]byte, error) {
 		return nil, fmt.Errorf("failed to unmarshal command: %w", err)
 	}
 
-	switch req.Command {
+	start := time.Now()
+	defer func() { d.metrics.observeIPC(req.Command, time.Since(start)) }()
+
+	command, payload, err := upgradeCommand(req.Command, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch command {
+	case "hello":
+		return d.handleHello(payload)
 	case "grant":
-		d.mu.Lock()
+		if err := d.lockFor(ctx); err != nil {
+			return nil, err
+		}
 		defer d.mu.Unlock()
-		return d.handleGrant(payload)
+		return d.handleGrant(ctx, payload)
 	case "revoke":
-		d.mu.Lock()
+		if err := d.lockFor(ctx); err != nil {
+			return nil, err
+		}
 		defer d.mu.Unlock()
-		return d.handleRevoke(payload)
+		return d.handleRevoke(ctx, payload)
+	case "renew":
+		if err := d.lockFor(ctx); err != nil {
+			return nil, err
+		}
+		defer d.mu.Unlock()
+		return d.handleRenew(ctx, payload)
 	case "status":
-		d.mu.Lock()
+		if err := d.lockFor(ctx); err != nil {
+			return nil, err
+		}
 		defer d.mu.Unlock()
 		return d.handleStatus(payload)
+	case "shell-leases":
+		if err := d.lockFor(ctx); err != nil {
+			return nil, err
+		}
+		defer d.mu.Unlock()
+		return d.handleShellLeases(payload)
 	case "cleanup":
 		return d.handleCleanup(payload)
+	case "retry":
+		if err := d.lockFor(ctx); err != nil {
+			return nil, err
+		}
+		defer d.mu.Unlock()
+		return d.handleRetry(ctx, payload)
+	case "subscribe":
+		return nil, fmt.Errorf("subscribe must be sent as a streaming request")
 	default:
-		return nil, fmt.Errorf("unknown command: %s", req.Command)
+		return nil, &ipc.UnknownCommandError{Command: command}
+	}
+}
+
+// lockFor acquires the daemon lock for a request. If the request's context
+// ended while it waited, for example because the client gave up, the lock is
+// released and the request is abandoned before it changes anything.
+func (d *Daemon) lockFor(ctx context.Context) error {
+	d.mu.Lock()
+	if err := ctx.Err(); err != nil {
+		d.mu.Unlock()
+		return fmt.Errorf("request abandoned: %w", err)
 	}
+	return nil
 }
 
 func (d *Daemon) handleCleanup(payload []byte) ([]byte, error) {
@@ -50,12 +100,38 @@ func (d *Daemon) handleCleanup(payload []byte) ([]byte, error) {
 	return json.Marshal(resp)
 }
 
-func (d *Daemon) handleGrant(payload []byte) ([]byte, error) {
+// leaseFromIPC converts a lease from a grant request into the form kept in
+// the daemon state.
+func leaseFromIPC(l ipc.Lease, configFile string, expiresAt time.Time) *config.Lease {
+	lease := &config.Lease{
+		Source:       l.Source,
+		Destination:  l.Destination,
+		Duration:     l.Duration,
+		LeaseType:    l.LeaseType,
+		Variable:     l.Variable,
+		Format:       l.Format,
+		Transform:    l.Transform,
+		FileMode:     l.FileMode,
+		OpAccount:    l.OpAccount,
+		ExpiresAt:    expiresAt,
+		ConfigFile:   configFile,
+		ParentSource: l.ParentSource,
+		RevokeOnLock: l.RevokeOnLock,
+		IdleTimeout:  l.IdleTimeout,
+	}
+	if l.ShellSession != "" {
+		lease.ShellSessions = []string{l.ShellSession}
+	}
+	return lease
+}
+
+func (d *Daemon) handleGrant(ctx context.Context, payload []byte) ([]byte, error) {
 	var req ipc.GrantRequest
 	if err := json.Unmarshal(payload, &req); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal grant request: %w", err)
 	}
 	slog.Debug("Received grant request", "leases", len(req.Leases))
+	d.metrics.observeFetches(req.Fetches)
 
 	if !req.Append {
 		// Revoke any leases that are in the state but not in the request.
@@ -72,7 +148,10 @@ func (d *Daemon) handleGrant(payload []byte) ([]byte, error) {
 				slog.Info("Revoking lease removed from config", "key", key)
 				if err := d.revoker.Revoke(activeLease); err != nil {
 					slog.Error("Failed to revoke lease removed from config", "key", key, "err", err)
+					d.emitFor(ctx, ipc.EventRevokeFailed, activeLease, err.Error())
 					// Continue trying to revoke other leases
+				} else {
+					d.emitFor(ctx, ipc.EventRevoked, activeLease, "Lease was removed from config.")
 				}
 				delete(d.state.Leases, key)
 			}
@@ -88,26 +167,28 @@ func (d *Daemon) handleGrant(payload []byte) ([]byte, error) {
 		}
 
 		key := leaseIdentity(l.Source, l.Destination, l.Variable)
-		lease := &config.Lease{
-			Source:        l.Source,
-			Destination:   l.Destination,
-			Duration:      l.Duration,
-			LeaseType:     l.LeaseType,
-			Variable:      l.Variable,
-			Format:        l.Format,
-			Transform:     l.Transform,
-			FileMode:      l.FileMode,
-			OpAccount:     l.OpAccount,
-			ExpiresAt:     d.clock.Now().Add(duration),
-			OrphanedSince: nil,
-			ConfigFile:    req.ConfigFile,
-			ParentSource:  l.ParentSource,
+		lease := leaseFromIPC(l, req.ConfigFile, d.clock.Now().Add(duration))
+		lease.GrantedAt = d.clock.Now()
+		previous, renewed := d.state.Leases[key]
+		if renewed && lease.LeaseType == "shell" {
+			// Every shell that was given the variable still holds it.
+			for _, session := range previous.ShellSessions {
+				if !slices.Contains(lease.ShellSessions, session) {
+					lease.ShellSessions = append(lease.ShellSessions, session)
+				}
+			}
 		}
 		d.state.Leases[key] = lease
+		delete(d.warned, key)
 		slog.Debug("Adding lease to state", "source", lease.Source, "expires_at", lease.ExpiresAt)
+		if renewed {
+			d.emitFor(ctx, ipc.EventRenewed, lease, "")
+		} else {
+			d.emitFor(ctx, ipc.EventGranted, lease, "")
+		}
 	}
 
-	if err := d.state.SaveState(d.statePath); err != nil {
+	if err := d.saveState(); err != nil {
 		slog.Error("Failed to save state after grant", "err", err)
 		// Do not return error to client, as the grant itself succeeded
 	}
@@ -123,7 +204,7 @@ func (d *Daemon) handleGrant(payload []byte) ([]byte, error) {
 	return json.Marshal(resp)
 }
 
-func (d *Daemon) handleRevoke(payload []byte) ([]byte, error) {
+func (d *Daemon) handleRevoke(ctx context.Context, payload []byte) ([]byte, error) {
 	var req ipc.RevokeRequest
 	if err := json.Unmarshal(payload, &req); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal revoke request: %w", err)
@@ -131,7 +212,7 @@ func (d *Daemon) handleRevoke(payload []byte) ([]byte, error) {
 	slog.Debug("Received revoke request", "config_file", req.ConfigFile, "all", req.All)
 
 	var count int
-	var shellCommands []string
+	var shellVariables []string
 
 	if len(req.Leases) > 0 {
 		for _, l := range req.Leases {
@@ -140,13 +221,17 @@ func (d *Daemon) handleRevoke(payload []byte) ([]byte, error) {
 				slog.Debug("Revoking lease", "source", lease.Source)
 				if lease.LeaseType == "shell" {
 					if lease.Variable != "" {
-						shellCommands = append(shellCommands, fmt.Sprintf("unset %s", lease.Variable))
+						shellVariables = append(shellVariables, lease.Variable)
 					}
 					slog.Debug("Ignoring revoker for shell lease type", "id", id)
+					d.emitFor(ctx, ipc.EventRevoked, lease, "")
 				} else {
 					if err := d.revoker.Revoke(lease); err != nil {
 						slog.Error("Failed to revoke lease", "id", id, "err", err)
+						d.emitFor(ctx, ipc.EventRevokeFailed, lease, err.Error())
 						// Continue trying to revoke other leases
+					} else {
+						d.emitFor(ctx, ipc.EventRevoked, lease, "")
 					}
 				}
 				delete(d.state.Leases, id)
@@ -161,13 +246,17 @@ func (d *Daemon) handleRevoke(payload []byte) ([]byte, error) {
 				slog.Debug("Revoking lease", "source", lease.Source)
 				if lease.LeaseType == "shell" {
 					if lease.Variable != "" {
-						shellCommands = append(shellCommands, fmt.Sprintf("unset %s", lease.Variable))
+						shellVariables = append(shellVariables, lease.Variable)
 					}
 					slog.Debug("Ignoring revoker for shell lease type", "id", id)
+					d.emitFor(ctx, ipc.EventRevoked, lease, "")
 				} else {
 					if err := d.revoker.Revoke(lease); err != nil {
 						slog.Error("Failed to revoke lease", "id", id, "err", err)
+						d.emitFor(ctx, ipc.EventRevokeFailed, lease, err.Error())
 						// Continue trying to revoke other leases
+					} else {
+						d.emitFor(ctx, ipc.EventRevoked, lease, "")
 					}
 				}
 				delete(d.state.Leases, id)
@@ -178,23 +267,93 @@ func (d *Daemon) handleRevoke(payload []byte) ([]byte, error) {
 		}
 	}
 
-	if err := d.state.SaveState(d.statePath); err != nil {
+	if err := d.saveState(); err != nil {
 		slog.Error("Failed to save state after revoke", "err", err)
 	}
 
-	if req.All && count > 0 {
-		title := "Leases Revoked"
-		message := fmt.Sprintf("Revoked %d leases due to system idle.", count)
-		if err := d.notifier.Notify(title, message); err != nil {
-			slog.Error("Failed to send notification", "err", err)
+	slog.Info("Revoked leases", "count", count, "all", req.All, "project", req.ConfigFile)
+	resp := ipc.RevokeResponse{
+		Messages:       []string{fmt.Sprintf("Revoked %d leases.", count)},
+		ShellVariables: shellVariables,
+	}
+	for _, v := range shellVariables {
+		resp.ShellCommands = append(resp.ShellCommands, "unset "+v)
+	}
+	return json.Marshal(resp)
+}
+
+func (d *Daemon) handleShellLeases(payload []byte) ([]byte, error) {
+	var req ipc.ShellLeasesRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal shell-leases request: %w", err)
+	}
+
+	now := d.clock.Now()
+	resp := ipc.ShellLeasesResponse{Variables: []string{}}
+	for _, lease := range d.state.Leases {
+		if lease.LeaseType == "shell" && lease.Variable != "" && now.Before(lease.ExpiresAt) && slices.Contains(lease.ShellSessions, req.Session) {
+			resp.Variables = append(resp.Variables, lease.Variable)
 		}
 	}
+	slices.Sort(resp.Variables)
+	return json.Marshal(resp)
+}
 
-	slog.Info("Revoked leases", "count", count, "all", req.All, "project", req.ConfigFile)
-	resp := ipc.RevokeResponse{
-		Messages:      []string{fmt.Sprintf("Revoked %d leases.", count)},
-		ShellCommands: shellCommands,
+func (d *Daemon) handleRenew(ctx context.Context, payload []byte) ([]byte, error) {
+	var req ipc.RenewRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal renew request: %w", err)
+	}
+	slog.Debug("Received renew request", "config_file", req.ConfigFile, "all", req.All, "leases", len(req.Leases))
+
+	var override time.Duration
+	if req.Duration != "" {
+		var err error
+		override, err = time.ParseDuration(req.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration '%s': %w", req.Duration, err)
+		}
+	}
+
+	selected := make(map[string]*config.Lease)
+	if len(req.Leases) > 0 {
+		for _, l := range req.Leases {
+			id := leaseIdentity(l.Source, l.Destination, l.Variable)
+			if lease, ok := d.state.Leases[id]; ok {
+				selected[id] = lease
+			}
+		}
+	} else {
+		for id, lease := range d.state.Leases {
+			if req.All || lease.ConfigFile == req.ConfigFile {
+				selected[id] = lease
+			}
+		}
+	}
+
+	resp := ipc.RenewResponse{}
+	for id, lease := range selected {
+		duration := override
+		if duration == 0 {
+			var err error
+			duration, err = time.ParseDuration(lease.Duration)
+			if err != nil {
+				return nil, fmt.Errorf("invalid duration '%s': %w", lease.Duration, err)
+			}
+		}
+		lease.ExpiresAt = d.clock.Now().Add(duration)
+		lease.GrantedAt = d.clock.Now()
+		delete(d.warned, id)
+		d.emitFor(ctx, ipc.EventRenewed, lease, "")
+		resp.Leases = append(resp.Leases, leaseToIPC(lease))
+	}
+
+	if err := d.saveState(); err != nil {
+		slog.Error("Failed to save state after renew", "err", err)
 	}
+
+	slog.Info("Renewed leases", "count", len(selected))
+	resp.Messages = []string{fmt.Sprintf("Renewed %d leases.", len(selected))}
 	return json.Marshal(resp)
 }
 
@@ -207,17 +366,13 @@ func (d *Daemon) handleStatus(payload []byte) ([]byte, error) {
 	var leases []ipc.Lease
 	for _, l := range d.state.Leases {
 		if req.ConfigFile == "" || l.ConfigFile == req.ConfigFile {
-			leases = append(leases, ipc.Lease{
-				Source:       l.Source,
-				Destination:  l.Destination,
-				LeaseType:    l.LeaseType,
-				Variable:     l.Variable,
-				ExpiresAt:    l.ExpiresAt,
-				ConfigFile:   l.ConfigFile,
-				ParentSource: l.ParentSource,
-			})
-		}
-	}
-	resp := ipc.StatusResponse{Leases: leases}
+			leases = append(leases, leaseToIPC(l))
+		}
+	}
+	resp := ipc.StatusResponse{
+		Leases: leases,
+		Failed: d.failedRevocations(req.ConfigFile, req.ConfigFile == ""),
+		Idle:   d.idleStatus(),
+	}
 	return json.Marshal(resp)
 }
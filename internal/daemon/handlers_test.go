@@ -1,6 +1,7 @@
 package daemon
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 	"time"
@@ -28,7 +29,7 @@ func TestHandleGrant(t *testing.T) {
 	}
 	payload, _ := json.Marshal(req)
 
-	_, err := daemon.handleGrant(payload)
+	_, err := daemon.handleGrant(context.Background(), payload)
 	if err != nil {
 		t.Fatalf("handleGrant failed: %v", err)
 	}
@@ -72,7 +73,7 @@ func TestHandleGrant_RevokesRemovedLeases(t *testing.T) {
 		ConfigFile: "/tmp/env-lease.toml",
 	}
 	payload, _ := json.Marshal(req)
-	_, err := daemon.handleGrant(payload)
+	_, err := daemon.handleGrant(context.Background(), payload)
 	if err != nil {
 		t.Fatalf("handleGrant failed: %v", err)
 	}
@@ -84,7 +85,7 @@ func TestHandleGrant_RevokesRemovedLeases(t *testing.T) {
 		ConfigFile: "/tmp/env-lease.toml",
 	}
 	payload, _ = json.Marshal(req)
-	_, err = daemon.handleGrant(payload)
+	_, err = daemon.handleGrant(context.Background(), payload)
 	if err != nil {
 		t.Fatalf("handleGrant failed: %v", err)
 	}
@@ -135,7 +136,7 @@ func TestHandleGrant_AppendDoesNotRevokeRemovedLeases(t *testing.T) {
 		ConfigFile: "/tmp/env-lease.toml",
 	}
 	payload, _ := json.Marshal(req)
-	_, err := daemon.handleGrant(payload)
+	_, err := daemon.handleGrant(context.Background(), payload)
 	if err != nil {
 		t.Fatalf("initial handleGrant failed: %v", err)
 	}
@@ -148,7 +149,7 @@ func TestHandleGrant_AppendDoesNotRevokeRemovedLeases(t *testing.T) {
 		ConfigFile: "/tmp/env-lease.toml",
 	}
 	payload, _ = json.Marshal(req)
-	_, err = daemon.handleGrant(payload)
+	_, err = daemon.handleGrant(context.Background(), payload)
 	if err != nil {
 		t.Fatalf("append handleGrant failed: %v", err)
 	}
@@ -165,3 +166,123 @@ func TestHandleGrant_AppendDoesNotRevokeRemovedLeases(t *testing.T) {
 		t.Fatalf("expected no revoked leases in append mode, got %d", len(revoker.revoked))
 	}
 }
+
+func TestHandleRenew(t *testing.T) {
+	state := NewState()
+	clock := &mockClock{now: time.Now()}
+	daemon := NewDaemon(state, "/dev/null", clock, nil, &mockRevoker{}, &mockNotifier{})
+
+	req := ipc.GrantRequest{
+		Command:    "grant",
+		ConfigFile: "/project/env-lease.toml",
+		Leases: []ipc.Lease{
+			{Source: "1password", Destination: "/tmp/foo", LeaseType: "env", Variable: "MY_VAR", Duration: "1h"},
+		},
+	}
+	payload, _ := json.Marshal(req)
+	if _, err := daemon.handleGrant(context.Background(), payload); err != nil {
+		t.Fatalf("handleGrant failed: %v", err)
+	}
+
+	clock.now = clock.now.Add(30 * time.Minute)
+	payload, _ = json.Marshal(ipc.RenewRequest{Command: "renew", ConfigFile: "/project/env-lease.toml"})
+	if _, err := daemon.handleRenew(context.Background(), payload); err != nil {
+		t.Fatalf("handleRenew failed: %v", err)
+	}
+
+	key := "1password;/tmp/foo;MY_VAR"
+	expectedExpiresAt := clock.now.Add(time.Hour)
+	if !daemon.state.Leases[key].ExpiresAt.Equal(expectedExpiresAt) {
+		t.Fatalf("expected expiresAt %v, got %v", expectedExpiresAt, daemon.state.Leases[key].ExpiresAt)
+	}
+
+	payload, _ = json.Marshal(ipc.RenewRequest{Command: "renew", All: true, Duration: "10m"})
+	if _, err := daemon.handleRenew(context.Background(), payload); err != nil {
+		t.Fatalf("handleRenew failed: %v", err)
+	}
+	expectedExpiresAt = clock.now.Add(10 * time.Minute)
+	if !daemon.state.Leases[key].ExpiresAt.Equal(expectedExpiresAt) {
+		t.Fatalf("expected expiresAt %v, got %v", expectedExpiresAt, daemon.state.Leases[key].ExpiresAt)
+	}
+}
+
+func TestHandleIPC_AbandonsCancelledRequests(t *testing.T) {
+	state := NewState()
+	daemon := NewDaemon(state, "/dev/null", &mockClock{now: time.Now()}, nil, &mockRevoker{}, &mockNotifier{})
+
+	req := ipc.GrantRequest{
+		Command: "grant",
+		Leases:  []ipc.Lease{{Source: "1password", Destination: "/tmp/foo", LeaseType: "env", Variable: "MY_VAR", Duration: "1h"}},
+	}
+	payload, _ := json.Marshal(req)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := daemon.handleIPC(ctx, payload); err == nil {
+		t.Fatal("expected an error for a cancelled request")
+	}
+	if len(daemon.state.Leases) != 0 {
+		t.Fatalf("expected no leases to be granted, got %d", len(daemon.state.Leases))
+	}
+}
+
+func TestHandleShellLeases(t *testing.T) {
+	clock := &mockClock{now: time.Now()}
+	daemon := NewDaemon(NewState(), "/dev/null", clock, nil, &mockRevoker{}, nil)
+
+	grant := func(variable, duration, session string) {
+		t.Helper()
+		req := ipc.GrantRequest{
+			Command:    "grant",
+			Append:     true,
+			ConfigFile: "/work/env-lease.toml",
+			Leases: []ipc.Lease{{
+				Source:       "op://vault/item/" + variable,
+				Destination:  "/work/<shell>",
+				LeaseType:    "shell",
+				Variable:     variable,
+				Duration:     duration,
+				ShellSession: session,
+			}},
+		}
+		payload, _ := json.Marshal(req)
+		if _, err := daemon.handleGrant(context.Background(), payload); err != nil {
+			t.Fatalf("handleGrant failed: %v", err)
+		}
+	}
+	active := func(session string) []string {
+		t.Helper()
+		payload, _ := json.Marshal(ipc.ShellLeasesRequest{Command: "shell-leases", Session: session})
+		data, err := daemon.handleShellLeases(payload)
+		if err != nil {
+			t.Fatalf("handleShellLeases failed: %v", err)
+		}
+		var resp ipc.ShellLeasesResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Variables
+	}
+
+	grant("API_KEY", "1h", "first")
+	grant("TOKEN", "10m", "first")
+	// Granting the same lease to another shell keeps it active in both.
+	grant("API_KEY", "1h", "second")
+
+	if got := active("first"); len(got) != 2 || got[0] != "API_KEY" || got[1] != "TOKEN" {
+		t.Fatalf("expected API_KEY and TOKEN for first session, got %v", got)
+	}
+	if got := active("second"); len(got) != 1 || got[0] != "API_KEY" {
+		t.Fatalf("expected API_KEY for second session, got %v", got)
+	}
+
+	// An expired lease is no longer active, even before the daemon has
+	// revoked it.
+	clock.Advance(15 * time.Minute)
+	if got := active("first"); len(got) != 1 || got[0] != "API_KEY" {
+		t.Fatalf("expected only API_KEY after TOKEN expired, got %v", got)
+	}
+	if got := active("unknown"); len(got) != 0 {
+		t.Fatalf("expected no leases for an unknown session, got %v", got)
+	}
+}
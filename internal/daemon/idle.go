@@ -0,0 +1,170 @@
+package daemon
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/ipc"
+)
+
+// idleCheckInterval is how often the idle source is asked for the user's idle
+// time. Leases are revoked at most this long after the timeout passes.
+const idleCheckInterval = 15 * time.Second
+
+// IdleSource measures how long the user has been idle.
+type IdleSource interface {
+	// Name identifies the source in logs and status output.
+	Name() string
+	// IdleTime returns the time since the user last used the keyboard or
+	// mouse.
+	IdleTime() (time.Duration, error)
+}
+
+// idleState is the result of the last idle check.
+type idleState struct {
+	idle      time.Duration
+	checkedAt time.Time
+	err       error
+}
+
+// SetIdleSource makes the daemon measure idle time with source and revoke
+// leases once the user has been idle for their idle timeout. timeout is the
+// default for leases whose project and lease settings don't set one; zero
+// leaves those leases alone.
+func (d *Daemon) SetIdleSource(source IdleSource, timeout time.Duration) {
+	d.idleSource = source
+	d.idleTimeout = timeout
+}
+
+// idleTicks returns a channel that fires every idleCheckInterval, or nil,
+// which blocks forever, when there is no idle source. stop releases the
+// ticker.
+func (d *Daemon) idleTicks() (ticks <-chan time.Time, stop func()) {
+	if d.idleSource == nil {
+		return nil, func() {}
+	}
+	ticker := d.clock.Ticker(idleCheckInterval)
+	return ticker.C, ticker.Stop
+}
+
+// checkIdle revokes the leases that were granted before the user went idle,
+// once the idle time reaches their idle timeout. Leases granted while the
+// user is idle, for example over ssh, are left alone until the next idle
+// period.
+func (d *Daemon) checkIdle() {
+	d.mu.Lock()
+	timeouts := d.idleTimeouts()
+	d.mu.Unlock()
+	if len(timeouts) == 0 {
+		return
+	}
+
+	// The source may make a D-Bus or X11 round trip, so ask it without
+	// holding the lock.
+	idle, err := d.idleSource.IdleTime()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now()
+	d.idle = idleState{idle: idle, checkedAt: now, err: err}
+	if err != nil {
+		slog.Warn("Failed to read idle time", "source", d.idleSource.Name(), "err", err)
+		return
+	}
+	slog.Debug("Checked idle time", "source", d.idleSource.Name(), "idle", idle)
+
+	// Revoke each group of leases sharing a timeout together, so the events
+	// say which timeout applied.
+	var groups []time.Duration
+	for _, timeout := range timeouts {
+		if idle >= timeout && !slices.Contains(groups, timeout) {
+			groups = append(groups, timeout)
+		}
+	}
+	slices.Sort(groups)
+
+	idleSince := now.Add(-idle)
+	var revoked []*config.Lease
+	var failed int
+	for _, timeout := range groups {
+		r, f := d.revokeMatching(func(lease *config.Lease) bool {
+			t, ok := timeouts[lease]
+			return ok && t == timeout && lease.GrantedAt.Before(idleSince)
+		}, fmt.Sprintf("Revoked after %s idle.", timeout))
+		revoked = append(revoked, r...)
+		failed += f
+	}
+	if len(revoked)+failed == 0 {
+		return
+	}
+	slog.Info("Revoked leases on idle", "count", len(revoked), "failed", failed, "idle", idle)
+
+	if err := d.saveState(); err != nil {
+		slog.Error("Failed to save state after idle revocation", "err", err)
+	}
+	if len(revoked) > 0 && d.notifier != nil {
+		names := make([]string, len(revoked))
+		for i, lease := range revoked {
+			names[i] = leaseName(lease)
+		}
+		slices.Sort(names)
+		message := fmt.Sprintf("Revoked after %s idle: %s.", idle.Truncate(time.Second), strings.Join(names, ", "))
+		if err := d.notifier.Notify("Leases Revoked", message); err != nil {
+			slog.Error("Failed to send notification", "err", err)
+		}
+	}
+}
+
+// idleTimeouts returns the idle timeout of every active lease that has one.
+// A lease's own idle_timeout, which the CLI fills in from its project when the
+// lease doesn't set one, wins over the daemon's. The caller must hold d.mu.
+func (d *Daemon) idleTimeouts() map[*config.Lease]time.Duration {
+	timeouts := make(map[*config.Lease]time.Duration)
+	for _, lease := range d.state.Leases {
+		timeout := d.idleTimeout
+		if lease.IdleTimeout != "" {
+			parsed, err := config.ParseIdleTimeout(lease.IdleTimeout)
+			if err != nil {
+				slog.Warn("Ignoring invalid idle timeout", "source", lease.Source, "idle_timeout", lease.IdleTimeout, "err", err)
+			} else {
+				timeout = parsed
+			}
+		}
+		if timeout > 0 {
+			timeouts[lease] = timeout
+		}
+	}
+	return timeouts
+}
+
+// leaseName identifies a lease to the user: by its variable, or its
+// destination for file leases.
+func leaseName(lease *config.Lease) string {
+	if lease.Variable != "" {
+		return lease.Variable
+	}
+	return lease.Destination
+}
+
+// idleStatus reports the last idle check for the status command. The caller
+// must hold d.mu.
+func (d *Daemon) idleStatus() *ipc.IdleStatus {
+	if d.idleSource == nil {
+		return nil
+	}
+	status := &ipc.IdleStatus{
+		Source:    d.idleSource.Name(),
+		Timeout:   d.idleTimeout,
+		Idle:      d.idle.idle,
+		CheckedAt: d.idle.checkedAt,
+	}
+	if d.idle.err != nil {
+		status.Error = d.idle.err.Error()
+	}
+	return status
+}
@@ -0,0 +1,56 @@
+//go:build darwin
+// +build darwin
+
+package daemon
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+)
+
+// NewIdleSource returns the idle source with the given name. macOS only has
+// config.IdleSourceIOKit, which config.IdleSourceAuto selects.
+func NewIdleSource(name string) (IdleSource, error) {
+	switch name {
+	case config.IdleSourceAuto, config.IdleSourceIOKit:
+		source := &IOKitIdleSource{}
+		if _, err := source.IdleTime(); err != nil {
+			return nil, err
+		}
+		return source, nil
+	default:
+		return nil, fmt.Errorf("idle source '%s' is not supported on macOS", name)
+	}
+}
+
+var hidIdleTimePattern = regexp.MustCompile(`"HIDIdleTime" = (\d+)`)
+
+// IOKitIdleSource reads HIDIdleTime from the IOHIDSystem registry entry.
+type IOKitIdleSource struct{}
+
+// Name returns config.IdleSourceIOKit.
+func (s *IOKitIdleSource) Name() string {
+	return config.IdleSourceIOKit
+}
+
+// IdleTime returns the time since the last keyboard, mouse or trackpad input.
+func (s *IOKitIdleSource) IdleTime() (time.Duration, error) {
+	out, err := exec.Command("ioreg", "-c", "IOHIDSystem", "-d", "4").Output()
+	if err != nil {
+		return 0, fmt.Errorf("iokit: %w", err)
+	}
+	match := hidIdleTimePattern.FindSubmatch(out)
+	if match == nil {
+		return 0, fmt.Errorf("iokit: HIDIdleTime not found")
+	}
+	ns, err := strconv.ParseInt(string(match[1]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("iokit: %w", err)
+	}
+	return time.Duration(ns), nil
+}
@@ -0,0 +1,176 @@
+//go:build linux
+// +build linux
+
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/mblarsen/env-lease/internal/config"
+)
+
+const (
+	mutterIdleService   = "org.gnome.Mutter.IdleMonitor"
+	mutterIdlePath      = "/org/gnome/Mutter/IdleMonitor/Core"
+	mutterIdleInterface = "org.gnome.Mutter.IdleMonitor"
+
+	logindUserInterface = "org.freedesktop.login1.User"
+)
+
+// NewIdleSource returns the idle source with the given name, one of the
+// config.IdleSource* values. config.IdleSourceAuto picks the first source
+// that works: Mutter, then X11 outside of Wayland sessions, then logind.
+func NewIdleSource(name string) (IdleSource, error) {
+	candidates := map[string]func() (IdleSource, error){
+		config.IdleSourceMutter: func() (IdleSource, error) { return idleSourceOrError(NewMutterIdleSource()) },
+		config.IdleSourceX11:    func() (IdleSource, error) { return idleSourceOrError(NewX11IdleSource(os.Getenv("DISPLAY"))) },
+		config.IdleSourceLogind: func() (IdleSource, error) { return idleSourceOrError(NewLogindIdleSource()) },
+	}
+	if name != config.IdleSourceAuto {
+		open, ok := candidates[name]
+		if !ok {
+			return nil, fmt.Errorf("idle source '%s' is not supported on Linux", name)
+		}
+		return open()
+	}
+
+	order := []string{config.IdleSourceMutter, config.IdleSourceX11, config.IdleSourceLogind}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		// Under Wayland, X11 only sees input to clients running in Xwayland.
+		order = []string{config.IdleSourceMutter, config.IdleSourceLogind}
+	}
+	var errs []error
+	for _, name := range order {
+		source, err := candidates[name]()
+		if err == nil {
+			return source, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("no idle source available: %w", errors.Join(errs...))
+}
+
+// idleSourceOrError keeps a failed constructor's nil pointer from becoming a
+// non-nil IdleSource.
+func idleSourceOrError[S IdleSource](source S, err error) (IdleSource, error) {
+	if err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// MutterIdleSource asks GNOME Shell's IdleMonitor on the session bus. It works
+// under both X11 and Wayland.
+type MutterIdleSource struct {
+	conn *dbus.Conn
+}
+
+// NewMutterIdleSource connects to the session bus and checks that the
+// IdleMonitor answers.
+func NewMutterIdleSource() (*MutterIdleSource, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("mutter: failed to connect to session bus: %w", err)
+	}
+	return newMutterIdleSource(conn)
+}
+
+func newMutterIdleSource(conn *dbus.Conn) (*MutterIdleSource, error) {
+	s := &MutterIdleSource{conn: conn}
+	if _, err := s.IdleTime(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Name returns config.IdleSourceMutter.
+func (s *MutterIdleSource) Name() string {
+	return config.IdleSourceMutter
+}
+
+// IdleTime returns the time since the last input event.
+func (s *MutterIdleSource) IdleTime() (time.Duration, error) {
+	var ms uint64
+	err := s.conn.Object(mutterIdleService, mutterIdlePath).Call(mutterIdleInterface+".GetIdletime", 0).Store(&ms)
+	if err != nil {
+		return 0, fmt.Errorf("mutter: %w", err)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Close disconnects from the session bus.
+func (s *MutterIdleSource) Close() error {
+	return s.conn.Close()
+}
+
+// LogindIdleSource reads the IdleHint systemd-logind keeps for the user. The
+// hint is set by the desktop environment, or by logind itself when
+// IdleAction is configured, so it has a coarser resolution than the other
+// sources.
+type LogindIdleSource struct {
+	conn *dbus.Conn
+	uid  uint32
+}
+
+// NewLogindIdleSource connects to the system bus and checks that logind knows
+// the current user.
+func NewLogindIdleSource() (*LogindIdleSource, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("logind: failed to connect to system bus: %w", err)
+	}
+	return newLogindIdleSource(conn, uint32(os.Getuid()))
+}
+
+func newLogindIdleSource(conn *dbus.Conn, uid uint32) (*LogindIdleSource, error) {
+	s := &LogindIdleSource{conn: conn, uid: uid}
+	if _, err := s.IdleTime(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Name returns config.IdleSourceLogind.
+func (s *LogindIdleSource) Name() string {
+	return config.IdleSourceLogind
+}
+
+// IdleTime returns the time since all of the user's sessions became idle, or
+// 0 while any of them is active.
+func (s *LogindIdleSource) IdleTime() (time.Duration, error) {
+	// The user object goes away with the user's last session, so look it up
+	// every time.
+	var path dbus.ObjectPath
+	if err := s.conn.Object(logindService, logindPath).Call(logindInterface+".GetUser", 0, s.uid).Store(&path); err != nil {
+		return 0, fmt.Errorf("logind: %w", err)
+	}
+	user := s.conn.Object(logindService, path)
+
+	hint, err := user.GetProperty(logindUserInterface + ".IdleHint")
+	if err != nil {
+		return 0, fmt.Errorf("logind: %w", err)
+	}
+	if idle, _ := hint.Value().(bool); !idle {
+		return 0, nil
+	}
+	since, err := user.GetProperty(logindUserInterface + ".IdleSinceHint")
+	if err != nil {
+		return 0, fmt.Errorf("logind: %w", err)
+	}
+	usec, ok := since.Value().(uint64)
+	if !ok || usec == 0 {
+		return 0, nil
+	}
+	return time.Since(time.UnixMicro(int64(usec))), nil
+}
+
+// Close disconnects from the system bus.
+func (s *LogindIdleSource) Close() error {
+	return s.conn.Close()
+}
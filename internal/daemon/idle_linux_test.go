@@ -0,0 +1,106 @@
+//go:build linux
+// +build linux
+
+package daemon
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMutterIdleMonitor struct {
+	idletime uint64
+}
+
+func (f *fakeMutterIdleMonitor) GetIdletime() (uint64, *dbus.Error) {
+	return f.idletime, nil
+}
+
+func TestMutterIdleSource(t *testing.T) {
+	address := startPrivateBus(t)
+	mutterConn := connectBus(t, address)
+	require.NoError(t, mutterConn.Export(&fakeMutterIdleMonitor{idletime: 90500}, mutterIdlePath, mutterIdleInterface))
+	_, err := mutterConn.RequestName(mutterIdleService, dbus.NameFlagDoNotQueue)
+	require.NoError(t, err)
+
+	source, err := newMutterIdleSource(connectBus(t, address))
+	require.NoError(t, err)
+	idle, err := source.IdleTime()
+	require.NoError(t, err)
+	assert.Equal(t, 90500*time.Millisecond, idle)
+}
+
+func TestMutterIdleSource_Unavailable(t *testing.T) {
+	address := startPrivateBus(t)
+	_, err := newMutterIdleSource(connectBus(t, address))
+	assert.Error(t, err)
+}
+
+// fakeLogindUser serves GetUser on the manager and the IdleHint properties
+// of the user object.
+type fakeLogindUser struct {
+	uid uint32
+
+	mu        sync.Mutex
+	idle      bool
+	idleSince time.Time
+}
+
+func (f *fakeLogindUser) setIdleSince(since time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.idle, f.idleSince = true, since
+}
+
+func (f *fakeLogindUser) GetUser(uid uint32) (dbus.ObjectPath, *dbus.Error) {
+	if uid != f.uid {
+		return "", dbus.NewError("org.freedesktop.login1.NoSuchUser", []any{"no such user"})
+	}
+	return "/org/freedesktop/login1/user/_1000", nil
+}
+
+type fakeLogindUserProperties struct {
+	user *fakeLogindUser
+}
+
+func (p fakeLogindUserProperties) Get(iface, name string) (dbus.Variant, *dbus.Error) {
+	p.user.mu.Lock()
+	defer p.user.mu.Unlock()
+	switch name {
+	case "IdleHint":
+		return dbus.MakeVariant(p.user.idle), nil
+	case "IdleSinceHint":
+		return dbus.MakeVariant(uint64(p.user.idleSince.UnixMicro())), nil
+	}
+	return dbus.Variant{}, dbus.NewError("org.freedesktop.DBus.Error.UnknownProperty", []any{name})
+}
+
+func TestLogindIdleSource(t *testing.T) {
+	address := startPrivateBus(t)
+	logindConn := connectBus(t, address)
+	user := &fakeLogindUser{uid: 1000}
+	require.NoError(t, logindConn.Export(user, logindPath, logindInterface))
+	require.NoError(t, logindConn.Export(fakeLogindUserProperties{user}, "/org/freedesktop/login1/user/_1000", "org.freedesktop.DBus.Properties"))
+	_, err := logindConn.RequestName(logindService, dbus.NameFlagDoNotQueue)
+	require.NoError(t, err)
+
+	source, err := newLogindIdleSource(connectBus(t, address), 1000)
+	require.NoError(t, err)
+
+	idle, err := source.IdleTime()
+	require.NoError(t, err)
+	assert.Zero(t, idle, "an active user is not idle")
+
+	user.setIdleSince(time.Now().Add(-10 * time.Minute))
+	idle, err = source.IdleTime()
+	require.NoError(t, err)
+	assert.InDelta(t, float64(10*time.Minute), float64(idle), float64(5*time.Second))
+
+	_, err = newLogindIdleSource(connectBus(t, address), 1001)
+	assert.Error(t, err)
+}
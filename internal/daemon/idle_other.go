@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package daemon
+
+import "fmt"
+
+// NewIdleSource always fails on platforms without a supported idle source.
+func NewIdleSource(name string) (IdleSource, error) {
+	return nil, fmt.Errorf("idle detection is not supported on this platform")
+}
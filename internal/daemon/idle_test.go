@@ -0,0 +1,153 @@
+package daemon
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeIdleSource struct {
+	idle time.Duration
+	err  error
+}
+
+func (f *fakeIdleSource) Name() string {
+	return "fake"
+}
+
+func (f *fakeIdleSource) IdleTime() (time.Duration, error) {
+	return f.idle, f.err
+}
+
+func TestDaemon_checkIdle(t *testing.T) {
+	clock := &mockClock{now: time.Now()}
+	state := NewState()
+	state.Leases["old"] = &config.Lease{
+		Source:      "onepassword://vault/item/old",
+		Destination: "/tmp/old",
+		LeaseType:   "file",
+		GrantedAt:   clock.Now().Add(-2 * time.Hour),
+		ExpiresAt:   clock.Now().Add(6 * time.Hour),
+	}
+	state.Leases["new"] = &config.Lease{
+		Source:      "onepassword://vault/item/new",
+		Destination: "/tmp/new",
+		LeaseType:   "file",
+		GrantedAt:   clock.Now().Add(-5 * time.Minute),
+		ExpiresAt:   clock.Now().Add(time.Hour),
+	}
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	revoker := &mockRevoker{}
+	notifier := &mockNotifier{}
+	source := &fakeIdleSource{idle: 20 * time.Minute}
+	d := NewDaemon(state, statePath, clock, nil, revoker, notifier)
+	d.SetIdleSource(source, 30*time.Minute)
+
+	// Below the timeout nothing happens.
+	d.checkIdle()
+	assert.Len(t, d.state.Leases, 2)
+	status := d.idleStatus()
+	assert.Equal(t, "fake", status.Source)
+	assert.Equal(t, 20*time.Minute, status.Idle)
+	assert.True(t, status.CheckedAt.Equal(clock.Now()))
+
+	// Past it, only the lease granted before the user went idle is revoked.
+	clock.Advance(15 * time.Minute)
+	source.idle = 35 * time.Minute
+	d.checkIdle()
+	assert.Equal(t, 1, revoker.RevokeCount)
+	assert.Contains(t, d.state.Leases, "new")
+	assert.NotContains(t, d.state.Leases, "old")
+	assert.Equal(t, "Revoked after 35m0s idle: /tmp/old.", notifier.LastMessage)
+
+	reloaded, err := LoadState(statePath)
+	require.NoError(t, err)
+	assert.Len(t, reloaded.Leases, 1)
+
+	// A failing source is reported and revokes nothing.
+	source.err = errors.New("no display")
+	source.idle = 0
+	clock.Advance(time.Hour)
+	d.checkIdle()
+	assert.Len(t, d.state.Leases, 1)
+	assert.Equal(t, "no display", d.idleStatus().Error)
+}
+
+func TestDaemon_checkIdle_PerLease(t *testing.T) {
+	dir := t.TempDir()
+	clock := &mockClock{now: time.Now()}
+	grantedAt := clock.Now().Add(-3 * time.Hour)
+	lease := func(variable, idleTimeout string) *config.Lease {
+		return &config.Lease{
+			Source:      "op://vault/item/" + variable,
+			Destination: "/tmp/.envrc",
+			LeaseType:   "env",
+			Variable:    variable,
+			IdleTimeout: idleTimeout,
+			GrantedAt:   grantedAt,
+			ExpiresAt:   clock.Now().Add(8 * time.Hour),
+		}
+	}
+	state := NewState()
+	state.Leases["prod-db"] = lease("PROD_DB", "10m")
+	state.Leases["prod-token"] = lease("PROD_TOKEN", "0")
+	state.Leases["prod-admin"] = lease("PROD_ADMIN", "5m")
+	state.Leases["tool"] = lease("TOOL_TOKEN", "")
+	state.Leases["tool-keep"] = lease("TOOL_KEEP", "2h")
+
+	revoker := &mockRevoker{}
+	notifier := &mockNotifier{}
+	source := &fakeIdleSource{idle: 6 * time.Minute}
+	d := NewDaemon(state, filepath.Join(dir, "state.json"), clock, nil, revoker, notifier)
+	d.SetIdleSource(source, time.Hour)
+
+	// Each lease is revoked once its own timeout passes.
+	d.checkIdle()
+	assert.NotContains(t, d.state.Leases, "prod-admin")
+	assert.Contains(t, d.state.Leases, "prod-db")
+	assert.Equal(t, "Revoked after 6m0s idle: PROD_ADMIN.", notifier.LastMessage)
+
+	// A lease's timeout wins over the daemon's, and "0" exempts a lease.
+	source.idle = 12 * time.Minute
+	d.checkIdle()
+	assert.NotContains(t, d.state.Leases, "prod-db")
+	assert.Contains(t, d.state.Leases, "prod-token")
+	assert.Contains(t, d.state.Leases, "tool")
+	assert.Equal(t, "Revoked after 12m0s idle: PROD_DB.", notifier.LastMessage)
+
+	// Leases without a timeout fall back to the daemon's.
+	source.idle = 90 * time.Minute
+	d.checkIdle()
+	assert.NotContains(t, d.state.Leases, "tool")
+	assert.Contains(t, d.state.Leases, "tool-keep")
+	assert.Contains(t, d.state.Leases, "prod-token")
+	assert.Equal(t, "Revoked after 1h30m0s idle: TOOL_TOKEN.", notifier.LastMessage)
+	assert.Equal(t, 3, revoker.RevokeCount)
+}
+
+func TestDaemon_checkIdle_NoTimeouts(t *testing.T) {
+	state := NewState()
+	state.Leases["a"] = &config.Lease{Source: "op://vault/item/a", Destination: "/tmp/a", LeaseType: "file"}
+	source := &fakeIdleSource{idle: 24 * time.Hour}
+	d := NewDaemon(state, "/dev/null", &mockClock{now: time.Now()}, nil, &mockRevoker{}, nil)
+	d.SetIdleSource(source, 0)
+
+	// Without any timeout the source isn't even asked.
+	d.checkIdle()
+	assert.Len(t, d.state.Leases, 1)
+	assert.True(t, d.idleStatus().CheckedAt.IsZero())
+	assert.Equal(t, time.Duration(0), d.idleStatus().Timeout)
+}
+
+func TestDaemon_idleStatus_NoSource(t *testing.T) {
+	d := NewDaemon(nil, "/dev/null", &mockClock{now: time.Now()}, nil, &mockRevoker{}, nil)
+	assert.Nil(t, d.idleStatus())
+	ticks, stop := d.idleTicks()
+	defer stop()
+	assert.Nil(t, ticks)
+}
@@ -0,0 +1,318 @@
+//go:build linux
+// +build linux
+
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+)
+
+// X11 protocol values used by X11IdleSource. Requests are sent little-endian.
+const (
+	x11OpQueryExtension     = 98
+	x11ScreenSaverQueryInfo = 1
+	x11ScreenSaverExtension = "MIT-SCREEN-SAVER"
+	x11AuthCookie           = "MIT-MAGIC-COOKIE-1"
+	x11IOTimeout            = 5 * time.Second
+)
+
+// Xauthority address families.
+const (
+	xauthFamilyLocal = 256
+	xauthFamilyWild  = 65535
+)
+
+// X11IdleSource asks the X server's MIT-SCREEN-SAVER extension, as
+// xprintidle does. It speaks just enough of the X11 protocol to do so, and
+// reconnects after the server goes away.
+type X11IdleSource struct {
+	network, address string
+	authName         string
+	authData         []byte
+
+	mu     sync.Mutex
+	conn   net.Conn
+	root   uint32
+	opcode byte
+}
+
+// NewX11IdleSource connects to display, authenticating with the cookie from
+// $XAUTHORITY or ~/.Xauthority if there is one, and checks that the server
+// supports the screen saver extension.
+func NewX11IdleSource(display string) (*X11IdleSource, error) {
+	if display == "" {
+		return nil, errors.New("x11: DISPLAY is not set")
+	}
+	host, number, err := parseX11Display(display)
+	if err != nil {
+		return nil, err
+	}
+	s := &X11IdleSource{network: "unix", address: "/tmp/.X11-unix/X" + number}
+	if host != "" && host != "unix" {
+		port, _ := strconv.Atoi(number)
+		s.network, s.address = "tcp", net.JoinHostPort(host, strconv.Itoa(6000+port))
+	}
+	s.authName, s.authData = x11Cookie(host, number)
+	return newX11IdleSource(s)
+}
+
+func newX11IdleSource(s *X11IdleSource) (*X11IdleSource, error) {
+	if _, err := s.IdleTime(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Name returns config.IdleSourceX11.
+func (s *X11IdleSource) Name() string {
+	return config.IdleSourceX11
+}
+
+// IdleTime returns the time since the X server last saw input.
+func (s *X11IdleSource) IdleTime() (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return 0, fmt.Errorf("x11: %w", err)
+		}
+	}
+	idle, err := s.queryInfo()
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return 0, fmt.Errorf("x11: %w", err)
+	}
+	return idle, nil
+}
+
+// Close closes the connection to the X server.
+func (s *X11IdleSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// connect opens a connection, reads the root window of the first screen and
+// looks up the screen saver extension.
+func (s *X11IdleSource) connect() error {
+	conn, err := net.DialTimeout(s.network, s.address, x11IOTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	if err := s.setup(); err != nil {
+		conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *X11IdleSource) setup() error {
+	s.conn.SetDeadline(time.Now().Add(x11IOTimeout))
+
+	req := make([]byte, 12, 12+x11Pad(len(s.authName))+x11Pad(len(s.authData)))
+	req[0] = 'l'
+	binary.LittleEndian.PutUint16(req[2:], 11)
+	binary.LittleEndian.PutUint16(req[6:], uint16(len(s.authName)))
+	binary.LittleEndian.PutUint16(req[8:], uint16(len(s.authData)))
+	req = append(req, x11Padded([]byte(s.authName))...)
+	req = append(req, x11Padded(s.authData)...)
+	if _, err := s.conn.Write(req); err != nil {
+		return err
+	}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(s.conn, header); err != nil {
+		return fmt.Errorf("connection setup: %w", err)
+	}
+	data := make([]byte, int(binary.LittleEndian.Uint16(header[6:]))*4)
+	if _, err := io.ReadFull(s.conn, data); err != nil {
+		return fmt.Errorf("connection setup: %w", err)
+	}
+	if header[0] != 1 {
+		reason := data
+		if header[0] == 0 && int(header[1]) <= len(data) {
+			reason = data[:header[1]]
+		}
+		return fmt.Errorf("server refused connection: %s", strings.TrimSpace(string(reason)))
+	}
+
+	// The root window of the first screen follows the fixed part, the vendor
+	// string and the pixmap formats.
+	if len(data) < 32 {
+		return errors.New("connection setup: short reply")
+	}
+	vendorLen := int(binary.LittleEndian.Uint16(data[16:]))
+	formats := int(data[21])
+	offset := 32 + x11Pad(vendorLen) + 8*formats
+	if len(data) < offset+4 {
+		return errors.New("connection setup: no screens")
+	}
+	s.root = binary.LittleEndian.Uint32(data[offset:])
+
+	name := []byte(x11ScreenSaverExtension)
+	req = make([]byte, 8, 8+x11Pad(len(name)))
+	req[0] = x11OpQueryExtension
+	binary.LittleEndian.PutUint16(req[4:], uint16(len(name)))
+	req = append(req, x11Padded(name)...)
+	binary.LittleEndian.PutUint16(req[2:], uint16(len(req)/4))
+	reply, err := s.roundTrip(req)
+	if err != nil {
+		return fmt.Errorf("querying %s: %w", x11ScreenSaverExtension, err)
+	}
+	if reply[8] == 0 {
+		return fmt.Errorf("server does not support %s", x11ScreenSaverExtension)
+	}
+	s.opcode = reply[9]
+	return nil
+}
+
+// queryInfo sends ScreenSaverQueryInfo for the root window and returns the
+// time since the last input.
+func (s *X11IdleSource) queryInfo() (time.Duration, error) {
+	s.conn.SetDeadline(time.Now().Add(x11IOTimeout))
+	req := make([]byte, 8)
+	req[0] = s.opcode
+	req[1] = x11ScreenSaverQueryInfo
+	binary.LittleEndian.PutUint16(req[2:], 2)
+	binary.LittleEndian.PutUint32(req[4:], s.root)
+	reply, err := s.roundTrip(req)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(binary.LittleEndian.Uint32(reply[16:])) * time.Millisecond, nil
+}
+
+// roundTrip sends a request and returns the fixed 32 bytes of its reply.
+// Events are skipped, and errors reported by code.
+func (s *X11IdleSource) roundTrip(req []byte) ([]byte, error) {
+	if _, err := s.conn.Write(req); err != nil {
+		return nil, err
+	}
+	for {
+		reply := make([]byte, 32)
+		if _, err := io.ReadFull(s.conn, reply); err != nil {
+			return nil, err
+		}
+		switch reply[0] {
+		case 0:
+			return nil, fmt.Errorf("X error %d", reply[1])
+		case 1:
+			// Discard any data beyond the fixed part.
+			extra := int64(binary.LittleEndian.Uint32(reply[4:])) * 4
+			if _, err := io.CopyN(io.Discard, s.conn, extra); err != nil {
+				return nil, err
+			}
+			return reply, nil
+		}
+	}
+}
+
+// parseX11Display splits a DISPLAY value such as ":0", ":1.0" or
+// "host:10.0" into the host and display number.
+func parseX11Display(display string) (host, number string, err error) {
+	i := strings.LastIndex(display, ":")
+	if i < 0 {
+		return "", "", fmt.Errorf("x11: invalid DISPLAY '%s'", display)
+	}
+	host, number = display[:i], display[i+1:]
+	number, _, _ = strings.Cut(number, ".")
+	if _, err := strconv.Atoi(number); err != nil {
+		return "", "", fmt.Errorf("x11: invalid DISPLAY '%s'", display)
+	}
+	return host, number, nil
+}
+
+// x11Cookie returns the MIT-MAGIC-COOKIE-1 for the display, or empty values
+// if there is none, in which case the server may still accept the
+// connection based on the user's identity.
+func x11Cookie(host, number string) (string, []byte) {
+	path := os.Getenv("XAUTHORITY")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+		path = filepath.Join(home, ".Xauthority")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil
+	}
+	if host == "" || host == "unix" {
+		host, _ = os.Hostname()
+	}
+	cookie := findXauthCookie(data, host, number)
+	if cookie == nil {
+		return "", nil
+	}
+	return x11AuthCookie, cookie
+}
+
+// findXauthCookie finds the cookie for a display in the contents of an
+// Xauthority file. Each entry is a family followed by the address, display
+// number, auth name and auth data, each a big-endian length and bytes.
+func findXauthCookie(data []byte, host, number string) []byte {
+	r := bufio.NewReader(bytes.NewReader(data))
+	readField := func() ([]byte, error) {
+		var n uint16
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return nil, err
+		}
+		field := make([]byte, n)
+		_, err := io.ReadFull(r, field)
+		return field, err
+	}
+	for {
+		var family uint16
+		if err := binary.Read(r, binary.BigEndian, &family); err != nil {
+			return nil
+		}
+		var fields [4][]byte
+		for i := range fields {
+			field, err := readField()
+			if err != nil {
+				return nil
+			}
+			fields[i] = field
+		}
+		address, display, name, cookie := string(fields[0]), string(fields[1]), string(fields[2]), fields[3]
+		if name != x11AuthCookie || (display != "" && display != number) {
+			continue
+		}
+		if family == xauthFamilyWild || (family == xauthFamilyLocal && address == host) {
+			return cookie
+		}
+	}
+}
+
+// x11Pad rounds n up to a multiple of 4, the unit X11 lengths are counted in.
+func x11Pad(n int) int {
+	return (n + 3) &^ 3
+}
+
+func x11Padded(b []byte) []byte {
+	return append(b[:len(b):len(b)], make([]byte, x11Pad(len(b))-len(b))...)
+}
@@ -0,0 +1,152 @@
+//go:build linux
+// +build linux
+
+package daemon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveFakeX11 accepts one connection and answers the connection setup,
+// QueryExtension and ScreenSaverQueryInfo requests like an X server with the
+// given idle time.
+func serveFakeX11(t *testing.T, l net.Listener, cookie []byte, idle uint32) {
+	t.Helper()
+	const root, opcode = 0x2a1, 145
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	le := binary.LittleEndian
+
+	setup := make([]byte, 12)
+	if _, err := io.ReadFull(conn, setup); err != nil || setup[0] != 'l' {
+		return
+	}
+	auth := make([]byte, x11Pad(int(le.Uint16(setup[6:])))+x11Pad(int(le.Uint16(setup[8:]))))
+	if _, err := io.ReadFull(conn, auth); err != nil {
+		return
+	}
+	if !bytes.Contains(auth, cookie) {
+		reason := x11Padded([]byte("No protocol specified"))
+		reply := []byte{0, 21, 11, 0, 0, 0, 0, 0}
+		le.PutUint16(reply[6:], uint16(len(reason)/4))
+		conn.Write(append(reply, reason...))
+		return
+	}
+
+	// Fixed part, a 5 byte vendor, one pixmap format and a screen.
+	vendor := x11Padded([]byte("Xfake"))
+	data := make([]byte, 32)
+	le.PutUint16(data[16:], 5)
+	data[21] = 1
+	data = append(data, vendor...)
+	data = append(data, make([]byte, 8)...)
+	screen := make([]byte, 40)
+	le.PutUint32(screen, root)
+	data = append(data, screen...)
+	reply := []byte{1, 0, 11, 0, 0, 0, 0, 0}
+	le.PutUint16(reply[6:], uint16(len(data)/4))
+	conn.Write(append(reply, data...))
+
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		body := make([]byte, int(le.Uint16(header[2:]))*4-4)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		reply := make([]byte, 32)
+		reply[0] = 1
+		switch {
+		case header[0] == x11OpQueryExtension && string(body[4:4+le.Uint16(body)]) == x11ScreenSaverExtension:
+			reply[8], reply[9] = 1, opcode
+		case header[0] == opcode && header[1] == x11ScreenSaverQueryInfo && le.Uint32(body) == root:
+			le.PutUint32(reply[16:], idle)
+		default:
+			reply[0], reply[1] = 0, 1
+		}
+		conn.Write(reply)
+	}
+}
+
+func TestX11IdleSource(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "X0")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer l.Close()
+	cookie := []byte("0123456789abcdef")
+	go serveFakeX11(t, l, cookie, 125000)
+
+	source, err := newX11IdleSource(&X11IdleSource{network: "unix", address: socket, authName: x11AuthCookie, authData: cookie})
+	require.NoError(t, err)
+	defer source.Close()
+
+	idle, err := source.IdleTime()
+	require.NoError(t, err)
+	assert.Equal(t, 125*time.Second, idle)
+}
+
+func TestX11IdleSource_Refused(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "X0")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer l.Close()
+	go serveFakeX11(t, l, []byte("0123456789abcdef"), 0)
+
+	_, err = newX11IdleSource(&X11IdleSource{network: "unix", address: socket})
+	assert.ErrorContains(t, err, "No protocol specified")
+}
+
+func TestParseX11Display(t *testing.T) {
+	for display, want := range map[string][2]string{
+		":0":          {"", "0"},
+		":1.0":        {"", "1"},
+		"unix:2":      {"unix", "2"},
+		"remote:10.0": {"remote", "10"},
+	} {
+		host, number, err := parseX11Display(display)
+		require.NoError(t, err, display)
+		assert.Equal(t, want, [2]string{host, number}, display)
+	}
+	_, _, err := parseX11Display("wayland-0")
+	assert.Error(t, err)
+}
+
+func TestFindXauthCookie(t *testing.T) {
+	entry := func(family uint16, address, number, name string, data []byte) []byte {
+		var b bytes.Buffer
+		binary.Write(&b, binary.BigEndian, family)
+		for _, field := range [][]byte{[]byte(address), []byte(number), []byte(name), data} {
+			binary.Write(&b, binary.BigEndian, uint16(len(field)))
+			b.Write(field)
+		}
+		return b.Bytes()
+	}
+	file := bytes.Join([][]byte{
+		entry(xauthFamilyLocal, "otherhost", "0", x11AuthCookie, []byte("other")),
+		entry(xauthFamilyLocal, "myhost", "1", x11AuthCookie, []byte("display1")),
+		entry(xauthFamilyLocal, "myhost", "0", "XDM-AUTHORIZATION-1", []byte("xdm")),
+		entry(xauthFamilyLocal, "myhost", "0", x11AuthCookie, []byte("mine")),
+	}, nil)
+
+	assert.Equal(t, []byte("mine"), findXauthCookie(file, "myhost", "0"))
+	assert.Equal(t, []byte("display1"), findXauthCookie(file, "myhost", "1"))
+	assert.Nil(t, findXauthCookie(file, "myhost", "2"))
+	assert.Nil(t, findXauthCookie(file[:7], "myhost", "0"), "truncated file")
+
+	wild := entry(xauthFamilyWild, "", "", x11AuthCookie, []byte("wild"))
+	assert.Equal(t, []byte("wild"), findXauthCookie(wild, "anyhost", "3"))
+}
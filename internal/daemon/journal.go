@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/mblarsen/env-lease/internal/journal"
+)
+
+// journalReplayInterval is how often the grant journal is checked for grants
+// whose CLI process died before reaching the daemon.
+const journalReplayInterval = time.Minute
+
+// journalMaxAge is how long an entry whose process still appears to be
+// running is left alone. Past it the PID is assumed to have been reused.
+const journalMaxAge = 10 * time.Minute
+
+// SetGrantJournal sets the journal of grants the CLI has started writing.
+// Entries left behind by a CLI that died are replayed by the daemon.
+func (d *Daemon) SetGrantJournal(j *journal.Journal) {
+	d.journal = j
+}
+
+// replayGrantJournal adopts leases that were written to disk by a grant that
+// never reached the daemon. They are tracked with the expiry they would have
+// had, so a lease whose duration has already passed is revoked by the next
+// expiry check like any other.
+func (d *Daemon) replayGrantJournal() {
+	if d.journal == nil {
+		return
+	}
+	entries, err := d.journal.Entries()
+	if err != nil {
+		slog.Warn("Problem reading grant journal", "err", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now()
+	stateChanged := false
+	for _, entry := range entries {
+		if entry.InProgress() && now.Sub(entry.CreatedAt) < journalMaxAge {
+			continue
+		}
+		for _, l := range entry.Leases {
+			if l.LeaseType == "shell" {
+				continue
+			}
+			key := leaseIdentity(l.Source, l.Destination, l.Variable)
+			if _, tracked := d.state.Leases[key]; tracked {
+				// The grant reached the daemon; only the cleanup was missed.
+				continue
+			}
+			duration, err := time.ParseDuration(l.Duration)
+			if err != nil {
+				// Without a duration there is nothing to wait for.
+				duration = 0
+			}
+			lease := leaseFromIPC(l, entry.ConfigFile, entry.CreatedAt.Add(duration))
+			lease.GrantedAt = entry.CreatedAt
+			d.state.Leases[key] = lease
+			stateChanged = true
+			slog.Warn("Adopted lease from an interrupted grant", "source", lease.Source, "destination", lease.Destination, "expires_at", lease.ExpiresAt)
+			d.emit(ipc.EventGranted, lease, "Adopted from an interrupted grant.")
+		}
+		if stateChanged {
+			// Persist before the entry is dropped so the leases are never
+			// untracked in both places.
+			if err := d.saveState(); err != nil {
+				slog.Error("Failed to save state after replaying grant journal; keeping entry", "path", entry.Path(), "err", err)
+				continue
+			}
+		}
+		if err := d.journal.Remove(entry); err != nil {
+			slog.Warn("Failed to remove replayed grant journal entry", "path", entry.Path(), "err", err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/mblarsen/env-lease/internal/journal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeJournalEntry writes an entry as if by a CLI process that has exited.
+func writeJournalEntry(t *testing.T, dir string, createdAt time.Time, leases ...ipc.Lease) {
+	t.Helper()
+	entry := journal.Entry{PID: 1 << 30, CreatedAt: createdAt, ConfigFile: "/project/env-lease.toml", Leases: leases}
+	data, err := json.Marshal(entry)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "1-1.json"), data, 0600))
+}
+
+func TestReplayGrantJournal_AdoptsUntrackedLeases(t *testing.T) {
+	dir := t.TempDir()
+	clock := &mockClock{now: time.Now()}
+	revoker := &mockRevoker{}
+	tracked := ipc.Lease{Source: "op://vault/item/tracked", Destination: "/project/.envrc", LeaseType: "env", Variable: "TRACKED", Duration: "1h"}
+	live := ipc.Lease{Source: "op://vault/item/live", Destination: "/project/.envrc", LeaseType: "env", Variable: "LIVE", Duration: "1h"}
+	expired := ipc.Lease{Source: "op://vault/item/expired", Destination: "/project/.envrc", LeaseType: "env", Variable: "EXPIRED", Duration: "1m"}
+	writeJournalEntry(t, dir, clock.now.Add(-5*time.Minute), tracked, live, expired)
+
+	state := NewState()
+	existing := &config.Lease{Source: tracked.Source, Destination: tracked.Destination, Variable: tracked.Variable, ExpiresAt: clock.now.Add(time.Hour)}
+	state.Leases[leaseIdentity(tracked.Source, tracked.Destination, tracked.Variable)] = existing
+	d := NewDaemon(state, filepath.Join(t.TempDir(), "state.json"), clock, nil, revoker, nil)
+	d.SetGrantJournal(journal.New(dir))
+
+	d.replayGrantJournal()
+
+	assert.Same(t, existing, d.state.Leases[leaseIdentity(tracked.Source, tracked.Destination, tracked.Variable)])
+	adopted := d.state.Leases[leaseIdentity(live.Source, live.Destination, live.Variable)]
+	require.NotNil(t, adopted)
+	assert.True(t, clock.now.Add(55*time.Minute).Equal(adopted.ExpiresAt))
+	assert.Equal(t, "/project/env-lease.toml", adopted.ConfigFile)
+
+	entries, err := journal.New(dir).Entries()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// The lease whose duration passed while nobody tracked it is revoked by
+	// the regular expiry check.
+	d.revokeExpiredLeases()
+	require.Len(t, revoker.revoked, 1)
+	assert.Equal(t, "EXPIRED", revoker.revoked[0].Variable)
+	assert.Len(t, d.state.Leases, 2)
+}
+
+func TestReplayGrantJournal_SkipsGrantsInProgress(t *testing.T) {
+	dir := t.TempDir()
+	j := journal.New(dir)
+	pending := j.Begin("/project/env-lease.toml")
+	require.NoError(t, pending.Add(ipc.Lease{Source: "op://vault/item/a", Destination: "/project/.envrc", LeaseType: "env", Variable: "A", Duration: "1h"}))
+
+	d := NewDaemon(NewState(), "/dev/null", &mockClock{now: time.Now()}, nil, &mockRevoker{}, nil)
+	d.SetGrantJournal(j)
+
+	d.replayGrantJournal()
+
+	assert.Empty(t, d.state.Leases)
+	entries, err := j.Entries()
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
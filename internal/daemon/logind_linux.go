@@ -0,0 +1,287 @@
+//go:build linux
+// +build linux
+
+package daemon
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	logindInterface = "org.freedesktop.login1.Manager"
+	logindPath      = "/org/freedesktop/login1"
+)
+
+// LogindShutdownDetector watches systemd-logind's PrepareForShutdown signal on
+// the system bus. logind emits the signal before a poweroff or reboot starts
+// stopping user services, so a daemon stopped without it was stopped because
+// the user logged out.
+type LogindShutdownDetector struct {
+	conn *dbus.Conn
+
+	mu           sync.Mutex
+	shuttingDown bool
+}
+
+// NewLogindShutdownDetector connects to the system bus and starts watching for
+// PrepareForShutdown.
+func NewLogindShutdownDetector() (*LogindShutdownDetector, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to system bus: %w", err)
+	}
+	return newLogindShutdownDetector(conn)
+}
+
+func newLogindShutdownDetector(conn *dbus.Conn) (*LogindShutdownDetector, error) {
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(logindPath),
+		dbus.WithMatchInterface(logindInterface),
+		dbus.WithMatchMember("PrepareForShutdown"),
+		// Anyone on the bus can emit a signal with logind's interface, and a
+		// forged one would stop leases from being revoked on logout.
+		dbus.WithMatchSender(logindService),
+	); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to subscribe to logind signals: %w", err)
+	}
+
+	d := &LogindShutdownDetector{conn: conn}
+	signals := make(chan *dbus.Signal, 8)
+	conn.Signal(signals)
+	go d.watch(signals)
+	return d, nil
+}
+
+func (d *LogindShutdownDetector) watch(signals <-chan *dbus.Signal) {
+	for sig := range signals {
+		if sig.Name != logindInterface+".PrepareForShutdown" || len(sig.Body) == 0 {
+			continue
+		}
+		active, ok := sig.Body[0].(bool)
+		if !ok {
+			continue
+		}
+		if !d.fromLogind(sig) {
+			slog.Warn("Ignoring PrepareForShutdown not sent by logind", "sender", sig.Sender)
+			continue
+		}
+		slog.Debug("Received logind PrepareForShutdown", "active", active)
+		d.mu.Lock()
+		d.shuttingDown = active
+		d.mu.Unlock()
+	}
+}
+
+// fromLogind reports whether sig was sent by the current owner of the logind
+// bus name. The owner is looked up each time, since logind may have been
+// restarted under a new unique name.
+func (d *LogindShutdownDetector) fromLogind(sig *dbus.Signal) bool {
+	var owner string
+	if err := d.conn.BusObject().Call("org.freedesktop.DBus.GetNameOwner", 0, logindService).Store(&owner); err != nil {
+		slog.Warn("Failed to look up the logind bus name", "err", err)
+		return false
+	}
+	return sig.Sender == owner
+}
+
+// SystemShuttingDown reports whether logind has announced a shutdown or reboot.
+func (d *LogindShutdownDetector) SystemShuttingDown() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.shuttingDown
+}
+
+// Close disconnects from the system bus.
+func (d *LogindShutdownDetector) Close() error {
+	return d.conn.Close()
+}
+
+const (
+	logindService          = "org.freedesktop.login1"
+	logindSessionInterface = "org.freedesktop.login1.Session"
+)
+
+// logindSession is an entry of the array returned by Manager.ListSessions.
+type logindSession struct {
+	ID   string
+	UID  uint32
+	User string
+	Seat string
+	Path dbus.ObjectPath
+}
+
+// LogindSessionWatcher turns systemd-logind signals into session events: Lock
+// on one of the user's sessions, PrepareForSleep before a suspend, and
+// SessionRemoved once the user's last session is gone. It holds a sleep delay
+// inhibitor so leases are revoked before the system suspends.
+type LogindSessionWatcher struct {
+	conn   *dbus.Conn
+	uid    uint32
+	events chan SessionEvent
+	closed chan struct{}
+	once   sync.Once
+
+	// sessions maps the object paths of the user's sessions to their IDs. It
+	// is only used by the watch goroutine.
+	sessions map[dbus.ObjectPath]string
+
+	mu        sync.Mutex
+	inhibitor *os.File
+}
+
+// NewLogindSessionWatcher connects to the system bus and starts watching the
+// current user's sessions.
+func NewLogindSessionWatcher() (*LogindSessionWatcher, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to system bus: %w", err)
+	}
+	return newLogindSessionWatcher(conn, uint32(os.Getuid()))
+}
+
+func newLogindSessionWatcher(conn *dbus.Conn, uid uint32) (*LogindSessionWatcher, error) {
+	matches := [][]dbus.MatchOption{
+		{dbus.WithMatchInterface(logindSessionInterface), dbus.WithMatchMember("Lock")},
+		{dbus.WithMatchObjectPath(logindPath), dbus.WithMatchInterface(logindInterface), dbus.WithMatchMember("PrepareForSleep")},
+		{dbus.WithMatchObjectPath(logindPath), dbus.WithMatchInterface(logindInterface), dbus.WithMatchMember("SessionNew")},
+		{dbus.WithMatchObjectPath(logindPath), dbus.WithMatchInterface(logindInterface), dbus.WithMatchMember("SessionRemoved")},
+	}
+	for _, match := range matches {
+		// Only logind itself may send these; anyone on the bus can emit a
+		// signal with its interface.
+		if err := conn.AddMatchSignal(append(match, dbus.WithMatchSender(logindService))...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to subscribe to logind signals: %w", err)
+		}
+	}
+
+	w := &LogindSessionWatcher{
+		conn:   conn,
+		uid:    uid,
+		events: make(chan SessionEvent, 8),
+		closed: make(chan struct{}),
+	}
+	if err := w.refreshSessions(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	w.inhibitSleep()
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	go w.watch(signals)
+	return w, nil
+}
+
+// Events returns the channel session events are delivered on.
+func (w *LogindSessionWatcher) Events() <-chan SessionEvent {
+	return w.events
+}
+
+// Close releases the sleep inhibitor and disconnects from the system bus.
+func (w *LogindSessionWatcher) Close() error {
+	w.once.Do(func() { close(w.closed) })
+	w.releaseSleep()
+	return w.conn.Close()
+}
+
+func (w *LogindSessionWatcher) watch(signals <-chan *dbus.Signal) {
+	for sig := range signals {
+		switch sig.Name {
+		case logindSessionInterface + ".Lock":
+			if id, ok := w.sessions[sig.Path]; ok {
+				w.send(SessionEvent{Kind: SessionLock, Session: id})
+			}
+		case logindInterface + ".PrepareForSleep":
+			if len(sig.Body) == 0 {
+				continue
+			}
+			if start, _ := sig.Body[0].(bool); start {
+				w.send(SessionEvent{Kind: SessionSleep, done: w.releaseSleep})
+			} else {
+				// Resumed: hold off the next suspend as well.
+				w.inhibitSleep()
+			}
+		case logindInterface + ".SessionNew":
+			if err := w.refreshSessions(); err != nil {
+				slog.Warn("Failed to list logind sessions", "err", err)
+			}
+		case logindInterface + ".SessionRemoved":
+			if len(sig.Body) < 2 {
+				continue
+			}
+			path, _ := sig.Body[1].(dbus.ObjectPath)
+			id, ok := w.sessions[path]
+			if !ok {
+				continue
+			}
+			delete(w.sessions, path)
+			if len(w.sessions) == 0 {
+				w.send(SessionEvent{Kind: SessionLogout, Session: id})
+			}
+		}
+	}
+}
+
+func (w *LogindSessionWatcher) send(ev SessionEvent) {
+	slog.Debug("Received logind session event", "kind", ev.Kind, "session", ev.Session)
+	select {
+	case w.events <- ev:
+	case <-w.closed:
+		ev.Done()
+	}
+}
+
+// refreshSessions lists the user's sessions.
+func (w *LogindSessionWatcher) refreshSessions() error {
+	var sessions []logindSession
+	if err := w.manager().Call(logindInterface+".ListSessions", 0).Store(&sessions); err != nil {
+		return fmt.Errorf("failed to list logind sessions: %w", err)
+	}
+	w.sessions = make(map[dbus.ObjectPath]string)
+	for _, s := range sessions {
+		if s.UID == w.uid {
+			w.sessions[s.Path] = s.ID
+		}
+	}
+	return nil
+}
+
+// inhibitSleep takes a delay inhibitor, so logind waits for the sleep event
+// to be handled (up to its InhibitDelayMaxSec) before suspending. Without it
+// the system may suspend before the leases are revoked.
+func (w *LogindSessionWatcher) inhibitSleep() {
+	var fd dbus.UnixFD
+	err := w.manager().Call(logindInterface+".Inhibit", 0,
+		"sleep", "env-lease", "Revoke leases before suspend", "delay").Store(&fd)
+	if err != nil {
+		slog.Warn("Could not delay suspend; leases may be revoked after resume", "err", err)
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.inhibitor != nil {
+		w.inhibitor.Close()
+	}
+	w.inhibitor = os.NewFile(uintptr(fd), "logind-inhibitor")
+}
+
+// releaseSleep lets a pending suspend proceed.
+func (w *LogindSessionWatcher) releaseSleep() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.inhibitor != nil {
+		w.inhibitor.Close()
+		w.inhibitor = nil
+	}
+}
+
+func (w *LogindSessionWatcher) manager() dbus.BusObject {
+	return w.conn.Object(logindService, logindPath)
+}
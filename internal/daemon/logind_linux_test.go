@@ -0,0 +1,188 @@
+//go:build linux
+// +build linux
+
+package daemon
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startPrivateBus runs a dbus-daemon for the test and returns its address.
+func startPrivateBus(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--nopidfile", "--print-address=1")
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	return strings.TrimSpace(address)
+}
+
+func connectBus(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// fakeLogind implements the parts of org.freedesktop.login1.Manager the
+// session watcher uses.
+type fakeLogind struct {
+	mu         sync.Mutex
+	sessions   []logindSession
+	inhibitors [][2]*os.File
+}
+
+func (f *fakeLogind) ListSessions() ([]logindSession, *dbus.Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sessions, nil
+}
+
+func (f *fakeLogind) Inhibit(what, who, why, mode string) (dbus.UnixFD, *dbus.Error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, dbus.MakeFailedError(err)
+	}
+	f.mu.Lock()
+	f.inhibitors = append(f.inhibitors, [2]*os.File{r, w})
+	f.mu.Unlock()
+	return dbus.UnixFD(w.Fd()), nil
+}
+
+// released reports whether the most recent inhibitor has been closed by the
+// watcher: once our copy of the write end is closed too, the read end of its
+// pipe sees EOF.
+func (f *fakeLogind) released(t *testing.T) bool {
+	f.mu.Lock()
+	r, w := f.inhibitors[len(f.inhibitors)-1][0], f.inhibitors[len(f.inhibitors)-1][1]
+	f.mu.Unlock()
+	w.Close()
+	require.NoError(t, r.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, err := r.Read(make([]byte, 1))
+	return err != nil && !os.IsTimeout(err)
+}
+
+func TestLogindSessionWatcher(t *testing.T) {
+	address := startPrivateBus(t)
+
+	logindConn := connectBus(t, address)
+	logind := &fakeLogind{sessions: []logindSession{
+		{ID: "2", UID: 1000, User: "me", Seat: "seat0", Path: "/org/freedesktop/login1/session/_32"},
+		{ID: "3", UID: 1001, User: "other", Seat: "seat0", Path: "/org/freedesktop/login1/session/_33"},
+	}}
+	require.NoError(t, logindConn.Export(logind, logindPath, logindInterface))
+	reply, err := logindConn.RequestName(logindService, dbus.NameFlagDoNotQueue)
+	require.NoError(t, err)
+	require.Equal(t, dbus.RequestNameReplyPrimaryOwner, reply)
+
+	watcher, err := newLogindSessionWatcher(connectBus(t, address), 1000)
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	next := func() SessionEvent {
+		t.Helper()
+		select {
+		case ev := <-watcher.Events():
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for session event")
+			return SessionEvent{}
+		}
+	}
+	emit := func(path dbus.ObjectPath, name string, values ...any) {
+		t.Helper()
+		require.NoError(t, logindConn.Emit(path, name, values...))
+	}
+
+	// Locking another user's session is ignored; ours is reported.
+	emit("/org/freedesktop/login1/session/_33", logindSessionInterface+".Lock")
+	emit("/org/freedesktop/login1/session/_32", logindSessionInterface+".Lock")
+	ev := next()
+	assert.Equal(t, SessionLock, ev.Kind)
+	assert.Equal(t, "2", ev.Session)
+
+	// The sleep inhibitor is held until the event is done.
+	emit(logindPath, logindInterface+".PrepareForSleep", true)
+	ev = next()
+	assert.Equal(t, SessionSleep, ev.Kind)
+	assert.False(t, logind.released(t), "inhibitor released before the event was handled")
+	ev.Done()
+	assert.True(t, logind.released(t), "inhibitor not released after the event was handled")
+
+	// A new session of ours is picked up, and logout is only reported once
+	// the last one is gone.
+	logind.mu.Lock()
+	logind.sessions = append(logind.sessions, logindSession{ID: "4", UID: 1000, User: "me", Path: "/org/freedesktop/login1/session/_34"})
+	logind.mu.Unlock()
+	emit(logindPath, logindInterface+".SessionNew", "4", dbus.ObjectPath("/org/freedesktop/login1/session/_34"))
+	emit(logindPath, logindInterface+".SessionRemoved", "2", dbus.ObjectPath("/org/freedesktop/login1/session/_32"))
+	emit(logindPath, logindInterface+".SessionRemoved", "4", dbus.ObjectPath("/org/freedesktop/login1/session/_34"))
+	ev = next()
+	assert.Equal(t, SessionLogout, ev.Kind)
+	assert.Equal(t, "4", ev.Session)
+}
+
+func TestLogindSessionWatcher_IgnoresOtherSenders(t *testing.T) {
+	address := startPrivateBus(t)
+
+	logindConn := connectBus(t, address)
+	logind := &fakeLogind{sessions: []logindSession{
+		{ID: "2", UID: 1000, User: "me", Path: "/org/freedesktop/login1/session/_32"},
+	}}
+	require.NoError(t, logindConn.Export(logind, logindPath, logindInterface))
+	_, err := logindConn.RequestName(logindService, dbus.NameFlagDoNotQueue)
+	require.NoError(t, err)
+
+	watcher, err := newLogindSessionWatcher(connectBus(t, address), 1000)
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	impostor := connectBus(t, address)
+	require.NoError(t, impostor.Emit("/org/freedesktop/login1/session/_32", logindSessionInterface+".Lock"))
+
+	select {
+	case ev := <-watcher.Events():
+		t.Fatalf("unexpected session event %q", ev.Kind)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestLogindShutdownDetector_IgnoresOtherSenders(t *testing.T) {
+	address := startPrivateBus(t)
+
+	logindConn := connectBus(t, address)
+	_, err := logindConn.RequestName(logindService, dbus.NameFlagDoNotQueue)
+	require.NoError(t, err)
+
+	detector, err := newLogindShutdownDetector(connectBus(t, address))
+	require.NoError(t, err)
+	defer detector.Close()
+
+	impostor := connectBus(t, address)
+	require.NoError(t, impostor.Emit(logindPath, logindInterface+".PrepareForShutdown", true))
+	time.Sleep(200 * time.Millisecond)
+	assert.False(t, detector.SystemShuttingDown(), "accepted PrepareForShutdown from another sender")
+
+	require.NoError(t, logindConn.Emit(logindPath, logindInterface+".PrepareForShutdown", true))
+	assert.Eventually(t, detector.SystemShuttingDown, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,42 @@
+//go:build !linux
+// +build !linux
+
+package daemon
+
+import "fmt"
+
+// LogindShutdownDetector is only available on Linux.
+type LogindShutdownDetector struct{}
+
+// NewLogindShutdownDetector always fails on platforms without systemd-logind.
+func NewLogindShutdownDetector() (*LogindShutdownDetector, error) {
+	return nil, fmt.Errorf("systemd-logind is only available on Linux")
+}
+
+// SystemShuttingDown always reports false.
+func (d *LogindShutdownDetector) SystemShuttingDown() bool {
+	return false
+}
+
+// Close is a no-op.
+func (d *LogindShutdownDetector) Close() error {
+	return nil
+}
+
+// LogindSessionWatcher is only available on Linux.
+type LogindSessionWatcher struct{}
+
+// NewLogindSessionWatcher always fails on platforms without systemd-logind.
+func NewLogindSessionWatcher() (*LogindSessionWatcher, error) {
+	return nil, fmt.Errorf("systemd-logind is only available on Linux")
+}
+
+// Events returns nil, which never delivers an event.
+func (w *LogindSessionWatcher) Events() <-chan SessionEvent {
+	return nil
+}
+
+// Close is a no-op.
+func (w *LogindSessionWatcher) Close() error {
+	return nil
+}
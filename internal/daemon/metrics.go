@@ -0,0 +1,119 @@
+package daemon
+
+import (
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/mblarsen/env-lease/internal/metrics"
+)
+
+// daemonMetrics holds the metrics the daemon exposes on its optional metrics
+// endpoint.
+type daemonMetrics struct {
+	registry       *metrics.Registry
+	grants         *metrics.CounterVec
+	expiries       *metrics.CounterVec
+	revokeFailures *metrics.CounterVec
+	ipcDuration    *metrics.HistogramVec
+	fetchDuration  *metrics.HistogramVec
+}
+
+func newDaemonMetrics(d *Daemon) *daemonMetrics {
+	r := metrics.NewRegistry()
+	m := &daemonMetrics{
+		registry: r,
+		grants: r.NewCounterVec("env_lease_grants_total",
+			"Leases granted or renewed.", "lease_type"),
+		expiries: r.NewCounterVec("env_lease_expiries_total",
+			"Leases that expired.", "lease_type"),
+		revokeFailures: r.NewCounterVec("env_lease_revoke_failures_total",
+			"Failed revocation attempts.", "lease_type"),
+		ipcDuration: r.NewHistogramVec("env_lease_ipc_request_duration_seconds",
+			"Time spent handling IPC requests.", metrics.DefaultBuckets, "command"),
+		fetchDuration: r.NewHistogramVec("env_lease_provider_fetch_duration_seconds",
+			"Time clients spent fetching secrets from providers.", metrics.DefaultBuckets, "provider", "result"),
+	}
+	r.NewGaugeFunc("env_lease_active_leases",
+		"Active leases by project and lease type.", d.activeLeaseSamples, "project", "lease_type")
+	r.NewGaugeFunc("env_lease_retry_queue_depth",
+		"Revocations waiting to be retried.", func() []metrics.Sample {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return []metrics.Sample{{Value: float64(len(d.state.RetryQueue))}}
+		})
+	r.NewGaugeFunc("env_lease_dead_letters",
+		"Revocations that were given up on.", func() []metrics.Sample {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return []metrics.Sample{{Value: float64(len(d.state.DeadLetters))}}
+		})
+	return m
+}
+
+// MetricsHandler returns an HTTP handler serving the daemon metrics in the
+// Prometheus text format.
+func (d *Daemon) MetricsHandler() http.Handler {
+	return d.metrics.registry.Handler()
+}
+
+// activeLeaseSamples counts leases by project and type. A project is named
+// by the directory holding its config file, not the full path, so the user's
+// directory layout isn't exposed to whatever scrapes the endpoint.
+func (d *Daemon) activeLeaseSamples() []metrics.Sample {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	counts := make(map[[2]string]int)
+	for _, lease := range d.state.Leases {
+		counts[[2]string{projectLabel(lease.ConfigFile), lease.LeaseType}]++
+	}
+	samples := make([]metrics.Sample, 0, len(counts))
+	for key, count := range counts {
+		samples = append(samples, metrics.Sample{Labels: key[:], Value: float64(count)})
+	}
+	return samples
+}
+
+// projectLabel returns the name of the directory holding configFile.
+func projectLabel(configFile string) string {
+	if configFile == "" {
+		return ""
+	}
+	return filepath.Base(filepath.Dir(configFile))
+}
+
+// observeEvent updates the counters affected by a lease event.
+func (m *daemonMetrics) observeEvent(eventType string, lease *config.Lease) {
+	leaseType := ""
+	if lease != nil {
+		leaseType = lease.LeaseType
+	}
+	switch eventType {
+	case ipc.EventGranted, ipc.EventRenewed:
+		m.grants.Inc(leaseType)
+	case ipc.EventExpired:
+		m.expiries.Inc(leaseType)
+	case ipc.EventRevokeFailed:
+		m.revokeFailures.Inc(leaseType)
+	}
+}
+
+func (m *daemonMetrics) observeIPC(command string, elapsed time.Duration) {
+	m.ipcDuration.Observe(elapsed.Seconds(), command)
+}
+
+func (m *daemonMetrics) observeFetches(fetches []ipc.ProviderFetch) {
+	for _, f := range fetches {
+		m.fetchDuration.Observe(f.Seconds, f.Provider, fetchResult(f.Failed))
+	}
+}
+
+func fetchResult(failed bool) string {
+	if failed {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,47 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDaemon_MetricsHandler(t *testing.T) {
+	clock := &mockClock{now: time.Now()}
+	state := NewState()
+	state.RetryQueue = append(state.RetryQueue, RetryItem{Lease: &config.Lease{Source: "stuck"}})
+	d := NewDaemon(state, "/dev/null", clock, nil, &mockRevoker{}, &mockNotifier{})
+
+	req := ipc.GrantRequest{
+		Command:    "grant",
+		ConfigFile: "/project/env-lease.toml",
+		Leases: []ipc.Lease{
+			{Source: "op://vault/item/field", Destination: "/project/.envrc", LeaseType: "env", Variable: "API_KEY", Duration: "1h"},
+		},
+		Fetches: []ipc.ProviderFetch{{Provider: "op", Seconds: 0.3}},
+	}
+	payload, _ := json.Marshal(req)
+	_, err := d.handleIPC(context.Background(), payload)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	d.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	out := string(body)
+
+	assert.Contains(t, out, `env_lease_active_leases{project="project",lease_type="env"} 1`)
+	assert.NotContains(t, out, "/project", "metrics must not expose project paths")
+	assert.Contains(t, out, `env_lease_grants_total{lease_type="env"} 1`)
+	assert.Contains(t, out, "env_lease_retry_queue_depth 1\n")
+	assert.Contains(t, out, `env_lease_ipc_request_duration_seconds_count{command="grant"} 1`)
+	assert.Contains(t, out, `env_lease_provider_fetch_duration_seconds_bucket{provider="op",result="ok",le="0.25"} 0`)
+	assert.Contains(t, out, `env_lease_provider_fetch_duration_seconds_bucket{provider="op",result="ok",le="0.5"} 1`)
+}
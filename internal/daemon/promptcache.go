@@ -0,0 +1,71 @@
+package daemon
+
+import (
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/promptcache"
+)
+
+// SetPromptCache makes the daemon keep a summary of its leases at path for
+// 'env-lease prompt'.
+func (d *Daemon) SetPromptCache(path string) {
+	d.promptCache = path
+}
+
+// writePromptCache rewrites the prompt cache from the state. Failing to write
+// it only affects the prompt, so errors are logged. The caller must hold
+// d.mu.
+func (d *Daemon) writePromptCache() {
+	if d.promptCache == "" {
+		return
+	}
+	if err := promptcache.Write(d.promptCache, d.promptSummary()); err != nil {
+		slog.Warn("Failed to write prompt cache", "path", d.promptCache, "err", err)
+	}
+}
+
+// removePromptCache removes the prompt cache when the daemon stops, so the
+// prompt does not go on showing leases nothing is tracking.
+func (d *Daemon) removePromptCache() {
+	if d.promptCache == "" {
+		return
+	}
+	if err := os.Remove(d.promptCache); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to remove prompt cache", "path", d.promptCache, "err", err)
+	}
+}
+
+// promptSummary counts leases the way 'env-lease status' does: the children
+// of an exploded lease, but not the parent itself.
+func (d *Daemon) promptSummary() promptcache.Cache {
+	parents := make(map[string]struct{})
+	for _, lease := range d.state.Leases {
+		if lease.ParentSource != "" {
+			parents[lease.ParentSource] = struct{}{}
+		}
+	}
+
+	projects := make(map[string]promptcache.Project)
+	for _, lease := range d.state.Leases {
+		if _, isParent := parents[lease.Source+"->"+lease.Destination]; isParent && lease.ParentSource == "" {
+			continue
+		}
+		project := projects[lease.ConfigFile]
+		project.Expires = append(project.Expires, lease.ExpiresAt)
+		projects[lease.ConfigFile] = project
+	}
+	for _, items := range [][]RetryItem{d.state.RetryQueue, d.state.DeadLetters} {
+		for _, item := range items {
+			project := projects[item.Lease.ConfigFile]
+			project.Failed++
+			projects[item.Lease.ConfigFile] = project
+		}
+	}
+	for _, project := range projects {
+		slices.SortFunc(project.Expires, time.Time.Compare)
+	}
+	return promptcache.Cache{UpdatedAt: d.clock.Now(), Projects: projects}
+}
@@ -0,0 +1,65 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/promptcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDaemon_writePromptCache(t *testing.T) {
+	clock := &mockClock{now: time.Now()}
+	app := "/work/app/env-lease.toml"
+	state := NewState()
+	state.Leases["parent"] = &config.Lease{Source: "op://vault/app/env", Destination: "/work/app/.envrc", ConfigFile: app, ExpiresAt: clock.Now().Add(time.Hour)}
+	state.Leases["child-a"] = &config.Lease{Source: "op://vault/app/env", Destination: "/work/app/.envrc", Variable: "A", ParentSource: "op://vault/app/env->/work/app/.envrc", ConfigFile: app, ExpiresAt: clock.Now().Add(time.Hour)}
+	state.Leases["child-b"] = &config.Lease{Source: "op://vault/app/env", Destination: "/work/app/.envrc", Variable: "B", ParentSource: "op://vault/app/env->/work/app/.envrc", ConfigFile: app, ExpiresAt: clock.Now().Add(time.Hour)}
+	state.Leases["cert"] = &config.Lease{Source: "op://vault/app/cert", Destination: "/work/app/cert.pem", LeaseType: "file", ConfigFile: app, ExpiresAt: clock.Now().Add(time.Minute)}
+	state.RetryQueue = []RetryItem{{Lease: &config.Lease{ConfigFile: "/work/lib/env-lease.toml"}}}
+
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "prompt.json")
+	d := NewDaemon(state, filepath.Join(dir, "state.json"), clock, nil, &mockRevoker{}, nil)
+	d.SetPromptCache(cachePath)
+
+	d.mu.Lock()
+	require.NoError(t, d.saveState())
+	d.mu.Unlock()
+
+	cache, err := promptcache.Read(cachePath)
+	require.NoError(t, err)
+	// The exploded parent isn't counted, and the first expiry comes first.
+	expires := cache.Projects[app].Expires
+	require.Len(t, expires, 3)
+	assert.True(t, expires[0].Equal(clock.Now().Add(time.Minute)))
+	assert.True(t, expires[2].Equal(clock.Now().Add(time.Hour)))
+	assert.Equal(t, 1, cache.Projects["/work/lib/env-lease.toml"].Failed)
+}
+
+func TestDaemon_ShutdownRemovesPromptCache(t *testing.T) {
+	for _, policy := range []string{config.ShutdownPolicyRevoke, config.ShutdownPolicyPersist} {
+		t.Run(policy, func(t *testing.T) {
+			state := NewState()
+			state.Leases["env"] = &config.Lease{Source: "op://vault/app/env", LeaseType: "shell", ConfigFile: "/work/app/env-lease.toml", ExpiresAt: time.Now().Add(time.Hour)}
+			dir := t.TempDir()
+			cachePath := filepath.Join(dir, "prompt.json")
+			d := NewDaemon(state, filepath.Join(dir, "state.json"), &mockClock{now: time.Now()}, nil, &mockRevoker{}, nil)
+			d.SetPromptCache(cachePath)
+			d.SetShutdownPolicy(policy)
+			d.mu.Lock()
+			require.NoError(t, d.saveState())
+			d.mu.Unlock()
+			require.FileExists(t, cachePath)
+
+			require.NoError(t, d.Shutdown())
+
+			_, err := os.Stat(cachePath)
+			assert.True(t, os.IsNotExist(err), "prompt cache should be removed on shutdown")
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/fileutil"
+	"github.com/mblarsen/env-lease/internal/ipc"
+)
+
+const (
+	retryBaseDelay = 2 * time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
+// failureMarkerSuffix is appended to a lease destination to name the file that
+// tells the user a secret could not be removed.
+const failureMarkerSuffix = ".env-lease-REVOCATION-FAILURE"
+
+// equalJitter returns a random duration between d/2 and d so that many failing
+// revocations don't retry in lockstep.
+func equalJitter(d time.Duration) time.Duration {
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + rand.N(half)
+}
+
+// retryBackoff returns the delay before the given attempt, doubling from
+// retryBaseDelay up to retryMaxDelay.
+func (d *Daemon) retryBackoff(attempt int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return d.jitter(delay)
+}
+
+func revokeRetryItem(revoker Revoker, item RetryItem) error {
+	if item.Lease.LeaseType == "shell" {
+		return nil
+	}
+	return revoker.Revoke(item.Lease)
+}
+
+func (d *Daemon) processRetryQueue() {
+	slog.Debug("Processing retry queue...")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now()
+	stateChanged := false
+	for i := len(d.state.RetryQueue) - 1; i >= 0; i-- {
+		item := d.state.RetryQueue[i]
+		if !now.After(item.NextRetryTime) {
+			continue
+		}
+		stateChanged = true
+
+		err := revokeRetryItem(d.revoker, item)
+		if err == nil {
+			// Success, remove from queue
+			d.state.RetryQueue = append(d.state.RetryQueue[:i], d.state.RetryQueue[i+1:]...)
+			slog.Info("Revoked lease from retry queue", "source", item.Lease.Source, "attempts", item.Attempts+1)
+			d.emit(ipc.EventRevoked, item.Lease, fmt.Sprintf("Revoked after %d attempts.", item.Attempts+1))
+			continue
+		}
+
+		item.Attempts++
+		item.LastError = err.Error()
+		if item.Attempts < d.maxRetryAttempts {
+			item.NextRetryTime = now.Add(d.retryBackoff(item.Attempts))
+			d.state.RetryQueue[i] = item
+			d.emit(ipc.EventRevokeFailed, item.Lease, err.Error())
+			continue
+		}
+
+		d.state.RetryQueue = append(d.state.RetryQueue[:i], d.state.RetryQueue[i+1:]...)
+		d.deadLetter(item, now)
+	}
+
+	if stateChanged {
+		if err := d.saveState(); err != nil {
+			slog.Error("Failed to save state after processing retry queue", "err", err)
+		}
+	}
+	slog.Debug("Finished processing retry queue.")
+}
+
+// deadLetter stops retrying an item. The user is told once, through a
+// notification and a marker file next to the destination.
+func (d *Daemon) deadLetter(item RetryItem, now time.Time) {
+	slog.Error("Giving up on revoking lease", "source", item.Lease.Source, "destination", item.Lease.Destination, "attempts", item.Attempts, "err", item.LastError)
+	d.state.DeadLetters = append(d.state.DeadLetters, item)
+
+	message := fmt.Sprintf("Gave up revoking %s after %d attempts: %s", item.Lease.Source, item.Attempts, item.LastError)
+	d.emit(ipc.EventRevokeFailed, item.Lease, message)
+
+	if item.Lease.Destination != "" && item.Lease.LeaseType != "shell" {
+		failureFile := item.Lease.Destination + failureMarkerSuffix
+		content := fmt.Sprintf("Failed to revoke lease for %s at %s: %s\nRun 'env-lease status --failed' and 'env-lease retry' once the problem is fixed.\n",
+			item.Lease.Source, now.Format(time.RFC3339), item.LastError)
+		if _, err := fileutil.AtomicWriteFile(failureFile, []byte(content), 0644); err != nil {
+			slog.Error("Failed to write revocation failure file", "path", failureFile, "err", err)
+		}
+	}
+
+	if d.notifier != nil {
+		if err := d.notifier.Notify("Revocation Failed", fmt.Sprintf("Could not remove the secret for %s. Run 'env-lease status --failed'.", item.Lease.Source)); err != nil {
+			slog.Error("Failed to send notification", "err", err)
+		}
+	}
+}
+
+func (d *Daemon) handleRetry(ctx context.Context, payload []byte) ([]byte, error) {
+	var req ipc.RetryRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal retry request: %w", err)
+	}
+	slog.Debug("Received retry request", "config_file", req.ConfigFile, "all", req.All)
+
+	matches := func(item RetryItem) bool {
+		return req.All || item.Lease.ConfigFile == req.ConfigFile
+	}
+
+	var revoked, failed int
+	retry := func(items []RetryItem) []RetryItem {
+		kept := items[:0]
+		for _, item := range items {
+			if item.Lease == nil {
+				continue
+			}
+			if !matches(item) {
+				kept = append(kept, item)
+				continue
+			}
+			if err := revokeRetryItem(d.revoker, item); err != nil {
+				item.Attempts++
+				item.LastError = err.Error()
+				kept = append(kept, item)
+				failed++
+				d.emitFor(ctx, ipc.EventRevokeFailed, item.Lease, err.Error())
+				continue
+			}
+			revoked++
+			if err := os.Remove(item.Lease.Destination + failureMarkerSuffix); err != nil && !os.IsNotExist(err) {
+				slog.Warn("Failed to remove revocation failure file", "destination", item.Lease.Destination, "err", err)
+			}
+			d.emitFor(ctx, ipc.EventRevoked, item.Lease, "Revoked on manual retry.")
+		}
+		return kept
+	}
+	d.state.RetryQueue = retry(d.state.RetryQueue)
+	d.state.DeadLetters = retry(d.state.DeadLetters)
+
+	if err := d.saveState(); err != nil {
+		slog.Error("Failed to save state after retry", "err", err)
+	}
+
+	resp := ipc.RetryResponse{
+		Messages: []string{fmt.Sprintf("Revoked %d leases; %d still failing.", revoked, failed)},
+		Failed:   d.failedRevocations(req.ConfigFile, req.All),
+	}
+	return json.Marshal(resp)
+}
+
+// failedRevocations lists queued and dead-lettered revocations for a project,
+// or for all projects.
+func (d *Daemon) failedRevocations(configFile string, all bool) []ipc.FailedRevocation {
+	var failed []ipc.FailedRevocation
+	add := func(items []RetryItem, deadLetter bool) {
+		for _, item := range items {
+			if item.Lease == nil || (!all && configFile != "" && item.Lease.ConfigFile != configFile) {
+				continue
+			}
+			failed = append(failed, ipc.FailedRevocation{
+				Lease:          leaseToIPC(item.Lease),
+				Attempts:       item.Attempts,
+				NextRetryTime:  item.NextRetryTime,
+				InitialFailure: item.InitialFailure,
+				LastError:      item.LastError,
+				DeadLetter:     deadLetter,
+			})
+		}
+	}
+	add(d.state.RetryQueue, false)
+	add(d.state.DeadLetters, true)
+	return failed
+}
+
+func leaseToIPC(l *config.Lease) ipc.Lease {
+	return ipc.Lease{
+		Source:       l.Source,
+		Destination:  l.Destination,
+		Duration:     l.Duration,
+		LeaseType:    l.LeaseType,
+		Variable:     l.Variable,
+		Format:       l.Format,
+		Transform:    l.Transform,
+		FileMode:     l.FileMode,
+		ExpiresAt:    l.ExpiresAt,
+		ConfigFile:   l.ConfigFile,
+		OpAccount:    l.OpAccount,
+		ParentSource: l.ParentSource,
+		RevokeOnLock: l.RevokeOnLock,
+		IdleTimeout:  l.IdleTimeout,
+	}
+}
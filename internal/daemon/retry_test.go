@@ -0,0 +1,97 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDaemon_retryBackoff(t *testing.T) {
+	d := NewDaemon(nil, "/dev/null", &mockClock{}, nil, &mockRevoker{}, nil)
+	d.jitter = func(delay time.Duration) time.Duration { return delay }
+
+	assert.Equal(t, 2*time.Second, d.retryBackoff(1))
+	assert.Equal(t, 4*time.Second, d.retryBackoff(2))
+	assert.Equal(t, 8*time.Second, d.retryBackoff(3))
+	assert.Equal(t, retryMaxDelay, d.retryBackoff(20))
+}
+
+func TestEqualJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		got := equalJitter(10 * time.Second)
+		assert.GreaterOrEqual(t, got, 5*time.Second)
+		assert.Less(t, got, 10*time.Second)
+	}
+}
+
+func TestDaemon_processRetryQueue_DeadLettersAfterMaxAttempts(t *testing.T) {
+	tempDir := t.TempDir()
+	now := time.Now()
+	destination := filepath.Join(tempDir, ".envrc")
+
+	state := NewState()
+	state.RetryQueue = []RetryItem{
+		{
+			Lease:          &config.Lease{Source: "op://vault/item/field", Destination: destination, LeaseType: "env"},
+			Attempts:       2,
+			NextRetryTime:  now.Add(-time.Second),
+			InitialFailure: now.Add(-time.Minute),
+		},
+	}
+	revoker := &mockRevoker{RevokeFunc: func(*config.Lease) error { return fmt.Errorf("permission denied") }}
+	notifier := &mockNotifier{}
+	d := NewDaemon(state, filepath.Join(tempDir, "state.json"), &mockClock{now: now}, nil, revoker, notifier)
+	d.SetMaxRetryAttempts(3)
+
+	d.processRetryQueue()
+
+	assert.Empty(t, state.RetryQueue)
+	require.Len(t, state.DeadLetters, 1)
+	assert.Equal(t, 3, state.DeadLetters[0].Attempts)
+	assert.Equal(t, "permission denied", state.DeadLetters[0].LastError)
+	assert.Equal(t, 1, notifier.NotifyCount)
+	_, err := os.Stat(destination + failureMarkerSuffix)
+	assert.NoError(t, err, "failure marker should be written")
+
+	// Dead letters are not retried automatically.
+	d.clock.(*mockClock).Advance(time.Hour)
+	d.processRetryQueue()
+	assert.Equal(t, 1, revoker.RevokeCount)
+	assert.Equal(t, 1, notifier.NotifyCount)
+}
+
+func TestHandleRetry_RevokesDeadLetters(t *testing.T) {
+	tempDir := t.TempDir()
+	destination := filepath.Join(tempDir, ".envrc")
+	require.NoError(t, os.WriteFile(destination+failureMarkerSuffix, []byte("failed"), 0644))
+
+	state := NewState()
+	state.DeadLetters = []RetryItem{
+		{Lease: &config.Lease{Source: "mine", Destination: destination, LeaseType: "env", ConfigFile: "/a/env-lease.toml"}, Attempts: 10},
+		{Lease: &config.Lease{Source: "other", Destination: "/b/.envrc", LeaseType: "env", ConfigFile: "/b/env-lease.toml"}, Attempts: 10},
+	}
+	revoker := &mockRevoker{}
+	d := NewDaemon(state, filepath.Join(tempDir, "state.json"), &mockClock{now: time.Now()}, nil, revoker, nil)
+
+	payload, _ := json.Marshal(ipc.RetryRequest{Command: "retry", ConfigFile: "/a/env-lease.toml"})
+	respPayload, err := d.handleRetry(context.Background(), payload)
+	require.NoError(t, err)
+
+	var resp ipc.RetryResponse
+	require.NoError(t, json.Unmarshal(respPayload, &resp))
+	assert.Empty(t, resp.Failed)
+	assert.Equal(t, 1, revoker.RevokeCount)
+	require.Len(t, state.DeadLetters, 1)
+	assert.Equal(t, "other", state.DeadLetters[0].Lease.Source)
+	_, err = os.Stat(destination + failureMarkerSuffix)
+	assert.True(t, os.IsNotExist(err), "failure marker should be removed")
+}
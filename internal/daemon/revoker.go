@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/envfile"
 	"github.com/mblarsen/env-lease/internal/fileutil"
 )
 
@@ -32,12 +33,41 @@ func (r *FileRevoker) Revoke(lease *config.Lease) error {
 		return os.Remove(lease.Destination)
 	case "env":
 		slog.Debug("Revoking env lease", "path", lease.Destination, "variable", lease.Variable)
+		if dialect, ok := envfile.Lookup(lease.Format); ok {
+			return r.clearDialectVar(lease.Destination, lease.Variable, dialect)
+		}
 		return r.clearEnvVar(lease.Destination, lease.Variable)
 	default:
 		return fmt.Errorf("unknown lease type: %s", lease.LeaseType)
 	}
 }
 
+// clearDialectVar empties a variable written in a named format dialect,
+// parsing the file the same way it was written.
+func (r *FileRevoker) clearDialectVar(path, keyToRevoke string, dialect envfile.Dialect) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // File is already gone, consider it revoked.
+		}
+		return err
+	}
+	if _, ok, err := envfile.Get(dialect, content, keyToRevoke); err != nil || !ok {
+		return err
+	}
+	out, err := dialect.Set(content, keyToRevoke, "")
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	_, err = fileutil.AtomicWriteFile(path, out, info.Mode())
+	return err
+}
+
 func (r *FileRevoker) clearEnvVar(path, keyToRevoke string) error {
 	f, err := os.Open(path)
 	if err != nil {
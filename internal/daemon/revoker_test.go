@@ -36,6 +36,31 @@ func TestFileRevoker_Revoke(t *testing.T) {
 		}
 	})
 
+	t.Run("env lease in a format dialect", func(t *testing.T) {
+		filePath := filepath.Join(tempDir, ".envrc")
+		content := "# project\nexport API_KEY='multi\nline '\\''secret'\\'''\nexport OTHER='kept'\n"
+		if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+
+		lease := &config.Lease{
+			LeaseType:   "env",
+			Destination: filePath,
+			Variable:    "API_KEY",
+			Format:      "posix-sh",
+		}
+		revoker := &FileRevoker{}
+		if err := revoker.Revoke(lease); err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		got, _ := os.ReadFile(filePath)
+		expected := "# project\nexport API_KEY=''\nexport OTHER='kept'\n"
+		if string(got) != expected {
+			t.Fatalf("expected %q, got %q", expected, string(got))
+		}
+	})
+
 	t.Run("file lease, file already deleted", func(t *testing.T) {
 		filePath := filepath.Join(tempDir, "already-deleted.txt")
 
@@ -40,7 +40,7 @@ func TestDaemonServer(t *testing.T) {
 				{Source: "test", Destination: "test.txt", Duration: "1h"},
 			},
 		}
-		if err := client.Send(req, nil); err != nil {
+		if err := client.Send(context.Background(), req, nil); err != nil {
 			t.Fatalf("failed to send grant request: %v", err)
 		}
 
@@ -53,7 +53,7 @@ func TestDaemonServer(t *testing.T) {
 
 	t.Run("revoke lease", func(t *testing.T) {
 		req := struct{ Command string }{Command: "revoke"}
-		if err := client.Send(req, nil); err != nil {
+		if err := client.Send(context.Background(), req, nil); err != nil {
 			t.Fatalf("failed to send revoke request: %v", err)
 		}
 
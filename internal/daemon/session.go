@@ -0,0 +1,94 @@
+package daemon
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/mblarsen/env-lease/internal/config"
+)
+
+// Session event kinds.
+const (
+	// SessionLock is sent when the screen of one of the user's sessions locks.
+	SessionLock = "lock"
+	// SessionSleep is sent when the system is about to suspend or hibernate.
+	SessionSleep = "sleep"
+	// SessionLogout is sent when the user's last session ends.
+	SessionLogout = "logout"
+)
+
+// SessionEvent is a change in the user's session that leases may be revoked
+// on.
+type SessionEvent struct {
+	Kind string
+	// Session is the ID of the session the event is about, if any.
+	Session string
+
+	done func()
+}
+
+// Done tells the watcher the event has been handled. For SessionSleep it
+// releases the inhibitor that holds off the suspend.
+func (e SessionEvent) Done() {
+	if e.done != nil {
+		e.done()
+	}
+}
+
+// SessionWatcher delivers session events to the daemon.
+type SessionWatcher interface {
+	Events() <-chan SessionEvent
+	Close() error
+}
+
+// SetSessionWatcher sets the source of session events and which leases they
+// revoke. See the config.SessionRevoke* constants.
+func (d *Daemon) SetSessionWatcher(watcher SessionWatcher, policy string) {
+	d.sessionWatcher = watcher
+	d.sessionPolicy = policy
+}
+
+// sessionEvents returns the watcher's events, or nil, which blocks forever,
+// when there is no watcher.
+func (d *Daemon) sessionEvents() <-chan SessionEvent {
+	if d.sessionWatcher == nil || d.sessionPolicy == config.SessionRevokeOff {
+		return nil
+	}
+	return d.sessionWatcher.Events()
+}
+
+// sessionEventReasons describe why a lease was revoked, by event kind.
+var sessionEventReasons = map[string]string{
+	SessionLock:   "screen lock",
+	SessionSleep:  "suspend",
+	SessionLogout: "logout",
+}
+
+// handleSessionEvent revokes the leases the session policy covers.
+func (d *Daemon) handleSessionEvent(ev SessionEvent) {
+	defer ev.Done()
+	reason, ok := sessionEventReasons[ev.Kind]
+	if !ok {
+		return
+	}
+	slog.Info("Received session event", "kind", ev.Kind, "session", ev.Session)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	revoked, failed := d.revokeMatching(func(lease *config.Lease) bool {
+		return d.sessionPolicy == config.SessionRevokeAll || lease.RevokeOnLock
+	}, fmt.Sprintf("Revoked on %s.", reason))
+	if len(revoked)+failed == 0 {
+		return
+	}
+
+	if err := d.saveState(); err != nil {
+		slog.Error("Failed to save state after session event", "err", err)
+	}
+	if len(revoked) > 0 && d.notifier != nil {
+		if err := d.notifier.Notify("Leases Revoked", fmt.Sprintf("Revoked %d lease(s) on %s.", len(revoked), reason)); err != nil {
+			slog.Error("Failed to send notification", "err", err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package daemon
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDaemon_handleSessionEvent(t *testing.T) {
+	newState := func() *State {
+		state := NewState()
+		state.Leases["marked"] = &config.Lease{
+			Source:       "onepassword://vault/item/marked",
+			Destination:  "/tmp/marked",
+			LeaseType:    "file",
+			ExpiresAt:    time.Now().Add(time.Hour),
+			RevokeOnLock: true,
+		}
+		state.Leases["unmarked"] = &config.Lease{
+			Source:      "onepassword://vault/item/unmarked",
+			Destination: "/tmp/unmarked",
+			LeaseType:   "file",
+			ExpiresAt:   time.Now().Add(time.Hour),
+		}
+		return state
+	}
+
+	tests := []struct {
+		name   string
+		policy string
+		kind   string
+		want   []string
+	}{
+		{name: "marked", policy: config.SessionRevokeMarked, kind: SessionLock, want: []string{"unmarked"}},
+		{name: "all", policy: config.SessionRevokeAll, kind: SessionSleep, want: []string{}},
+		{name: "unknown kind", policy: config.SessionRevokeAll, kind: "unlock", want: []string{"marked", "unmarked"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statePath := filepath.Join(t.TempDir(), "state.json")
+			notifier := &mockNotifier{}
+			d := NewDaemon(newState(), statePath, &mockClock{now: time.Now()}, nil, &mockRevoker{}, notifier)
+			d.SetSessionWatcher(nil, tt.policy)
+
+			done := false
+			d.handleSessionEvent(SessionEvent{Kind: tt.kind, done: func() { done = true }})
+
+			assert.True(t, done, "event should be marked done")
+			remaining := []string{}
+			for id := range d.state.Leases {
+				remaining = append(remaining, id)
+			}
+			assert.ElementsMatch(t, tt.want, remaining)
+			if len(tt.want) < 2 {
+				assert.Equal(t, "Leases Revoked", notifier.LastTitle)
+				reloaded, err := LoadState(statePath)
+				require.NoError(t, err)
+				assert.Len(t, reloaded.Leases, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestDaemon_handleSessionEvent_QueuesFailedRevocations(t *testing.T) {
+	state := NewState()
+	state.Leases["marked"] = &config.Lease{
+		Source:       "onepassword://vault/item/marked",
+		Destination:  "/tmp/marked",
+		LeaseType:    "file",
+		ExpiresAt:    time.Now().Add(time.Hour),
+		RevokeOnLock: true,
+	}
+	revoker := &mockRevoker{RevokeFunc: func(*config.Lease) error { return errors.New("busy") }}
+	d := NewDaemon(state, filepath.Join(t.TempDir(), "state.json"), &mockClock{now: time.Now()}, nil, revoker, nil)
+
+	d.handleSessionEvent(SessionEvent{Kind: SessionLogout})
+
+	assert.Empty(t, d.state.Leases)
+	require.Len(t, d.state.RetryQueue, 1)
+	assert.Equal(t, "busy", d.state.RetryQueue[0].LastError)
+}
@@ -0,0 +1,7 @@
+package daemon
+
+// ShutdownDetector reports whether the host is shutting down or rebooting, as
+// opposed to only the user session ending.
+type ShutdownDetector interface {
+	SystemShuttingDown() bool
+}
@@ -1,20 +1,21 @@
 package daemon
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
-	"os"
 	"time"
 
 	"github.com/mblarsen/env-lease/internal/config"
-	"github.com/mblarsen/env-lease/internal/fileutil"
 )
 
 // State represents the persistent state of the daemon.
 type State struct {
+	// Version is the schema version of the state file. See StateVersion.
+	Version    int                      `json:"version"`
 	Leases     map[string]*config.Lease `json:"leases"`
 	RetryQueue []RetryItem              `json:"retry_queue"`
+	// DeadLetters holds revocations that kept failing after the maximum
+	// number of retries. They are only retried on request.
+	DeadLetters []RetryItem `json:"dead_letters,omitempty"`
 }
 
 // RetryItem represents a lease that failed to be revoked.
@@ -23,6 +24,7 @@ type RetryItem struct {
 	Attempts       int           `json:"attempts"`
 	NextRetryTime  time.Time     `json:"next_retry_time"`
 	InitialFailure time.Time     `json:"initial_failure"`
+	LastError      string        `json:"last_error,omitempty"`
 }
 
 // ErrMalformedState indicates the state file contains invalid JSON payload data.
@@ -31,6 +33,7 @@ var ErrMalformedState = errors.New("malformed daemon state file")
 // NewState creates a new, empty state.
 func NewState() *State {
 	return &State{
+		Version:    StateVersion,
 		Leases:     make(map[string]*config.Lease),
 		RetryQueue: make([]RetryItem, 0),
 	}
@@ -54,35 +57,15 @@ func normalizeState(state *State) *State {
 	return state
 }
 
-// LoadState loads the daemon state from a file.
+// LoadState loads the daemon state from a plaintext or encrypted file. Use a
+// StateStore to decrypt files encrypted with a key.
 func LoadState(path string) (*State, error) {
-	data, err := os.ReadFile(path)
-	if os.IsNotExist(err) {
-		return NewState(), nil
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	if len(data) == 0 {
-		return NewState(), nil
-	}
-
-	var state State
-	if err := json.Unmarshal(data, &state); err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrMalformedState, err)
-	}
-	return normalizeState(&state), nil
+	return NewStateStore(path, config.StateEncryptionOff, nil).Load()
 }
 
-// SaveState saves the daemon state to a file.
+// SaveState saves the daemon state to a plaintext file.
 func (s *State) SaveState(path string) error {
-	data, err := json.MarshalIndent(s, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal state: %w", err)
-	}
-	_, err = fileutil.AtomicWriteFile(path, data, 0600)
-	return err
+	return NewStateStore(path, config.StateEncryptionOff, nil).Save(s)
 }
 
 func (s *State) LeasesForConfigFile(configFile string) map[string]*config.Lease {
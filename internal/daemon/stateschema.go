@@ -0,0 +1,161 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mblarsen/env-lease/internal/config"
+)
+
+// StateVersion is the schema version of the state files written by this
+// build. Bump it and append to stateMigrations whenever the JSON shape of
+// State, or of a config.Lease inside it, changes.
+const StateVersion = 1
+
+// stateMigrations upgrade the raw JSON of a state file one schema version at
+// a time: stateMigrations[v] turns version v into version v+1.
+var stateMigrations = []func(raw map[string]json.RawMessage) error{
+	// 0 -> 1: files written before the version field existed. Nothing else
+	// changed.
+	func(map[string]json.RawMessage) error { return nil },
+}
+
+// ErrNewerState indicates the state file was written by a newer version of
+// env-lease. It is never discarded, as that would orphan its leases.
+var ErrNewerState = errors.New("daemon state file is from a newer version of env-lease")
+
+// SalvageError is returned with a partially recovered state when the state
+// file is malformed. Leases that could be decoded are kept; Lost lists the
+// destinations of the ones that could not, so their secrets can be removed by
+// hand.
+type SalvageError struct {
+	Recovered int
+	Lost      []string
+	Cause     error
+}
+
+func (e *SalvageError) Error() string {
+	return fmt.Sprintf("%v: recovered %d lease(s), lost %d: %v", ErrMalformedState, e.Recovered, len(e.Lost), e.Cause)
+}
+
+// Unwrap makes a SalvageError match ErrMalformedState.
+func (e *SalvageError) Unwrap() error {
+	return ErrMalformedState
+}
+
+// decodeState parses a plaintext state file, migrating it to StateVersion. If
+// the file is malformed it returns whatever could be salvaged together with a
+// *SalvageError.
+func decodeState(data []byte) (*State, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return salvageState(data, nil, err)
+	}
+
+	version := 0
+	if v, ok := raw["version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil || version < 0 {
+			return salvageState(data, raw, fmt.Errorf("invalid version %s", v))
+		}
+	}
+	if version > StateVersion {
+		return nil, fmt.Errorf("%w: schema version %d, this build supports up to %d; upgrade env-lease", ErrNewerState, version, StateVersion)
+	}
+	for v := version; v < StateVersion; v++ {
+		if err := stateMigrations[v](raw); err != nil {
+			return salvageState(data, raw, fmt.Errorf("migrating from version %d: %w", v, err))
+		}
+	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return salvageState(data, raw, err)
+	}
+	var state State
+	if err := json.Unmarshal(migrated, &state); err != nil {
+		return salvageState(data, raw, err)
+	}
+	state.Version = StateVersion
+	return normalizeState(&state), nil
+}
+
+// salvageState recovers every lease and retry item that decodes on its own.
+// raw is nil when the file is not a JSON object at all, in which case only
+// the destinations of the lost leases can be recovered.
+func salvageState(data []byte, raw map[string]json.RawMessage, cause error) (*State, error) {
+	state := NewState()
+	salvage := &SalvageError{Cause: cause}
+	if raw == nil {
+		salvage.Lost = scanDestinations(data)
+		return state, salvage
+	}
+
+	if entries, ok := raw["leases"]; ok {
+		var leases map[string]json.RawMessage
+		if err := json.Unmarshal(entries, &leases); err != nil {
+			salvage.Lost = append(salvage.Lost, scanDestinations(entries)...)
+		}
+		for key, entry := range leases {
+			var lease config.Lease
+			if err := json.Unmarshal(entry, &lease); err != nil {
+				salvage.Lost = append(salvage.Lost, lostDestination(entry))
+				continue
+			}
+			state.Leases[key] = &lease
+		}
+	}
+	state.RetryQueue = salvageRetryItems(raw["retry_queue"], salvage)
+	state.DeadLetters = salvageRetryItems(raw["dead_letters"], salvage)
+
+	salvage.Recovered = len(state.Leases) + len(state.RetryQueue) + len(state.DeadLetters)
+	return normalizeState(state), salvage
+}
+
+func salvageRetryItems(data json.RawMessage, salvage *SalvageError) []RetryItem {
+	if len(data) == 0 {
+		return nil
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		salvage.Lost = append(salvage.Lost, scanDestinations(data)...)
+		return nil
+	}
+	var items []RetryItem
+	for _, entry := range entries {
+		var item RetryItem
+		if err := json.Unmarshal(entry, &item); err != nil || item.Lease == nil {
+			salvage.Lost = append(salvage.Lost, lostDestination(entry))
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// lostDestination describes a lease entry that could not be decoded by the
+// destination it was written to.
+func lostDestination(entry json.RawMessage) string {
+	if destinations := scanDestinations(entry); len(destinations) > 0 {
+		return destinations[0]
+	}
+	return "unknown destination"
+}
+
+var destinationPattern = regexp.MustCompile(`(?i)"destination"\s*:\s*("(?:[^"\\]|\\.)*")`)
+
+// scanDestinations finds lease destinations in data without parsing it, so
+// they can be reported even from a truncated file.
+func scanDestinations(data []byte) []string {
+	var destinations []string
+	for _, match := range destinationPattern.FindAllSubmatch(data, -1) {
+		var destination string
+		if err := json.Unmarshal(match[1], &destination); err != nil || strings.TrimSpace(destination) == "" {
+			continue
+		}
+		destinations = append(destinations, destination)
+	}
+	return destinations
+}
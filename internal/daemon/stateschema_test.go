@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateMigrationsCoverEveryVersion(t *testing.T) {
+	assert.Len(t, stateMigrations, StateVersion)
+}
+
+func TestLoadState_MigratesUnversionedState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"leases": {"lease1": {"source": "op://vault/item/field"}}, "retry_queue": []}`), 0600))
+
+	state, err := LoadState(path)
+	require.NoError(t, err)
+	assert.Equal(t, StateVersion, state.Version)
+	require.Contains(t, state.Leases, "lease1")
+}
+
+func TestLoadState_RejectsNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 99, "leases": {}}`), 0600))
+
+	_, err := LoadState(path)
+	assert.ErrorIs(t, err, ErrNewerState)
+	assert.False(t, IsCorruptStateError(err))
+}
+
+func TestLoadState_SalvagesDecodableLeases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	data := `{
+  "version": 1,
+  "leases": {
+    "good": {"Source": "op://vault/item/good", "Destination": "/project/.env"},
+    "bad": {"Source": "op://vault/item/bad", "Destination": "/project/.envrc", "expires_at": 5}
+  },
+  "retry_queue": [
+    {"lease": {"Source": "op://vault/item/retry", "Destination": "/project/retry.env"}, "attempts": 2},
+    {"lease": {"Source": 7, "Destination": "/project/broken.env"}}
+  ]
+}`
+	require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+
+	state, err := LoadState(path)
+
+	var salvage *SalvageError
+	require.True(t, errors.As(err, &salvage), "expected a SalvageError, got %v", err)
+	assert.True(t, IsCorruptStateError(err))
+	assert.Equal(t, 2, salvage.Recovered)
+	assert.ElementsMatch(t, []string{"/project/.envrc", "/project/broken.env"}, salvage.Lost)
+	require.NotNil(t, state)
+	assert.Contains(t, state.Leases, "good")
+	assert.NotContains(t, state.Leases, "bad")
+	require.Len(t, state.RetryQueue, 1)
+	assert.Equal(t, 2, state.RetryQueue[0].Attempts)
+}
+
+func TestLoadState_ReportsDestinationsOfTruncatedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	data, err := json.Marshal(State{
+		Version: StateVersion,
+		Leases: map[string]*config.Lease{
+			"a": {Source: "op://vault/item/field", Destination: "/project/.env", LeaseType: "env", Variable: "API_KEY"},
+		},
+	})
+	require.NoError(t, err)
+	// Cut the file off right after the destination, like an interrupted write.
+	end := bytes.Index(data, []byte(`/project/.env"`)) + len(`/project/.env"`)
+	require.NoError(t, os.WriteFile(path, data[:end], 0600))
+
+	state, err := LoadState(path)
+
+	var salvage *SalvageError
+	require.True(t, errors.As(err, &salvage))
+	assert.Equal(t, []string{"/project/.env"}, salvage.Lost)
+	assert.Empty(t, state.Leases)
+}
+
+func TestStateStore_Quarantine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0600))
+
+	quarantined, err := NewStateStore(path, "", nil).Quarantine()
+	require.NoError(t, err)
+	assert.NoFileExists(t, path)
+	assert.FileExists(t, quarantined)
+	assert.Equal(t, dir, filepath.Dir(quarantined))
+}
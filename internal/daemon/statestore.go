@@ -0,0 +1,279 @@
+package daemon
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/fileutil"
+	"github.com/mblarsen/env-lease/internal/keyring"
+)
+
+// encryptedStateVersion is the version of the encrypted state envelope
+// written by this build.
+const encryptedStateVersion = 1
+
+// stateKeyInfo is the HKDF info string used to derive the state key from
+// auth.token, so the derived key is never usable as the IPC secret.
+const stateKeyInfo = "env-lease state encryption v1"
+
+// keyringService is the keyring service the state key is stored under when
+// state_encryption = "keyring".
+const keyringService = "env-lease"
+
+// ErrStateKey indicates the state file could not be decrypted, either because
+// the key is unavailable or because it does not match the one the file was
+// written with.
+var ErrStateKey = errors.New("cannot decrypt daemon state file")
+
+// encryptedState is the on-disk envelope for an encrypted state file.
+type encryptedState struct {
+	Version    int    `json:"encrypted_state"`
+	KeySource  string `json:"key_source"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// KeyFunc returns the 32-byte key for a key source ("token" or "keyring").
+// create is true only when no state file is encrypted with that source yet,
+// so a key that is stored rather than derived may be generated. A missing
+// key must never be replaced while a file still needs it.
+type KeyFunc func(source string, create bool) ([]byte, error)
+
+// StateStore reads and writes the daemon state file, optionally encrypting
+// it at rest with AES-256-GCM.
+type StateStore struct {
+	path       string
+	encryption string
+	keyFunc    KeyFunc
+
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+// NewStateStore returns a store for the state file at path. encryption is one
+// of the config.StateEncryption* values; keyFunc supplies the key and may be
+// nil when encryption is off and no encrypted file is expected.
+func NewStateStore(path, encryption string, keyFunc KeyFunc) *StateStore {
+	if encryption == "" {
+		encryption = config.StateEncryptionOff
+	}
+	return &StateStore{
+		path:       path,
+		encryption: encryption,
+		keyFunc:    keyFunc,
+		keys:       make(map[string][]byte),
+	}
+}
+
+// Path returns the path of the state file.
+func (s *StateStore) Path() string {
+	return s.path
+}
+
+// Load reads the state file and migrates it to the current schema version.
+// If the file is malformed, Load returns the leases it could salvage along
+// with a *SalvageError. Encrypted files are decrypted whatever the
+// configured mode, so turning encryption off still reads existing state. A
+// file that is not in the configured format is rewritten in it, which is how
+// plaintext state is migrated when encryption is first enabled.
+func (s *StateStore) Load() (*State, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return NewState(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return NewState(), nil
+	}
+
+	// A file that is not even a JSON object is left to decodeState to
+	// salvage what it can.
+	var envelope encryptedState
+	_ = json.Unmarshal(data, &envelope)
+
+	source := config.StateEncryptionOff
+	if envelope.Version != 0 {
+		if envelope.Version > encryptedStateVersion {
+			return nil, fmt.Errorf("state file was encrypted by a newer version of env-lease (envelope version %d)", envelope.Version)
+		}
+		source = envelope.KeySource
+		if data, err = s.decrypt(&envelope); err != nil {
+			return nil, err
+		}
+	}
+
+	state, err := decodeState(data)
+	if err != nil {
+		return state, err
+	}
+
+	if source != s.encryption {
+		slog.Info("Migrating state file encryption", "from", source, "to", s.encryption)
+		if err := s.Save(state); err != nil {
+			return nil, fmt.Errorf("failed to migrate state file: %w", err)
+		}
+	}
+	return state, nil
+}
+
+// Save writes state to the state file in the configured format.
+func (s *StateStore) Save(state *State) error {
+	state.Version = StateVersion
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	if s.encryption != config.StateEncryptionOff {
+		if data, err = s.encrypt(data); err != nil {
+			return err
+		}
+	}
+	_, err = fileutil.AtomicWriteFile(s.path, data, 0600)
+	return err
+}
+
+// Quarantine moves the state file aside, so a file that could not be loaded
+// is kept for inspection rather than overwritten. It returns the new path.
+func (s *StateStore) Quarantine() (string, error) {
+	quarantined := fmt.Sprintf("%s.corrupt-%s", s.path, time.Now().UTC().Format("20060102T150405Z"))
+	if err := os.Rename(s.path, quarantined); err != nil {
+		return "", fmt.Errorf("failed to quarantine state file: %w", err)
+	}
+	return quarantined, nil
+}
+
+func (s *StateStore) encrypt(plaintext []byte) ([]byte, error) {
+	gcm, err := s.cipher(s.encryption, !s.encryptedWith(s.encryption))
+	if err != nil {
+		return nil, err
+	}
+	envelope := encryptedState{
+		Version:   encryptedStateVersion,
+		KeySource: s.encryption,
+		Nonce:     make([]byte, gcm.NonceSize()),
+	}
+	if _, err := rand.Read(envelope.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	envelope.Ciphertext = gcm.Seal(nil, envelope.Nonce, plaintext, envelope.additionalData())
+	return json.MarshalIndent(envelope, "", "  ")
+}
+
+func (s *StateStore) decrypt(envelope *encryptedState) ([]byte, error) {
+	gcm, err := s.cipher(envelope.KeySource, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: invalid nonce", ErrMalformedState)
+	}
+	plaintext, err := gcm.Open(nil, envelope.Nonce, envelope.Ciphertext, envelope.additionalData())
+	if err != nil {
+		return nil, fmt.Errorf("%w: key does not match (source %s)", ErrStateKey, envelope.KeySource)
+	}
+	return plaintext, nil
+}
+
+// additionalData binds the envelope version and key source to the
+// ciphertext so neither can be altered without detection.
+func (e *encryptedState) additionalData() []byte {
+	return fmt.Appendf(nil, "env-lease-state\x00%d\x00%s", e.Version, e.KeySource)
+}
+
+// encryptedWith reports whether the state file on disk is encrypted with a
+// key from source.
+func (s *StateStore) encryptedWith(source string) bool {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return false
+	}
+	var envelope encryptedState
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return false
+	}
+	return envelope.Version != 0 && envelope.KeySource == source
+}
+
+func (s *StateStore) cipher(source string, create bool) (cipher.AEAD, error) {
+	key, err := s.key(source, create)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *StateStore) key(source string, create bool) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.keys[source]; ok {
+		return key, nil
+	}
+	if s.keyFunc == nil {
+		return nil, fmt.Errorf("%w: no key available for source '%s'", ErrStateKey, source)
+	}
+	key, err := s.keyFunc(source, create)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStateKey, err)
+	}
+	s.keys[source] = key
+	return key, nil
+}
+
+// StateKeyFunc returns a KeyFunc that derives the "token" key from the IPC
+// secret and keeps the "keyring" key in the OS keyring under keyringAccount,
+// creating it when the first encrypted state file is written.
+func StateKeyFunc(secret []byte, keyringAccount string) KeyFunc {
+	return func(source string, create bool) ([]byte, error) {
+		switch source {
+		case config.StateEncryptionToken:
+			return hkdf.Key(sha256.New, secret, nil, stateKeyInfo, 32)
+		case config.StateEncryptionKeyring:
+			return keyringStateKey(keyringAccount, create)
+		default:
+			return nil, fmt.Errorf("unknown key source '%s'", source)
+		}
+	}
+}
+
+func keyringStateKey(account string, create bool) ([]byte, error) {
+	encoded, err := keyring.Get(keyringService, account)
+	if errors.Is(err, keyring.ErrNotFound) && !create {
+		return nil, fmt.Errorf("state key '%s' is not in the keyring", account)
+	}
+	if errors.Is(err, keyring.ErrNotFound) {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate state key: %w", err)
+		}
+		if err := keyring.Set(keyringService, account, hex.EncodeToString(key)); err != nil {
+			return nil, fmt.Errorf("failed to store state key in keyring: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state key from keyring: %w", err)
+	}
+	key, err := hex.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("state key in keyring is invalid")
+	}
+	return key, nil
+}
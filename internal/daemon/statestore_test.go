@@ -0,0 +1,100 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testState() *State {
+	state := NewState()
+	state.Leases["lease1"] = &config.Lease{Source: "op://vault/item/field", Variable: "API_KEY"}
+	return state
+}
+
+func TestStateStore_EncryptedRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := NewStateStore(path, config.StateEncryptionToken, StateKeyFunc([]byte("secret"), "state-key"))
+
+	require.NoError(t, store.Save(testState()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "op://vault/item/field")
+	assert.Contains(t, string(data), `"encrypted_state": 1`)
+
+	loaded, err := NewStateStore(path, config.StateEncryptionToken, StateKeyFunc([]byte("secret"), "state-key")).Load()
+	require.NoError(t, err)
+	require.Contains(t, loaded.Leases, "lease1")
+	assert.Equal(t, "API_KEY", loaded.Leases["lease1"].Variable)
+}
+
+func TestStateStore_MigratesPlaintextState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, testState().SaveState(path))
+
+	store := NewStateStore(path, config.StateEncryptionToken, StateKeyFunc([]byte("secret"), "state-key"))
+	loaded, err := store.Load()
+	require.NoError(t, err)
+	require.Contains(t, loaded.Leases, "lease1")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "op://vault/item/field")
+
+	// Turning encryption off again decrypts and rewrites the file as plaintext.
+	loaded, err = NewStateStore(path, config.StateEncryptionOff, StateKeyFunc([]byte("secret"), "state-key")).Load()
+	require.NoError(t, err)
+	require.Contains(t, loaded.Leases, "lease1")
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "op://vault/item/field")
+}
+
+func TestStateStore_WrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, NewStateStore(path, config.StateEncryptionToken, StateKeyFunc([]byte("secret"), "state-key")).Save(testState()))
+
+	_, err := NewStateStore(path, config.StateEncryptionToken, StateKeyFunc([]byte("other"), "state-key")).Load()
+	assert.ErrorIs(t, err, ErrStateKey)
+
+	_, err = LoadState(path)
+	assert.ErrorIs(t, err, ErrStateKey)
+}
+
+func TestStateStore_KeyUnavailable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	keyFunc := func(string, bool) ([]byte, error) { return nil, errors.New("keyring locked") }
+
+	err := NewStateStore(path, config.StateEncryptionKeyring, keyFunc).Save(testState())
+	assert.ErrorIs(t, err, ErrStateKey)
+}
+
+func TestStateStore_CreatesKeyOnlyWithoutEncryptedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	var creates []bool
+	keyFunc := func(_ string, create bool) ([]byte, error) {
+		creates = append(creates, create)
+		return make([]byte, 32), nil
+	}
+	require.NoError(t, NewStateStore(path, config.StateEncryptionKeyring, keyFunc).Save(testState()))
+	require.NoError(t, NewStateStore(path, config.StateEncryptionKeyring, keyFunc).Save(testState()))
+	_, err := NewStateStore(path, config.StateEncryptionKeyring, keyFunc).Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, []bool{true, false, false}, creates)
+}
+
+func TestStateStore_RejectsNewerEnvelope(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"encrypted_state": 99, "key_source": "token"}`), 0600))
+
+	_, err := NewStateStore(path, config.StateEncryptionToken, StateKeyFunc([]byte("secret"), "state-key")).Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "newer version")
+}
@@ -0,0 +1,5 @@
+// Package envfile reads and writes variables in the files env leases target.
+// Each Dialect quotes values the way the program that reads the file expects,
+// and parses them back the same way, so a secret is stored and revoked
+// without being altered or expanded.
+package envfile
@@ -0,0 +1,88 @@
+package envfile
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Entry is a variable found in a file.
+type Entry struct {
+	Key   string
+	Value string
+	// start and end are the entry's byte offsets in the content, for
+	// dialects that edit entries in place.
+	start, end int
+}
+
+// Dialect is one file format for variables, named by a lease's format.
+type Dialect interface {
+	// Name is the value of format that selects the dialect.
+	Name() string
+	// Parse returns the variables in content, in order.
+	Parse(content []byte) ([]Entry, error)
+	// Set returns content with key set to value. The entry is replaced if it
+	// exists and appended otherwise. Everything else is left as it was.
+	Set(content []byte, key, value string) ([]byte, error)
+}
+
+var dialects = []Dialect{
+	dotenvDialect,
+	posixShDialect,
+	dockerEnvDialect,
+	systemdEnvDialect,
+	jsonDialect{},
+}
+
+// Lookup returns the dialect called name.
+func Lookup(name string) (Dialect, bool) {
+	for _, d := range dialects {
+		if d.Name() == name {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// Names returns the names of all dialects.
+func Names() []string {
+	names := make([]string, len(dialects))
+	for i, d := range dialects {
+		names[i] = d.Name()
+	}
+	return names
+}
+
+// DefaultFor returns the dialect used for destination when a lease has no
+// format, or "" if there is none.
+func DefaultFor(destination string) string {
+	switch filepath.Base(destination) {
+	case ".envrc":
+		return posixShDialect.Name()
+	case ".env":
+		return dotenvDialect.Name()
+	}
+	return ""
+}
+
+// Get returns the value of key in content.
+func Get(d Dialect, content []byte, key string) (string, bool, error) {
+	entries, err := d.Parse(content)
+	if err != nil {
+		return "", false, err
+	}
+	for _, e := range entries {
+		if e.Key == key {
+			return e.Value, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// validateValue rejects what no environment variable can hold.
+func validateValue(value string) error {
+	if strings.ContainsRune(value, 0) {
+		return fmt.Errorf("value contains a NUL byte")
+	}
+	return nil
+}
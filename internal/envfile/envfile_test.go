@@ -0,0 +1,131 @@
+package envfile
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var trickyValues = []string{
+	"",
+	"plain",
+	"p@ss w0rd",
+	`it's "quoted"`,
+	"$HOME ${USER} `id` $(id)",
+	`back\slash\n`,
+	"naïve ключ 🔑",
+	"line one\nline two\r\n\tindented",
+	"trailing space ",
+	"# not a comment",
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, name := range Names() {
+		d, ok := Lookup(name)
+		require.True(t, ok, name)
+		initial := []byte("# keep me\nOTHER='x'\n")
+		if name == "json" {
+			initial = []byte(`{"OTHER": "x"}`)
+		}
+		for _, value := range trickyValues {
+			content, err := d.Set(initial, "API_KEY", value)
+			if name == "docker-env" && value == "line one\nline two\r\n\tindented" {
+				assert.Error(t, err, name)
+				continue
+			}
+			require.NoError(t, err, "%s %q", name, value)
+
+			got, ok, err := Get(d, content, "API_KEY")
+			require.NoError(t, err, "%s %q", name, value)
+			assert.True(t, ok, "%s %q", name, value)
+			assert.Equal(t, value, got, "%s\n%s", name, content)
+
+			// Setting it again replaces the entry.
+			content, err = d.Set(content, "API_KEY", "new")
+			require.NoError(t, err)
+			entries, err := d.Parse(content)
+			require.NoError(t, err)
+			var count int
+			for _, e := range entries {
+				if e.Key == "API_KEY" {
+					count++
+					assert.Equal(t, "new", e.Value, name)
+				}
+			}
+			assert.Equal(t, 1, count, "%s\n%s", name, content)
+		}
+	}
+}
+
+func TestSetKeepsOtherLines(t *testing.T) {
+	content := "# comment\nexport A='1'\n\nexport B=\"two\" # note\nC=3\n"
+	out, err := posixShDialect.Set([]byte(content), "B", "2")
+	require.NoError(t, err)
+	assert.Equal(t, "# comment\nexport A='1'\n\nexport B='2'\nC=3\n", string(out))
+
+	out, err = posixShDialect.Set([]byte("export A='1'"), "D", "4")
+	require.NoError(t, err)
+	assert.Equal(t, "export A='1'\nexport D='4'\n", string(out))
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		content string
+		want    map[string]string
+	}{
+		{posixShDialect, "export A=\"x \\$y\"\nB=a'b c'\\ d\nexport C=\"go\\u00e9\"\n", map[string]string{"A": "x $y", "B": "ab c d", "C": `go\u00e9`}},
+		{dotenvDialect, "export A=\"x\\ny\"\nB = plain value # comment\nC='lit\\n'\n", map[string]string{"A": "x\ny", "B": "plain value", "C": `lit\n`}},
+		{dockerEnvDialect, "A=\"quoted\"\nB= spaced \n", map[string]string{"A": `"quoted"`, "B": " spaced "}},
+		{systemdEnvDialect, "; comment\nA=\"multi\nline\"\nB=one two  \nC='a\\b'\"c\\d\"\n", map[string]string{"A": "multi\nline", "B": "one two", "C": `a\bcd`}},
+		{jsonDialect{}, `{"A": "x", "B": 1}`, map[string]string{"A": "x", "B": "1"}},
+	}
+	for _, tt := range tests {
+		entries, err := tt.dialect.Parse([]byte(tt.content))
+		require.NoError(t, err, tt.dialect.Name())
+		got := make(map[string]string)
+		for _, e := range entries {
+			got[e.Key] = e.Value
+		}
+		assert.Equal(t, tt.want, got, tt.dialect.Name())
+	}
+
+	_, err := posixShDialect.Parse([]byte("A=ok\nB='open\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestInvalid(t *testing.T) {
+	_, err := posixShDialect.Set(nil, "NOT-A-NAME", "x")
+	assert.Error(t, err)
+	_, err = dotenvDialect.Set(nil, "A", "nul\x00")
+	assert.Error(t, err)
+	_, err = jsonDialect{}.Set([]byte("[1]"), "A", "x")
+	assert.Error(t, err)
+}
+
+func TestPosixShSourcedByShell(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not installed")
+	}
+	for _, value := range trickyValues {
+		content, err := posixShDialect.Set(nil, "API_KEY", value)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), ".envrc")
+		require.NoError(t, os.WriteFile(path, content, 0600))
+
+		out, err := exec.Command(sh, "-c", `. "$1" && printf %s "$API_KEY"`, "sh", path).Output()
+		require.NoError(t, err, value)
+		assert.Equal(t, value, string(out))
+	}
+}
+
+func TestDefaultFor(t *testing.T) {
+	assert.Equal(t, "posix-sh", DefaultFor("/project/.envrc"))
+	assert.Equal(t, "dotenv", DefaultFor(".env"))
+	assert.Equal(t, "", DefaultFor("app.conf"))
+}
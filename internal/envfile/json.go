@@ -0,0 +1,83 @@
+package envfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// jsonDialect keeps variables in a JSON object. Set rewrites the whole file
+// with sorted keys; values that aren't strings are kept.
+type jsonDialect struct{}
+
+func (jsonDialect) Name() string {
+	return "json"
+}
+
+func (jsonDialect) Parse(content []byte) ([]Entry, error) {
+	obj, err := decodeObject(content)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	entries := make([]Entry, 0, len(keys))
+	for _, k := range keys {
+		e := Entry{Key: k, Value: string(obj[k])}
+		var s string
+		if err := json.Unmarshal(obj[k], &s); err == nil {
+			e.Value = s
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (jsonDialect) Set(content []byte, key, value string) ([]byte, error) {
+	if err := validateValue(value); err != nil {
+		return nil, err
+	}
+	obj, err := decodeObject(content)
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		obj = make(map[string]json.RawMessage)
+	}
+	encoded, err := encodeJSON(value, "")
+	if err != nil {
+		return nil, err
+	}
+	obj[key] = bytes.TrimSuffix(encoded, []byte("\n"))
+	return encodeJSON(obj, "  ")
+}
+
+// decodeObject returns the object in content, or nil if content is empty.
+func decodeObject(content []byte) (map[string]json.RawMessage, error) {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil, nil
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(content, &obj); err != nil {
+		return nil, fmt.Errorf("not a JSON object: %w", err)
+	}
+	return obj, nil
+}
+
+// encodeJSON marshals v without escaping HTML characters, which secrets are
+// full of.
+func encodeJSON(v any, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
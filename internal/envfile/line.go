@@ -0,0 +1,326 @@
+package envfile
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	shellNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	keyPattern       = regexp.MustCompile(`^[^\s=#'"]+$`)
+)
+
+// lineDialect is a format of KEY=value entries, one per line unless a quoted
+// value spans several.
+type lineDialect struct {
+	name string
+	// prefix is written before each key. Entries read may omit it.
+	prefix string
+	// export accepts entries whose key is preceded by "export ".
+	export bool
+	keys   *regexp.Regexp
+	// comments are the characters that start a comment line.
+	comments string
+	encode   func(value string) (string, error)
+	// decode parses the value at the start of s and returns it with the
+	// number of bytes it spans.
+	decode func(s string) (string, int, error)
+}
+
+var (
+	dotenvDialect = lineDialect{
+		name:     "dotenv",
+		export:   true,
+		keys:     keyPattern,
+		comments: "#",
+		encode:   encodeDotenv,
+		decode:   decodeDotenv,
+	}
+	posixShDialect = lineDialect{
+		name:     "posix-sh",
+		prefix:   "export ",
+		export:   true,
+		keys:     shellNamePattern,
+		comments: "#",
+		encode: func(value string) (string, error) {
+			return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'", nil
+		},
+		decode: decodePosixWord,
+	}
+	dockerEnvDialect = lineDialect{
+		name:     "docker-env",
+		keys:     keyPattern,
+		comments: "#",
+		encode: func(value string) (string, error) {
+			// Docker takes everything after = literally, up to the end of
+			// the line.
+			if strings.ContainsAny(value, "\r\n") {
+				return "", fmt.Errorf("docker-env cannot hold a value with line breaks")
+			}
+			return value, nil
+		},
+		decode: func(s string) (string, int, error) {
+			n := strings.IndexByte(s, '\n')
+			if n < 0 {
+				n = len(s)
+			}
+			return s[:n], n, nil
+		},
+	}
+	systemdEnvDialect = lineDialect{
+		name:     "systemd-env",
+		keys:     keyPattern,
+		comments: "#;",
+		encode: func(value string) (string, error) {
+			r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+			return `"` + r.Replace(value) + `"`, nil
+		},
+		decode: decodeSystemd,
+	}
+)
+
+func (d lineDialect) Name() string {
+	return d.name
+}
+
+func (d lineDialect) Parse(content []byte) ([]Entry, error) {
+	s := string(content)
+	var entries []Entry
+	for pos := 0; pos < len(s); {
+		lineEnd := endOfLine(s, pos)
+		line := s[pos:lineEnd]
+		trimmed := strings.TrimLeft(line, " \t")
+		eq := strings.IndexByte(trimmed, '=')
+		if trimmed == "" || strings.ContainsRune(d.comments, rune(trimmed[0])) || eq < 0 {
+			pos = lineEnd + 1
+			continue
+		}
+		key := strings.TrimSpace(trimmed[:eq])
+		if d.export {
+			key = strings.TrimSpace(strings.TrimPrefix(key, "export "))
+		}
+		if !d.keys.MatchString(key) {
+			pos = lineEnd + 1
+			continue
+		}
+
+		valueStart := lineEnd - len(trimmed) + eq + 1
+		value, n, err := d.decode(s[valueStart:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", strings.Count(s[:pos], "\n")+1, key, err)
+		}
+		// Whatever follows the value on its last line, such as a comment,
+		// belongs to the entry.
+		end := endOfLine(s, valueStart+n)
+		entries = append(entries, Entry{Key: key, Value: value, start: pos, end: end})
+		pos = end + 1
+	}
+	return entries, nil
+}
+
+func (d lineDialect) Set(content []byte, key, value string) ([]byte, error) {
+	if !d.keys.MatchString(key) {
+		return nil, fmt.Errorf("invalid variable name '%s' for %s", key, d.name)
+	}
+	if err := validateValue(value); err != nil {
+		return nil, err
+	}
+	encoded, err := d.encode(value)
+	if err != nil {
+		return nil, err
+	}
+	line := d.prefix + key + "=" + encoded
+
+	entries, err := d.Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for _, e := range entries {
+		if e.Key == key {
+			out = append(out, content[:e.start]...)
+			out = append(out, line...)
+			return append(out, content[e.end:]...), nil
+		}
+	}
+	out = append(out, content...)
+	if len(out) > 0 && out[len(out)-1] != '\n' {
+		out = append(out, '\n')
+	}
+	out = append(out, line...)
+	return append(out, '\n'), nil
+}
+
+// endOfLine returns the index of the newline ending the line at pos, or the
+// length of s.
+func endOfLine(s string, pos int) int {
+	if pos >= len(s) {
+		return len(s)
+	}
+	if i := strings.IndexByte(s[pos:], '\n'); i >= 0 {
+		return pos + i
+	}
+	return len(s)
+}
+
+// encodeDotenv single-quotes the value, which dotenv loaders take literally.
+// Values single quotes can't hold are double-quoted with escapes, including
+// for $ so loaders that expand variables leave it alone.
+func encodeDotenv(value string) (string, error) {
+	if !strings.ContainsAny(value, "'\n\r") {
+		return "'" + value + "'", nil
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(value) + `"`, nil
+}
+
+func decodeDotenv(s string) (string, int, error) {
+	i := len(s) - len(strings.TrimLeft(s, " \t"))
+	if i < len(s) && s[i] == '\'' {
+		j := strings.IndexByte(s[i+1:], '\'')
+		if j < 0 {
+			return "", 0, fmt.Errorf("unterminated single quote")
+		}
+		return s[i+1 : i+1+j], i + j + 2, nil
+	}
+	if i < len(s) && s[i] == '"' {
+		var b strings.Builder
+		for i++; i < len(s); i++ {
+			switch c := s[i]; c {
+			case '"':
+				return b.String(), i + 1, nil
+			case '\\':
+				if i+1 == len(s) {
+					b.WriteByte(c)
+					continue
+				}
+				i++
+				switch s[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 'r':
+					b.WriteByte('\r')
+				case 't':
+					b.WriteByte('\t')
+				case '\\', '"', '$':
+					b.WriteByte(s[i])
+				default:
+					b.WriteByte('\\')
+					b.WriteByte(s[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", 0, fmt.Errorf("unterminated double quote")
+	}
+
+	n := endOfLine(s, 0)
+	value := s[i:n]
+	if c := strings.Index(value, " #"); c >= 0 {
+		value = value[:c]
+	}
+	return strings.TrimRight(value, " \t\r"), n, nil
+}
+
+// decodePosixWord reads a shell word as sh would, without expanding
+// variables.
+func decodePosixWord(s string) (string, int, error) {
+	var b strings.Builder
+	i := 0
+	for i < len(s) {
+		switch c := s[i]; c {
+		case ' ', '\t', '\r', '\n', ';':
+			return b.String(), i, nil
+		case '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return "", 0, fmt.Errorf("unterminated single quote")
+			}
+			b.WriteString(s[i+1 : i+1+j])
+			i += j + 2
+		case '"':
+			n, err := readDoubleQuoted(&b, s[i:], "$`\"\\")
+			if err != nil {
+				return "", 0, err
+			}
+			i += n
+		case '\\':
+			if i+1 < len(s) && s[i+1] != '\n' {
+				b.WriteByte(s[i+1])
+			}
+			i += 2
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), len(s), nil
+}
+
+// decodeSystemd reads a value the way systemd reads an EnvironmentFile.
+// Quoted parts may span lines; unquoted trailing whitespace is dropped.
+func decodeSystemd(s string) (string, int, error) {
+	var b strings.Builder
+	quoted := 0
+	i := len(s) - len(strings.TrimLeft(s, " \t"))
+	for i < len(s) && s[i] != '\n' {
+		switch c := s[i]; c {
+		case '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return "", 0, fmt.Errorf("unterminated single quote")
+			}
+			b.WriteString(s[i+1 : i+1+j])
+			i += j + 2
+			quoted = b.Len()
+		case '"':
+			n, err := readDoubleQuoted(&b, s[i:], "")
+			if err != nil {
+				return "", 0, err
+			}
+			i += n
+			quoted = b.Len()
+		case '\\':
+			if i+1 < len(s) && s[i+1] != '\n' {
+				b.WriteByte(s[i+1])
+			}
+			i += 2
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	value := b.String()
+	return value[:quoted] + strings.TrimRight(value[quoted:], " \t\r"), min(i, len(s)), nil
+}
+
+// readDoubleQuoted writes the contents of the double-quoted string at the
+// start of s to b and returns the number of bytes it spans. A backslash
+// escapes the characters in escapable and joins lines; before any other
+// character it is kept. An empty escapable lets it escape every character.
+func readDoubleQuoted(b *strings.Builder, s, escapable string) (int, error) {
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return i + 1, nil
+		case '\\':
+			if i+1 == len(s) {
+				continue
+			}
+			i++
+			switch {
+			case s[i] == '\n':
+			case escapable == "" || strings.IndexByte(escapable, s[i]) >= 0:
+				b.WriteByte(s[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return 0, fmt.Errorf("unterminated double quote")
+}
@@ -0,0 +1,44 @@
+package ipc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket
+// activation. It is a variable so tests can pass a descriptor of their own.
+var listenFDsStart uintptr = 3
+
+// activationListener returns the socket passed by systemd socket activation
+// (sd_listen_fds(3)), or nil if the process was not socket-activated.
+func activationListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+	// The sockets are meant for this process only, not for its children.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if count != 1 {
+		return nil, fmt.Errorf("socket activation passed %d sockets, expected 1", count)
+	}
+	file := os.NewFile(listenFDsStart, "LISTEN_FD_"+strconv.Itoa(int(listenFDsStart)))
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket from socket activation: %w", err)
+	}
+	if _, ok := listener.(*net.UnixListener); !ok {
+		listener.Close()
+		return nil, fmt.Errorf("socket activation passed a %s socket, expected a unix socket", listener.Addr().Network())
+	}
+	return listener, nil
+}
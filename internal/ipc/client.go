@@ -1,17 +1,21 @@
 package ipc
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"time"
 )
 
 // Client is the IPC client.
 type Client struct {
 	socketPath string
 	secret     []byte
+	timeout    time.Duration
 }
 
 // NewClient creates a new IPC client.
@@ -22,33 +26,62 @@ func NewClient(socketPath string, secret []byte) *Client {
 	}
 }
 
-// Send sends a request to the server and decodes the response.
-func (c *Client) Send(payload any, responsePayload any) error {
+// SetTimeout bounds how long Send waits for the daemon. Zero leaves only the
+// caller's context in control.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+// Send sends a request to the server and decodes the response. It gives up
+// when ctx is done or the client timeout passes.
+func (c *Client) Send(ctx context.Context, payload any, responsePayload any) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
 	req, err := NewRequest(payload, c.secret)
 	if err != nil {
 		return err
 	}
 
-	conn, err := net.Dial("unix", c.socketPath)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", c.socketPath)
 	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return &ConnectionError{SocketPath: c.socketPath, Err: err}
 	}
 	defer conn.Close()
 
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
 	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return err
 	}
 
-	// Always read the response to properly close the connection and check for errors
 	var resp Response
 	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
-		// If the server sends no body, it's a successful fire-and-forget.
-		// We can treat EOF as a success signal in this specific case.
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if errors.Is(err, io.EOF) {
-			return nil
+			return ErrNoResponse
 		}
 		return fmt.Errorf("failed to decode response: %w", err)
 	}
+	if err := verifyResponse(&resp, req.Nonce, 0, c.secret); err != nil {
+		return err
+	}
+	if err := protocolError(&resp, req.Payload); err != nil {
+		return err
+	}
 
 	if resp.Error != "" {
 		return fmt.Errorf("server error: %s", resp.Error)
@@ -63,3 +96,95 @@ func (c *Client) Send(payload any, responsePayload any) error {
 
 	return nil
 }
+
+// Hello performs the protocol handshake and returns what the daemon
+// supports. A daemon too old to answer is reported as a VersionMismatchError.
+func (c *Client) Hello(ctx context.Context) (*HelloResponse, error) {
+	req := HelloRequest{Command: "hello", ProtocolVersion: ProtocolVersion, ClientVersion: BuildVersion()}
+	var resp HelloResponse
+	if err := c.Send(ctx, req, &resp); err != nil {
+		// Daemons that predate signed requests drop the connection without
+		// answering.
+		if errors.Is(err, ErrNoResponse) {
+			return nil, &VersionMismatchError{ClientProtocol: ProtocolVersion, DaemonOlder: true}
+		}
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ErrNoResponse is returned when the daemon closes the connection without
+// sending a response.
+var ErrNoResponse = errors.New("daemon closed the connection without responding")
+
+// protocolError turns protocol-level error codes into a VersionMismatchError.
+func protocolError(resp *Response, payload []byte) error {
+	mismatch := &VersionMismatchError{
+		ClientProtocol: ProtocolVersion,
+		DaemonProtocol: resp.ProtocolVersion,
+		DaemonOlder:    resp.ProtocolVersion <= ProtocolVersion,
+	}
+	switch resp.Code {
+	case CodeVersionMismatch:
+		return mismatch
+	case CodeUnknownCommand:
+		var req struct{ Command string }
+		_ = json.Unmarshal(payload, &req)
+		mismatch.Command = req.Command
+		return mismatch
+	}
+	return nil
+}
+
+// Subscribe sends a streaming request and calls handle for every message the
+// server sends until ctx is cancelled, the server closes the stream, or handle
+// returns an error.
+func (c *Client) Subscribe(ctx context.Context, payload any, handle func(payload json.RawMessage) error) error {
+	req, err := newRequest(payload, true, c.secret)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", c.socketPath)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &ConnectionError{SocketPath: c.socketPath, Err: err}
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	for seq := 0; ; seq++ {
+		var resp Response
+		if err := dec.Decode(&resp); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		if err := verifyResponse(&resp, req.Nonce, seq, c.secret); err != nil {
+			return err
+		}
+		if err := protocolError(&resp, req.Payload); err != nil {
+			return err
+		}
+		if resp.Error != "" {
+			return fmt.Errorf("server error: %s", resp.Error)
+		}
+		if err := handle(resp.Payload); err != nil {
+			return err
+		}
+	}
+}
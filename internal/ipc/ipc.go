@@ -2,17 +2,28 @@ package ipc
 
 import (
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 )
 
-// Request represents a request sent from the CLI to the daemon.
+// Request represents a request sent from the CLI to the daemon. The signature
+// covers the timestamp, nonce and stream flag as well as the payload, so a
+// captured request cannot be altered or replayed.
 type Request struct {
 	Signature string
 	Payload   []byte
+	Timestamp time.Time
+	Nonce     string
+	// Version is the protocol version the client speaks.
+	Version int
+	// Stream asks the server to keep the connection open and send a response
+	// per event instead of a single response.
+	Stream bool `json:",omitempty"`
 }
 
 // GrantRequest is the payload for a grant request.
@@ -22,6 +33,16 @@ type GrantRequest struct {
 	Override   bool
 	Append     bool
 	ConfigFile string
+	// Fetches reports how long the client spent fetching secrets from
+	// providers, so the daemon can expose it as a metric.
+	Fetches []ProviderFetch `json:",omitempty"`
+}
+
+// ProviderFetch records the duration of a single fetch from a secret provider.
+type ProviderFetch struct {
+	Provider string
+	Seconds  float64
+	Failed   bool
 }
 
 // GrantResponse is the payload for a grant response.
@@ -38,6 +59,47 @@ type StatusRequest struct {
 // StatusResponse is the payload for a status response.
 type StatusResponse struct {
 	Leases []Lease
+	// Failed lists revocations that are being retried or were given up on.
+	Failed []FailedRevocation
+	// Idle is set when the daemon revokes leases on idle.
+	Idle *IdleStatus `json:",omitempty"`
+}
+
+// IdleStatus reports how long the daemon has seen the user idle.
+type IdleStatus struct {
+	Source  string
+	Timeout time.Duration
+	Idle    time.Duration
+	// CheckedAt is when Idle was measured; it is zero before the first
+	// check.
+	CheckedAt time.Time
+	// Error is set when the last measurement failed.
+	Error string `json:",omitempty"`
+}
+
+// FailedRevocation describes a lease the daemon could not revoke.
+type FailedRevocation struct {
+	Lease          Lease
+	Attempts       int
+	NextRetryTime  time.Time
+	InitialFailure time.Time
+	LastError      string
+	// DeadLetter is set once the daemon has stopped retrying on its own.
+	DeadLetter bool
+}
+
+// RetryRequest is the payload for a retry request, which immediately retries
+// failed revocations for a project, or for all projects.
+type RetryRequest struct {
+	Command    string
+	ConfigFile string
+	All        bool
+}
+
+// RetryResponse is the payload for a retry response.
+type RetryResponse struct {
+	Messages []string
+	Failed   []FailedRevocation
 }
 
 type CleanupRequest struct {
@@ -58,8 +120,75 @@ type RevokeRequest struct {
 
 // RevokeResponse is the payload for a revoke response.
 type RevokeResponse struct {
-	Messages      []string
-	ShellCommands []string
+	Messages []string
+	// ShellCommands unsets ShellVariables in POSIX shells. Clients that
+	// print commands for other shells build their own from ShellVariables.
+	ShellCommands  []string
+	ShellVariables []string `json:",omitempty"`
+}
+
+// ShellLeasesRequest asks which shell leases granted to a shell session are
+// still active.
+type ShellLeasesRequest struct {
+	Command string
+	Session string
+}
+
+// ShellLeasesResponse lists the variables of the session's active shell
+// leases.
+type ShellLeasesResponse struct {
+	Variables []string
+}
+
+// RenewRequest is the payload for a renew request, which extends active leases
+// without fetching their secrets again. Leases selects specific leases; when
+// empty, every lease of ConfigFile is renewed, or every lease if All is set.
+// Duration overrides the lease's own duration when set.
+type RenewRequest struct {
+	Command    string
+	ConfigFile string
+	All        bool
+	Leases     []Lease
+	Duration   string
+}
+
+// RenewResponse is the payload for a renew response.
+type RenewResponse struct {
+	Messages []string
+	Leases   []Lease
+}
+
+// SubscribeRequest is the payload for a subscribe request. An empty ConfigFile
+// subscribes to events for all projects.
+type SubscribeRequest struct {
+	Command    string
+	ConfigFile string
+}
+
+// Event types sent to subscribers.
+const (
+	EventGranted       = "granted"
+	EventRenewed       = "renewed"
+	EventWarning       = "warning"
+	EventExpired       = "expired"
+	EventRevoked       = "revoked"
+	EventRevokeFailed  = "revoke-failed"
+	EventOrphaned      = "orphaned"
+	EventConfigChanged = "config-changed"
+)
+
+// Event describes a change to a lease, or to a project's config, that the
+// daemon streams to subscribers.
+type Event struct {
+	Type        string     `json:"type"`
+	Time        time.Time  `json:"time"`
+	Source      string     `json:"source,omitempty"`
+	Destination string     `json:"destination,omitempty"`
+	Variable    string     `json:"variable,omitempty"`
+	LeaseType   string     `json:"lease_type,omitempty"`
+	ConfigFile  string     `json:"config_file,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Message     string     `json:"message,omitempty"`
 }
 
 // Lease is a simplified lease structure for IPC.
@@ -76,6 +205,9 @@ type Lease struct {
 	ConfigFile   string
 	OpAccount    string
 	ParentSource string
+	RevokeOnLock bool
+	IdleTimeout  string
+	ShellSession string `json:",omitempty"`
 }
 
 // Sign creates a signature for the payload.
@@ -94,10 +226,17 @@ func Verify(payload []byte, signature string, secret []byte) error {
 	return nil
 }
 
-// Response represents a response sent from the daemon to the CLI.
+// Response represents a response sent from the daemon to the CLI. It is
+// signed over the request nonce so a client can tell it came from a daemon
+// holding the same secret.
 type Response struct {
-	Error   string          `json:"error,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Code classifies protocol errors. See the Code* constants.
+	Code    string          `json:"code,omitempty"`
 	Payload json.RawMessage `json:"payload,omitempty"`
+	// ProtocolVersion is the protocol version the daemon speaks.
+	ProtocolVersion int    `json:"protocol_version,omitempty"`
+	Signature       string `json:"signature,omitempty"`
 }
 
 // ConnectionError is a custom error for IPC connection errors.
@@ -116,14 +255,57 @@ func (e *ConnectionError) Unwrap() error {
 
 // NewRequest creates a new signed request.
 func NewRequest(payload any, secret []byte) (*Request, error) {
+	return newRequest(payload, false, secret)
+}
+
+func newRequest(payload any, stream bool, secret []byte) (*Request, error) {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
 	}
 
-	signature := Sign(payloadBytes, secret)
-	return &Request{
-		Signature: signature,
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	req := &Request{
 		Payload:   payloadBytes,
-	}, nil
+		Timestamp: time.Now(),
+		Nonce:     hex.EncodeToString(nonce),
+		Version:   ProtocolVersion,
+		Stream:    stream,
+	}
+	req.Signature = Sign(req.signedBytes(), secret)
+	return req, nil
+}
+
+// signedBytes returns the message the request signature is computed over.
+func (r *Request) signedBytes() []byte {
+	header := fmt.Sprintf("request\x00%d\x00%d\x00%s\x00%t\x00", r.Version, r.Timestamp.UnixNano(), r.Nonce, r.Stream)
+	return append([]byte(header), r.Payload...)
 }
+
+// responseBytes returns the message a response signature is computed over.
+// seq is the position of the response on the connection, which stops a
+// stream's messages from being reordered or replayed.
+func responseBytes(resp *Response, nonce string, seq int) []byte {
+	header := fmt.Sprintf("response\x00%s\x00%d\x00%d\x00%s\x00%s\x00", nonce, seq, resp.ProtocolVersion, resp.Code, resp.Error)
+	return append([]byte(header), resp.Payload...)
+}
+
+func signResponse(resp *Response, nonce string, seq int, secret []byte) {
+	resp.Signature = Sign(responseBytes(resp, nonce, seq), secret)
+}
+
+func verifyResponse(resp *Response, nonce string, seq int, secret []byte) error {
+	if err := Verify(responseBytes(resp, nonce, seq), resp.Signature, secret); err != nil {
+		return ErrInvalidResponseSignature
+	}
+	return nil
+}
+
+// ErrInvalidResponseSignature is returned when a response was not signed with
+// the client's secret. Either the socket does not belong to the env-lease
+// daemon, or the daemon and CLI use different auth tokens.
+var ErrInvalidResponseSignature = errors.New("invalid response signature: the daemon socket may be spoofed, or auth.token changed since the daemon started")
@@ -1,8 +1,18 @@
 package ipc
 
 import (
+	"context"
 	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -21,7 +31,7 @@ func TestIPC(t *testing.T) {
 	defer server.Close()
 
 	handlerChan := make(chan []byte, 1)
-	handler := func(payload []byte) ([]byte, error) {
+	handler := func(ctx context.Context, payload []byte) ([]byte, error) {
 		handlerChan <- payload
 		return nil, nil
 	}
@@ -35,7 +45,7 @@ func TestIPC(t *testing.T) {
 		payload := GrantRequest{
 			Leases: []Lease{{Source: "test"}},
 		}
-		if err := client.Send(payload, nil); err != nil {
+		if err := client.Send(context.Background(), payload, nil); err != nil {
 			t.Fatalf("client send failed: %v", err)
 		}
 
@@ -56,8 +66,8 @@ func TestIPC(t *testing.T) {
 		payload := GrantRequest{
 			Leases: []Lease{{Source: "test"}},
 		}
-		if err := client.Send(payload, nil); err != nil {
-			t.Fatalf("client send failed: %v", err)
+		if err := client.Send(context.Background(), payload, nil); err == nil {
+			t.Fatal("expected client send to fail")
 		}
 
 		select {
@@ -68,3 +78,454 @@ func TestIPC(t *testing.T) {
 		}
 	})
 }
+
+func TestSubscribe(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	secret := []byte("stream-secret")
+
+	server, err := NewServer(socketPath, secret)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.Close()
+
+	server.HandleStream(func(ctx context.Context, payload []byte, send func([]byte) error) error {
+		for i := 0; i < 3; i++ {
+			if err := send([]byte(fmt.Sprintf(`{"n":%d}`, i))); err != nil {
+				return err
+			}
+		}
+		<-ctx.Done()
+		return nil
+	})
+	go server.Listen(func(ctx context.Context, payload []byte) ([]byte, error) { return nil, nil })
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var received []string
+	client := NewClient(socketPath, secret)
+	err = client.Subscribe(ctx, SubscribeRequest{Command: "subscribe"}, func(payload json.RawMessage) error {
+		received = append(received, string(payload))
+		if len(received) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(received) != 3 || received[2] != `{"n":2}` {
+		t.Fatalf("unexpected events: %v", received)
+	}
+}
+
+func TestServerPassesPeerToHandler(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("peer credentials are not available on this platform")
+	}
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	secret := []byte("peer-secret")
+
+	server, err := NewServer(socketPath, secret)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.Close()
+
+	peers := make(chan Peer, 1)
+	go server.Listen(func(ctx context.Context, payload []byte) ([]byte, error) {
+		peer, _ := PeerFromContext(ctx)
+		peers <- peer
+		return nil, nil
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	if err := NewClient(socketPath, secret).Send(context.Background(), StatusRequest{Command: "status"}, nil); err != nil {
+		t.Fatalf("client send failed: %v", err)
+	}
+
+	peer := <-peers
+	if peer.PID != os.Getpid() {
+		t.Errorf("expected peer PID %d, got %d", os.Getpid(), peer.PID)
+	}
+	if peer.UID != os.Getuid() {
+		t.Errorf("expected peer UID %d, got %d", os.Getuid(), peer.UID)
+	}
+}
+
+// sendRaw writes req to the server and returns the response without verifying
+// it.
+func sendRaw(t *testing.T, socketPath string, req *Request) Response {
+	t.Helper()
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func TestServerRejectsReplayedRequests(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	secret := []byte("replay-secret")
+
+	server, err := NewServer(socketPath, secret)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.Close()
+
+	calls := make(chan struct{}, 10)
+	go server.Listen(func(ctx context.Context, payload []byte) ([]byte, error) {
+		calls <- struct{}{}
+		return []byte(`{}`), nil
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	t.Run("replayed nonce", func(t *testing.T) {
+		req, err := NewRequest(StatusRequest{Command: "status"}, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp := sendRaw(t, socketPath, req); resp.Error != "" {
+			t.Fatalf("first request failed: %s", resp.Error)
+		}
+		if resp := sendRaw(t, socketPath, req); resp.Error != "unauthorized" {
+			t.Fatalf("expected replay to be rejected, got %+v", resp)
+		}
+		if len(calls) != 1 {
+			t.Fatalf("expected handler to run once, ran %d times", len(calls))
+		}
+		<-calls
+	})
+
+	t.Run("stale timestamp", func(t *testing.T) {
+		req, err := NewRequest(StatusRequest{Command: "status"}, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Timestamp = req.Timestamp.Add(-2 * replayWindow)
+		req.Signature = Sign(req.signedBytes(), secret)
+		if resp := sendRaw(t, socketPath, req); resp.Error != "unauthorized" {
+			t.Fatalf("expected stale request to be rejected, got %+v", resp)
+		}
+	})
+
+	t.Run("tampered payload", func(t *testing.T) {
+		req, err := NewRequest(StatusRequest{Command: "status"}, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Payload = []byte(`{"Command":"revoke"}`)
+		if resp := sendRaw(t, socketPath, req); resp.Error != "unauthorized" {
+			t.Fatalf("expected tampered request to be rejected, got %+v", resp)
+		}
+	})
+
+	if len(calls) != 0 {
+		t.Fatalf("handler ran for a rejected request")
+	}
+}
+
+func TestServerRejectsOtherUsers(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("peer credentials are not available on this platform")
+	}
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	secret := []byte("uid-secret")
+
+	server, err := NewServer(socketPath, secret)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.Close()
+	server.uid = os.Getuid() + 1
+
+	go server.Listen(func(ctx context.Context, payload []byte) ([]byte, error) {
+		t.Error("handler should not run for another user")
+		return nil, nil
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	// The connection is closed without reading the request.
+	err = NewClient(socketPath, secret).Send(context.Background(), StatusRequest{Command: "status"}, nil)
+	if err == nil || strings.HasPrefix(err.Error(), "server error") {
+		t.Fatalf("expected the connection to be dropped, got %v", err)
+	}
+}
+
+func TestServerRejectsUnknownPeer(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("peer credentials are not available on this platform")
+	}
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	secret := []byte("peer-secret")
+
+	server, err := NewServer(socketPath, secret)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.Close()
+	server.peerOf = func(net.Conn) (Peer, error) {
+		return Peer{PID: -1, UID: -1}, errors.New("getsockopt failed")
+	}
+
+	go server.Listen(func(ctx context.Context, payload []byte) ([]byte, error) {
+		t.Error("handler should not run for an unknown peer")
+		return nil, nil
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	// The connection is closed without reading the request.
+	err = NewClient(socketPath, secret).Send(context.Background(), StatusRequest{Command: "status"}, nil)
+	if err == nil || strings.HasPrefix(err.Error(), "server error") {
+		t.Fatalf("expected the connection to be dropped, got %v", err)
+	}
+}
+
+func TestClientDetectsSpoofedDaemon(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// A fake daemon that does not know the secret.
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var req Request
+		_ = json.NewDecoder(conn).Decode(&req)
+		_ = json.NewEncoder(conn).Encode(&Response{Payload: []byte(`{"Leases":[]}`)})
+	}()
+
+	var resp StatusResponse
+	err = NewClient(socketPath, []byte("real-secret")).Send(context.Background(), StatusRequest{Command: "status"}, &resp)
+	if !errors.Is(err, ErrInvalidResponseSignature) {
+		t.Fatalf("expected ErrInvalidResponseSignature, got %v", err)
+	}
+}
+
+func TestVersionNegotiation(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	secret := []byte("version-secret")
+
+	server, err := NewServer(socketPath, secret)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.Close()
+
+	go server.Listen(func(ctx context.Context, payload []byte) ([]byte, error) {
+		var req struct{ Command string }
+		_ = json.Unmarshal(payload, &req)
+		if req.Command == "hello" {
+			return json.Marshal(HelloResponse{ProtocolVersion: ProtocolVersion, Capabilities: []string{CapabilityStatus}})
+		}
+		return nil, &UnknownCommandError{Command: req.Command}
+	})
+	time.Sleep(100 * time.Millisecond)
+	client := NewClient(socketPath, secret)
+
+	t.Run("hello", func(t *testing.T) {
+		hello, err := client.Hello(context.Background())
+		if err != nil {
+			t.Fatalf("hello failed: %v", err)
+		}
+		if !hello.Supports(CapabilityStatus) || hello.Supports(CapabilitySubscribe) {
+			t.Errorf("unexpected capabilities: %v", hello.Capabilities)
+		}
+	})
+
+	t.Run("unknown command", func(t *testing.T) {
+		err := client.Send(context.Background(), struct{ Command string }{Command: "renew"}, nil)
+		var mismatch *VersionMismatchError
+		if !errors.As(err, &mismatch) {
+			t.Fatalf("expected VersionMismatchError, got %v", err)
+		}
+		if !mismatch.DaemonOlder || mismatch.Command != "renew" {
+			t.Errorf("unexpected mismatch: %+v", mismatch)
+		}
+	})
+
+	t.Run("version 1 client", func(t *testing.T) {
+		// Version 1 requests signed only the payload and had no version,
+		// timestamp or nonce.
+		payload, _ := json.Marshal(StatusRequest{Command: "status"})
+		req := &Request{Payload: payload, Signature: Sign(payload, secret)}
+		resp := sendRaw(t, socketPath, req)
+		if resp.Code != CodeVersionMismatch {
+			t.Fatalf("expected version mismatch, got %+v", resp)
+		}
+		if !strings.Contains(resp.Error, "unsupported protocol version 0") {
+			t.Errorf("unexpected error: %s", resp.Error)
+		}
+	})
+
+	t.Run("newer client", func(t *testing.T) {
+		req, err := NewRequest(StatusRequest{Command: "status"}, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Version = ProtocolVersion + 1
+		req.Signature = Sign(req.signedBytes(), secret)
+		resp := sendRaw(t, socketPath, req)
+		if resp.Code != CodeVersionMismatch {
+			t.Fatalf("expected version mismatch, got %+v", resp)
+		}
+		mismatch, ok := protocolError(&resp, req.Payload).(*VersionMismatchError)
+		if !ok || !mismatch.DaemonOlder {
+			t.Fatalf("expected daemon to be reported as older, got %v", mismatch)
+		}
+	})
+}
+
+func TestTimeouts(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	secret := []byte("timeout-secret")
+
+	server, err := NewServer(socketPath, secret)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.Close()
+	server.SetTimeouts(Timeouts{IO: 100 * time.Millisecond, Handler: 100 * time.Millisecond})
+
+	handlerErrs := make(chan error, 1)
+	go server.Listen(func(ctx context.Context, payload []byte) ([]byte, error) {
+		<-ctx.Done()
+		handlerErrs <- ctx.Err()
+		return nil, ctx.Err()
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	t.Run("client timeout", func(t *testing.T) {
+		client := NewClient(socketPath, secret)
+		client.SetTimeout(50 * time.Millisecond)
+		err := client.Send(context.Background(), StatusRequest{Command: "status"}, nil)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+		}
+		if err := <-handlerErrs; !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected handler context to time out, got %v", err)
+		}
+	})
+
+	t.Run("client cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		err := NewClient(socketPath, secret).Send(ctx, StatusRequest{Command: "status"}, nil)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		<-handlerErrs
+	})
+
+	t.Run("server read timeout", func(t *testing.T) {
+		conn, err := net.Dial("unix", socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		// Send nothing; the server should give up and close the connection.
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, 1)
+		if _, err := conn.Read(buf); !errors.Is(err, io.EOF) {
+			t.Fatalf("expected server to close the connection, got %v", err)
+		}
+	})
+}
+
+func TestSocketActivation(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	secret := []byte("secret")
+
+	// Stand in for systemd: bind the socket and pass its descriptor.
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := listener.(*net.UnixListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	defer file.Close()
+
+	// NewServer takes ownership of the descriptor it is passed.
+	fd, err := syscall.Dup(int(file.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(fd uintptr) { listenFDsStart = fd }(listenFDsStart)
+	listenFDsStart = uintptr(fd)
+	t.Setenv("LISTEN_PID", fmt.Sprint(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+
+	server, err := NewServer(socketPath, secret)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	if !server.Activated() {
+		t.Fatal("expected the server to use the activation socket")
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("expected LISTEN_FDS to be cleared")
+	}
+	go server.Listen(func(ctx context.Context, payload []byte) ([]byte, error) {
+		return json.Marshal(StatusResponse{})
+	})
+
+	var resp StatusResponse
+	if err := NewClient(socketPath, secret).Send(context.Background(), StatusRequest{Command: "status"}, &resp); err != nil {
+		t.Fatalf("request over activated socket failed: %v", err)
+	}
+
+	// systemd owns the socket, so closing the server must not remove it.
+	server.Close()
+	if _, err := os.Stat(socketPath); err != nil {
+		t.Errorf("expected the socket to outlive the server: %v", err)
+	}
+}
+
+func TestSocketActivationRejectsOtherPath(t *testing.T) {
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "other.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	file, err := listener.(*net.UnixListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// NewServer takes ownership of the descriptor it is passed.
+	fd, err := syscall.Dup(int(file.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(fd uintptr) { listenFDsStart = fd }(listenFDsStart)
+	listenFDsStart = uintptr(fd)
+	t.Setenv("LISTEN_PID", fmt.Sprint(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+
+	if _, err := NewServer(filepath.Join(t.TempDir(), "test.sock"), []byte("secret")); err == nil {
+		t.Fatal("expected an error for a socket bound to another path")
+	}
+}
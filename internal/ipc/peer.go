@@ -0,0 +1,50 @@
+package ipc
+
+import (
+	"context"
+	"net"
+)
+
+// Peer identifies the process on the other end of a connection. Fields are
+// -1 when the platform cannot report them.
+type Peer struct {
+	PID int
+	UID int
+}
+
+type peerKey struct{}
+
+// ContextWithPeer returns a copy of ctx carrying peer.
+func ContextWithPeer(ctx context.Context, peer Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, peer)
+}
+
+// PeerFromContext returns the peer stored by the server for the current
+// request.
+func PeerFromContext(ctx context.Context) (Peer, bool) {
+	peer, ok := ctx.Value(peerKey{}).(Peer)
+	return peer, ok
+}
+
+// peerOf reads the credentials of the process connected to conn.
+func peerOf(conn net.Conn) (Peer, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return Peer{PID: -1, UID: -1}, nil
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return Peer{PID: -1, UID: -1}, err
+	}
+
+	var (
+		peer    Peer
+		credErr error
+	)
+	if err := raw.Control(func(fd uintptr) {
+		peer, credErr = peerCredentials(int(fd))
+	}); err != nil {
+		return Peer{PID: -1, UID: -1}, err
+	}
+	return peer, credErr
+}
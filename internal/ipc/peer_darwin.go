@@ -0,0 +1,25 @@
+//go:build darwin
+// +build darwin
+
+package ipc
+
+import "golang.org/x/sys/unix"
+
+// peerCredentialsSupported is true where every connection's peer can be
+// identified, so one that cannot is rejected.
+const peerCredentialsSupported = true
+
+func peerCredentials(fd int) (Peer, error) {
+	peer := Peer{PID: -1, UID: -1}
+	cred, err := unix.GetsockoptXucred(fd, unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	if err != nil {
+		return peer, err
+	}
+	peer.UID = int(cred.Uid)
+	pid, err := unix.GetsockoptInt(fd, unix.SOL_LOCAL, unix.LOCAL_PEERPID)
+	if err != nil {
+		return peer, err
+	}
+	peer.PID = pid
+	return peer, nil
+}
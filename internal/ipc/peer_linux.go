@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package ipc
+
+import "golang.org/x/sys/unix"
+
+// peerCredentialsSupported is true where every connection's peer can be
+// identified, so one that cannot is rejected.
+const peerCredentialsSupported = true
+
+func peerCredentials(fd int) (Peer, error) {
+	cred, err := unix.GetsockoptUcred(fd, unix.SOL_SOCKET, unix.SO_PEERCRED)
+	if err != nil {
+		return Peer{PID: -1, UID: -1}, err
+	}
+	return Peer{PID: int(cred.Pid), UID: int(cred.Uid)}, nil
+}
@@ -0,0 +1,50 @@
+package ipc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// replayWindow is how far a request timestamp may be from the server's clock.
+// Nonces are remembered for long enough that a request cannot be replayed
+// within the window.
+const replayWindow = 30 * time.Second
+
+// replayGuard rejects stale requests and requests whose nonce was already
+// seen.
+type replayGuard struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	nonces map[string]time.Time
+}
+
+func newReplayGuard(now func() time.Time) *replayGuard {
+	return &replayGuard{now: now, nonces: make(map[string]time.Time)}
+}
+
+func (g *replayGuard) check(req *Request) error {
+	if req.Nonce == "" {
+		return fmt.Errorf("request has no nonce")
+	}
+
+	now := g.now()
+	skew := now.Sub(req.Timestamp)
+	if skew > replayWindow || skew < -replayWindow {
+		return fmt.Errorf("request timestamp is outside the replay window")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for nonce, seen := range g.nonces {
+		if now.Sub(seen) > 2*replayWindow {
+			delete(g.nonces, nonce)
+		}
+	}
+	if _, ok := g.nonces[req.Nonce]; ok {
+		return fmt.Errorf("request nonce was already used")
+	}
+	g.nonces[req.Nonce] = now
+	return nil
+}
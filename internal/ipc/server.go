@@ -1,39 +1,109 @@
 package ipc
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"time"
 )
 
+// Handler serves a single request and returns the response payload. The peer
+// that sent the request is available through PeerFromContext.
+type Handler func(ctx context.Context, payload []byte) ([]byte, error)
+
+// StreamHandler serves a long-lived request. It calls send once per message
+// and returns when ctx is cancelled, either because the client disconnected or
+// because the server is closing.
+type StreamHandler func(ctx context.Context, payload []byte, send func(payload []byte) error) error
+
+// Timeouts bound how long the server spends on a connection. A zero value
+// disables that timeout.
+type Timeouts struct {
+	// IO bounds reading the request and writing each response.
+	IO time.Duration
+	// Handler bounds the context passed to a non-streaming handler.
+	Handler time.Duration
+}
+
+// DefaultTimeouts are used unless SetTimeouts is called.
+var DefaultTimeouts = Timeouts{IO: 5 * time.Second, Handler: 20 * time.Second}
+
 // Server is the IPC server.
 type Server struct {
-	listener   net.Listener
-	secret     []byte
-	socketPath string
+	listener      net.Listener
+	secret        []byte
+	socketPath    string
+	streamHandler StreamHandler
+	ctx           context.Context
+	cancel        context.CancelFunc
+	replay        *replayGuard
+	timeouts      Timeouts
+	// uid is the only user allowed to connect, where the platform reports
+	// peer credentials.
+	uid int
+	// peerOf reads the credentials of a connection's peer.
+	peerOf func(net.Conn) (Peer, error)
+	// activated is set when the socket was passed by systemd, which then
+	// owns it.
+	activated bool
 }
 
-// NewServer creates a new IPC server.
+// NewServer creates a new IPC server. When the process was started by systemd
+// socket activation it serves the socket it was passed, which must be bound
+// to socketPath; otherwise it creates the socket itself.
 func NewServer(socketPath string, secret []byte) (*Server, error) {
-	if err := os.RemoveAll(socketPath); err != nil {
-		return nil, err
-	}
-
-	listener, err := net.Listen("unix", socketPath)
+	listener, err := activationListener()
 	if err != nil {
 		return nil, err
 	}
+	activated := listener != nil
+	if activated {
+		if addr := listener.Addr().String(); addr != socketPath {
+			listener.Close()
+			return nil, fmt.Errorf("socket activation passed %s, but clients connect to %s", addr, socketPath)
+		}
+	} else {
+		if err := os.RemoveAll(socketPath); err != nil {
+			return nil, err
+		}
+		listener, err = net.Listen("unix", socketPath)
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Server{
 		listener:   listener,
 		secret:     secret,
 		socketPath: socketPath,
+		ctx:        ctx,
+		cancel:     cancel,
+		replay:     newReplayGuard(time.Now),
+		timeouts:   DefaultTimeouts,
+		uid:        os.Getuid(),
+		peerOf:     peerOf,
+		activated:  activated,
 	}, nil
 }
 
+// HandleStream registers the handler for streaming requests. It must be called
+// before Listen.
+func (s *Server) HandleStream(handler StreamHandler) {
+	s.streamHandler = handler
+}
+
+// SetTimeouts sets the connection timeouts. It must be called before Listen.
+func (s *Server) SetTimeouts(timeouts Timeouts) {
+	s.timeouts = timeouts
+}
+
 // Listen starts the server's listening loop.
-func (s *Server) Listen(handler func(payload []byte) ([]byte, error)) error {
+func (s *Server) Listen(handler Handler) error {
 	for {
 		conn, err := s.listener.Accept()
 		if err != nil {
@@ -43,38 +113,149 @@ func (s *Server) Listen(handler func(payload []byte) ([]byte, error)) error {
 	}
 }
 
-func (s *Server) handleConnection(conn net.Conn, handler func(payload []byte) ([]byte, error)) {
+func (s *Server) handleConnection(conn net.Conn, handler Handler) {
 	defer conn.Close()
 
+	// Another user's request is not even parsed. It cannot be answered
+	// either, as the response would be signed with the request's nonce.
+	peer, err := s.checkPeer(conn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rejected connection: %v\n", err)
+		return
+	}
+
+	if s.timeouts.IO > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(s.timeouts.IO))
+	}
 	var req Request
 	if err := json.NewDecoder(conn).Decode(&req); err != nil {
 		fmt.Fprintf(os.Stderr, "failed to decode request: %v\n", err)
 		return
 	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	enc := &responseEncoder{conn: conn, enc: json.NewEncoder(conn), nonce: req.Nonce, secret: s.secret, timeout: s.timeouts.IO}
+	// A client on another protocol version signs different bytes, so the
+	// version is checked before the signature to tell it why it failed.
+	if err := checkVersion(req.Version); err != nil {
+		enc.encode(&Response{Error: err.Error(), Code: CodeVersionMismatch})
+		return
+	}
+	if err := s.authenticate(&req); err != nil {
+		fmt.Fprintf(os.Stderr, "rejected request: %v\n", err)
+		enc.encode(&Response{Error: "unauthorized"})
+		return
+	}
+	ctx := ContextWithPeer(s.ctx, peer)
 
-	if err := Verify(req.Payload, req.Signature, s.secret); err != nil {
-		fmt.Fprintf(os.Stderr, "invalid signature: %v\n", err)
+	if req.Stream {
+		s.handleStream(ctx, conn, enc, req.Payload)
 		return
 	}
 
-	responsePayload, err := handler(req.Payload)
+	if s.timeouts.Handler > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeouts.Handler)
+		defer cancel()
+	}
+	responsePayload, err := handler(ctx, req.Payload)
 	resp := &Response{}
-	if err != nil {
+	var unknownErr *UnknownCommandError
+	if errors.As(err, &unknownErr) {
+		resp.Error = err.Error()
+		resp.Code = CodeUnknownCommand
+	} else if err != nil {
 		resp.Error = err.Error()
 	} else {
 		resp.Payload = responsePayload
 	}
+	enc.encode(resp)
+}
+
+// checkPeer returns the peer of conn if it is the daemon's own user.
+func (s *Server) checkPeer(conn net.Conn) (Peer, error) {
+	peer, err := s.peerOf(conn)
+	if err != nil {
+		if peerCredentialsSupported {
+			return peer, fmt.Errorf("failed to read peer credentials: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "failed to read peer credentials: %v\n", err)
+		return peer, nil
+	}
+	if peerCredentialsSupported && peer.UID != s.uid {
+		return peer, fmt.Errorf("peer uid %d does not match daemon uid %d", peer.UID, s.uid)
+	}
+	return peer, nil
+}
+
+// authenticate checks that the request carries a valid signature and is not
+// a replay.
+func (s *Server) authenticate(req *Request) error {
+	if err := Verify(req.signedBytes(), req.Signature, s.secret); err != nil {
+		return err
+	}
+	return s.replay.check(req)
+}
+
+// responseEncoder signs and writes the responses sent on one connection.
+type responseEncoder struct {
+	conn    net.Conn
+	enc     *json.Encoder
+	nonce   string
+	secret  []byte
+	seq     int
+	timeout time.Duration
+}
 
-	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+func (e *responseEncoder) encode(resp *Response) error {
+	resp.ProtocolVersion = ProtocolVersion
+	signResponse(resp, e.nonce, e.seq, e.secret)
+	e.seq++
+	if e.timeout > 0 {
+		_ = e.conn.SetWriteDeadline(time.Now().Add(e.timeout))
+	}
+	err := e.enc.Encode(resp)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to encode response: %v\n", err)
 	}
+	return err
+}
+
+func (s *Server) handleStream(ctx context.Context, conn net.Conn, enc *responseEncoder, payload []byte) {
+	if s.streamHandler == nil {
+		enc.encode(&Response{Error: "streaming is not supported"})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The client never writes after the request, so a read returning means it
+	// has gone away.
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		cancel()
+	}()
+
+	send := func(payload []byte) error {
+		return enc.encode(&Response{Payload: payload})
+	}
+	if err := s.streamHandler(ctx, payload, send); err != nil && ctx.Err() == nil {
+		enc.encode(&Response{Error: err.Error()})
+	}
 }
 
-// Close closes the server's listener.
+// Close closes the server's listener and ends any open streams.
 func (s *Server) Close() error {
+	s.cancel()
 	return s.listener.Close()
 }
 
+// Activated reports whether the server was started by socket activation.
+func (s *Server) Activated() bool {
+	return s.activated
+}
+
 // SocketPath returns the path to the server's socket file.
 func (s *Server) SocketPath() string {
 	return s.socketPath
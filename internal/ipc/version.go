@@ -0,0 +1,118 @@
+package ipc
+
+import (
+	"fmt"
+	"runtime/debug"
+	"slices"
+)
+
+// ProtocolVersion is the IPC protocol version spoken by this build. It is
+// bumped whenever the envelope or a payload changes in a way an older peer
+// cannot handle.
+//
+// Version 2 added request timestamps, nonces and signed responses.
+const ProtocolVersion = 2
+
+// MinProtocolVersion is the oldest protocol version this build still accepts.
+const MinProtocolVersion = 2
+
+// Response codes that let the client tell protocol errors apart from handler
+// errors.
+const (
+	CodeVersionMismatch = "version_mismatch"
+	CodeUnknownCommand  = "unknown_command"
+)
+
+// Capabilities advertised by the daemon in its hello response.
+const (
+	CapabilityGrant       = "grant"
+	CapabilityRevoke      = "revoke"
+	CapabilityRenew       = "renew"
+	CapabilityStatus      = "status"
+	CapabilityCleanup     = "cleanup"
+	CapabilityRetry       = "retry"
+	CapabilitySubscribe   = "subscribe"
+	CapabilityMetrics     = "metrics"
+	CapabilityShellLeases = "shell-leases"
+)
+
+// HelloRequest is the payload of the handshake a client sends to learn what
+// the daemon supports.
+type HelloRequest struct {
+	Command         string
+	ProtocolVersion int
+	ClientVersion   string
+}
+
+// HelloResponse describes the daemon.
+type HelloResponse struct {
+	ProtocolVersion    int
+	MinProtocolVersion int
+	DaemonVersion      string
+	Capabilities       []string
+	// Deprecated maps commands the daemon still accepts but will remove to
+	// the command that replaces them.
+	Deprecated map[string]string `json:",omitempty"`
+}
+
+// Supports reports whether the daemon advertised capability.
+func (h *HelloResponse) Supports(capability string) bool {
+	return slices.Contains(h.Capabilities, capability)
+}
+
+// VersionMismatchError is returned when the CLI and daemon speak incompatible
+// protocol versions, or the daemon does not know a command the CLI sent.
+type VersionMismatchError struct {
+	ClientProtocol int
+	// DaemonProtocol is zero when the daemon is too old to report it.
+	DaemonProtocol int
+	// DaemonOlder is true when the daemon must be restarted with the
+	// installed version, and false when the CLI must be upgraded.
+	DaemonOlder bool
+	// Command is set when the mismatch was detected by an unknown command.
+	Command string
+}
+
+func (e *VersionMismatchError) Error() string {
+	versions := ""
+	if e.DaemonProtocol != 0 {
+		versions = fmt.Sprintf(" (daemon protocol %d, CLI protocol %d)", e.DaemonProtocol, e.ClientProtocol)
+	}
+	if e.DaemonOlder {
+		if e.Command != "" {
+			return fmt.Sprintf("the env-lease daemon does not support '%s' because it is older than the CLI%s; run 'env-lease daemon reload' to restart it", e.Command, versions)
+		}
+		return fmt.Sprintf("the env-lease daemon is older than the CLI%s; run 'env-lease daemon reload' to restart it", versions)
+	}
+	return fmt.Sprintf("the env-lease CLI is older than the running daemon%s; upgrade env-lease, or run 'env-lease daemon reload' to restart the daemon with this version", versions)
+}
+
+// UnknownCommandError is returned by handlers for commands they do not know.
+// The server reports it with CodeUnknownCommand so the client can explain the
+// version mismatch.
+type UnknownCommandError struct {
+	Command string
+}
+
+func (e *UnknownCommandError) Error() string {
+	return fmt.Sprintf("unknown command: %s", e.Command)
+}
+
+// checkVersion returns an error if a peer speaking version cannot talk to
+// this build.
+func checkVersion(version int) error {
+	if version < MinProtocolVersion || version > ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d: daemon supports %d to %d", version, MinProtocolVersion, ProtocolVersion)
+	}
+	return nil
+}
+
+// BuildVersion returns the module version this binary was built from, or
+// "(devel)" for local builds.
+func BuildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" {
+		return "(devel)"
+	}
+	return info.Main.Version
+}
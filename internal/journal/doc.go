@@ -0,0 +1,6 @@
+// Package journal records grants the CLI has started writing to disk but the
+// daemon has not yet acknowledged. Each grant is one JSON file in the journal
+// directory; it is written before any secret reaches a destination and
+// removed once the daemon tracks the leases. A file left behind means the CLI
+// died in between, and the daemon replays it so the secrets are not leaked.
+package journal
@@ -0,0 +1,174 @@
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/fileutil"
+	"github.com/mblarsen/env-lease/internal/ipc"
+)
+
+// Journal is a directory of pending grant entries.
+type Journal struct {
+	dir string
+}
+
+// Entry is a grant that was started by a CLI process.
+type Entry struct {
+	PID        int         `json:"pid"`
+	CreatedAt  time.Time   `json:"created_at"`
+	ConfigFile string      `json:"config_file"`
+	Leases     []ipc.Lease `json:"leases"`
+
+	path string
+}
+
+// Pending is an entry being written by the current process. A nil *Pending
+// is valid and records nothing, which is used when journaling is disabled.
+type Pending struct {
+	entry Entry
+}
+
+// New returns the journal stored in dir.
+func New(dir string) *Journal {
+	return &Journal{dir: dir}
+}
+
+// Begin starts a journal entry for a grant of leases from configFile. Nothing
+// is written until the first lease is added.
+func (j *Journal) Begin(configFile string) *Pending {
+	now := time.Now()
+	pid := os.Getpid()
+	return &Pending{entry: Entry{
+		PID:        pid,
+		CreatedAt:  now,
+		ConfigFile: configFile,
+		path:       filepath.Join(j.dir, fmt.Sprintf("%d-%d.json", pid, now.UnixNano())),
+	}}
+}
+
+// Add records lease in the entry. It must be called before the lease's
+// secret is written, and the write must not happen if it fails. If the write
+// itself fails, the lease must be removed again with Remove.
+func (p *Pending) Add(lease ipc.Lease) error {
+	if p == nil {
+		return nil
+	}
+	p.entry.Leases = append(p.entry.Leases, lease)
+	return p.write()
+}
+
+// Remove drops lease from the entry again after its secret could not be
+// written, so the daemon never adopts, and later blanks, a value the grant
+// did not write. The entry file is deleted once it holds no leases.
+func (p *Pending) Remove(lease ipc.Lease) error {
+	if p == nil {
+		return nil
+	}
+	for i := len(p.entry.Leases) - 1; i >= 0; i-- {
+		l := p.entry.Leases[i]
+		if l.Source == lease.Source && l.Destination == lease.Destination && l.Variable == lease.Variable {
+			p.entry.Leases = append(p.entry.Leases[:i], p.entry.Leases[i+1:]...)
+			break
+		}
+	}
+	if len(p.entry.Leases) == 0 {
+		if err := os.Remove(p.entry.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove grant journal entry: %w", err)
+		}
+		return nil
+	}
+	return p.write()
+}
+
+func (p *Pending) write() error {
+	data, err := json.MarshalIndent(p.entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal grant journal entry: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p.entry.path), 0700); err != nil {
+		return fmt.Errorf("failed to create grant journal: %w", err)
+	}
+	if _, err := fileutil.AtomicWriteFile(p.entry.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write grant journal entry: %w", err)
+	}
+	return nil
+}
+
+// Commit removes the entry once the daemon has acknowledged the grant.
+func (p *Pending) Commit() error {
+	if p == nil || len(p.entry.Leases) == 0 {
+		return nil
+	}
+	if err := os.Remove(p.entry.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove grant journal entry: %w", err)
+	}
+	return nil
+}
+
+// Entries returns the entries in the journal. Files that cannot be parsed are
+// renamed with a .corrupt suffix and returned as errors alongside the entries
+// that could.
+func (j *Journal) Entries() ([]*Entry, error) {
+	files, err := os.ReadDir(j.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read grant journal: %w", err)
+	}
+
+	var entries []*Entry
+	var errs []error
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(j.dir, file.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		entry := &Entry{path: path}
+		if err := json.Unmarshal(data, entry); err != nil {
+			// Set the file aside so it is reported once rather than on every
+			// replay.
+			_ = os.Rename(path, path+".corrupt")
+			errs = append(errs, fmt.Errorf("malformed grant journal entry %s: %w", path, err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, errors.Join(errs...)
+}
+
+// Remove deletes entry from the journal.
+func (j *Journal) Remove(entry *Entry) error {
+	if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove grant journal entry: %w", err)
+	}
+	return nil
+}
+
+// Path returns the file the entry is stored in.
+func (e *Entry) Path() string {
+	return e.path
+}
+
+// InProgress reports whether the process that wrote the entry is still
+// running, in which case its grant may not have reached the daemon yet.
+func (e *Entry) InProgress() bool {
+	process, err := os.FindProcess(e.PID)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,83 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPending_AddAndCommit(t *testing.T) {
+	j := New(filepath.Join(t.TempDir(), "pending"))
+	pending := j.Begin("/project/env-lease.toml")
+
+	entries, err := j.Entries()
+	require.NoError(t, err)
+	assert.Empty(t, entries, "nothing is written before the first lease")
+
+	require.NoError(t, pending.Add(ipc.Lease{Source: "op://vault/item/a", Destination: "/project/.envrc", Variable: "A"}))
+	require.NoError(t, pending.Add(ipc.Lease{Source: "op://vault/item/b", Destination: "/project/.envrc", Variable: "B"}))
+
+	entries, err = j.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, os.Getpid(), entries[0].PID)
+	assert.Equal(t, "/project/env-lease.toml", entries[0].ConfigFile)
+	assert.Len(t, entries[0].Leases, 2)
+	assert.True(t, entries[0].InProgress())
+
+	require.NoError(t, pending.Commit())
+	entries, err = j.Entries()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestPending_Remove(t *testing.T) {
+	j := New(t.TempDir())
+	pending := j.Begin("/project/env-lease.toml")
+	a := ipc.Lease{Source: "op://vault/item/a", Destination: "/project/.envrc", Variable: "A"}
+	b := ipc.Lease{Source: "op://vault/item/b", Destination: "/project/.envrc", Variable: "B"}
+	require.NoError(t, pending.Add(a))
+	require.NoError(t, pending.Add(b))
+
+	require.NoError(t, pending.Remove(b))
+	entries, err := j.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, []ipc.Lease{a}, entries[0].Leases)
+
+	require.NoError(t, pending.Remove(a))
+	entries, err = j.Entries()
+	require.NoError(t, err)
+	assert.Empty(t, entries, "an entry without leases is removed")
+}
+
+func TestPending_NilIsNoop(t *testing.T) {
+	var pending *Pending
+	assert.NoError(t, pending.Add(ipc.Lease{Source: "op://vault/item/a"}))
+	assert.NoError(t, pending.Remove(ipc.Lease{Source: "op://vault/item/a"}))
+	assert.NoError(t, pending.Commit())
+}
+
+func TestEntries_SetsAsideMalformedFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "1-1.json"), []byte("{"), 0600))
+	j := New(dir)
+
+	entries, err := j.Entries()
+	assert.Error(t, err)
+	assert.Empty(t, entries)
+	assert.FileExists(t, filepath.Join(dir, "1-1.json.corrupt"))
+
+	_, err = j.Entries()
+	assert.NoError(t, err)
+}
+
+func TestEntry_InProgressForExitedProcess(t *testing.T) {
+	// PIDs are capped well below this on Linux and macOS.
+	entry := &Entry{PID: 1 << 30}
+	assert.False(t, entry.InProgress())
+}
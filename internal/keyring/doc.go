@@ -0,0 +1,5 @@
+// Package keyring stores small secrets in the operating system keyring: the
+// macOS login keychain, or the Secret Service (GNOME Keyring, KWallet) on
+// Linux. It drives the platform's command-line tool rather than linking
+// against the keyring directly.
+package keyring
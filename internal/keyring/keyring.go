@@ -0,0 +1,67 @@
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrNotFound is returned by Get when no secret is stored for the item.
+var ErrNotFound = errors.New("secret not found in keyring")
+
+// ErrUnsupported is returned on platforms without a supported keyring.
+var ErrUnsupported = errors.New("no supported keyring on this platform")
+
+// Get returns the secret stored for service and account.
+func Get(service, account string) (string, error) {
+	return get(service, account)
+}
+
+// Set stores secret for service and account, replacing any existing secret.
+func Set(service, account, secret string) error {
+	return set(service, account, secret)
+}
+
+// toolError is returned by run when a keyring tool exits unsuccessfully.
+type toolError struct {
+	path   string
+	stdout string
+	stderr string
+	err    *exec.ExitError
+}
+
+func (e *toolError) Error() string {
+	return fmt.Sprintf("%s failed: %s: %v", e.path, e.stderr, e.err)
+}
+
+func (e *toolError) Unwrap() error {
+	return e.err
+}
+
+// silentExit reports whether the tool exited with code and printed nothing,
+// which is how some tools report that no item matched.
+func (e *toolError) silentExit(code int) bool {
+	return e.err.ExitCode() == code && e.stdout == "" && e.stderr == ""
+}
+
+// run executes a keyring tool and returns its trimmed stdout.
+func run(cmd *exec.Cmd) (string, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", &toolError{
+				path:   cmd.Path,
+				stdout: strings.TrimSpace(string(out)),
+				stderr: strings.TrimSpace(stderr.String()),
+				err:    exitErr,
+			}
+		}
+		return "", fmt.Errorf("failed to execute %s: %w", cmd.Path, err)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
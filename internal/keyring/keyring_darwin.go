@@ -0,0 +1,32 @@
+//go:build darwin
+// +build darwin
+
+package keyring
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// errItemNotFound is the exit status of `security` when no item matches.
+const errItemNotFound = 44
+
+func get(service, account string) (string, error) {
+	secret, err := run(exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w"))
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == errItemNotFound {
+		return "", ErrNotFound
+	}
+	return secret, err
+}
+
+func set(service, account, secret string) error {
+	// -U updates the item if it already exists. A trailing -w makes security
+	// prompt for the password, twice, so it is read from stdin rather than
+	// left on the command line for any process to see.
+	cmd := exec.Command("security", "add-generic-password", "-U", "-s", service, "-a", account, "-w")
+	cmd.Stdin = strings.NewReader(secret + "\n" + secret + "\n")
+	_, err := run(cmd)
+	return err
+}
@@ -0,0 +1,55 @@
+//go:build darwin
+// +build darwin
+
+package keyring
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSecurity puts a security on PATH that keeps one password in dir, exits
+// 44 when it has none, and records the arguments it was run with.
+func fakeSecurity(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	script := `#!/bin/sh
+store="` + filepath.Join(dir, "password") + `"
+echo "$@" >> "` + filepath.Join(dir, "args") + `"
+case "$1" in
+find-generic-password)
+	[ -f "$store" ] || exit 44
+	cat "$store"
+	;;
+add-generic-password)
+	read -r password
+	read -r retyped
+	[ "$password" = "$retyped" ] || exit 1
+	echo "$password" > "$store"
+	;;
+esac
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "security"), []byte(script), 0700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestGetSet(t *testing.T) {
+	dir := fakeSecurity(t)
+
+	_, err := Get("env-lease", "state-key")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, Set("env-lease", "state-key", "0123abcd"))
+	secret, err := Get("env-lease", "state-key")
+	require.NoError(t, err)
+	assert.Equal(t, "0123abcd", secret)
+
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(args), "0123abcd", "the secret must not be passed on the command line")
+}
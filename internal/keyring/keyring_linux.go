@@ -0,0 +1,34 @@
+//go:build linux
+// +build linux
+
+package keyring
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+func get(service, account string) (string, error) {
+	secret, err := run(exec.Command("secret-tool", "lookup", "service", service, "account", account))
+	// Current libsecret exits with status 1 and prints nothing when no item
+	// matches; older versions exit successfully with no output.
+	var toolErr *toolError
+	if errors.As(err, &toolErr) && toolErr.silentExit(1) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if secret == "" {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+func set(service, account, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", service+" "+account, "service", service, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	_, err := run(cmd)
+	return err
+}
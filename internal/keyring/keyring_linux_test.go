@@ -0,0 +1,59 @@
+//go:build linux
+// +build linux
+
+package keyring
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSecretTool puts a secret-tool on PATH that keeps one secret in dir and,
+// like current libsecret, exits 1 without output when it has none.
+func fakeSecretTool(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	script := `#!/bin/sh
+store="` + filepath.Join(dir, "secret") + `"
+case "$1" in
+lookup)
+	[ -f "$store" ] || exit 1
+	cat "$store"
+	;;
+store)
+	cat > "$store"
+	;;
+esac
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret-tool"), []byte(script), 0700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestGetSet(t *testing.T) {
+	fakeSecretTool(t)
+
+	_, err := Get("env-lease", "state-key")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, Set("env-lease", "state-key", "0123abcd"))
+	secret, err := Get("env-lease", "state-key")
+	require.NoError(t, err)
+	assert.Equal(t, "0123abcd", secret)
+}
+
+func TestGet_ReportsToolFailures(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho 'Cannot autolaunch D-Bus without X11 $DISPLAY' >&2\nexit 1\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret-tool"), []byte(script), 0700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	_, err := Get("env-lease", "state-key")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotFound)
+	assert.Contains(t, err.Error(), "Cannot autolaunch D-Bus")
+}
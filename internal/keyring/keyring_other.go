@@ -0,0 +1,12 @@
+//go:build !darwin && !linux
+// +build !darwin,!linux
+
+package keyring
+
+func get(service, account string) (string, error) {
+	return "", ErrUnsupported
+}
+
+func set(service, account, secret string) error {
+	return ErrUnsupported
+}
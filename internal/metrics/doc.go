@@ -0,0 +1,3 @@
+// Package metrics implements a small registry that renders metrics in the
+// Prometheus text exposition format.
+package metrics
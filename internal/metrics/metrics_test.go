@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryWriteText(t *testing.T) {
+	r := NewRegistry()
+	grants := r.NewCounterVec("env_lease_grants_total", "Leases granted.", "lease_type")
+	r.NewGaugeFunc("env_lease_retry_queue_depth", "Queued revocations.", func() []Sample {
+		return []Sample{{Value: 3}}
+	})
+	latency := r.NewHistogramVec("env_lease_ipc_request_duration_seconds", "IPC latency.", []float64{0.1, 1}, "command")
+
+	grants.Inc("env")
+	grants.Inc("env")
+	grants.Inc("file")
+	latency.Observe(0.05, "status")
+	latency.Observe(0.5, "status")
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	out := buf.String()
+
+	assert.Contains(t, out, "# TYPE env_lease_grants_total counter\n")
+	assert.Contains(t, out, `env_lease_grants_total{lease_type="env"} 2`)
+	assert.Contains(t, out, `env_lease_grants_total{lease_type="file"} 1`)
+	assert.Contains(t, out, "env_lease_retry_queue_depth 3\n")
+	assert.Contains(t, out, `env_lease_ipc_request_duration_seconds_bucket{command="status",le="0.1"} 1`)
+	assert.Contains(t, out, `env_lease_ipc_request_duration_seconds_bucket{command="status",le="1"} 2`)
+	assert.Contains(t, out, `env_lease_ipc_request_duration_seconds_bucket{command="status",le="+Inf"} 2`)
+	assert.Contains(t, out, `env_lease_ipc_request_duration_seconds_count{command="status"} 2`)
+}
+
+func TestLabelValueEscaping(t *testing.T) {
+	r := NewRegistry()
+	grants := r.NewCounterVec("env_lease_grants_total", "Leases granted.", "project")
+	grants.Inc("a\"b\\c\nd\té")
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	assert.Contains(t, buf.String(), `env_lease_grants_total{project="a\"b\\c\nd`+"\t"+`é"} 1`)
+}
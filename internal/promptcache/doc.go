@@ -0,0 +1,6 @@
+// Package promptcache is a summary of the daemon's active leases that the
+// daemon rewrites whenever its state changes. 'env-lease prompt' runs on
+// every shell prompt, which is too often for a signed round trip to the
+// daemon, so it reads this file instead. The cache holds no secrets, only
+// when each project's leases expire.
+package promptcache
@@ -0,0 +1,88 @@
+package promptcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/fileutil"
+)
+
+// Cache summarizes the active leases by the config file they were granted
+// from.
+type Cache struct {
+	UpdatedAt time.Time          `json:"updated_at"`
+	Projects  map[string]Project `json:"projects"`
+}
+
+// Project summarizes the leases of one config file.
+type Project struct {
+	// Expires holds the expiry of each lease, earliest first.
+	Expires []time.Time `json:"expires"`
+	// Failed counts revocations that are being retried or were given up on.
+	Failed int `json:"failed,omitempty"`
+}
+
+// Write replaces the cache at path.
+func Write(path string, cache Cache) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return fmt.Errorf("failed to marshal prompt cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create prompt cache directory: %w", err)
+	}
+	if _, err := fileutil.AtomicWriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write prompt cache: %w", err)
+	}
+	return nil
+}
+
+// Read loads the cache at path.
+func Read(path string) (Cache, error) {
+	var cache Cache
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache, err
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return cache, fmt.Errorf("malformed prompt cache %s: %w", path, err)
+	}
+	return cache, nil
+}
+
+// Find returns the project of configFile or, failing that, of the nearest
+// config file with the same name in a parent directory, so the prompt still
+// shows a project's leases in its subdirectories.
+func (c Cache) Find(configFile string) (Project, bool) {
+	dir, name := filepath.Split(configFile)
+	dir = filepath.Clean(dir)
+	for {
+		if project, ok := c.Projects[filepath.Join(dir, name)]; ok {
+			return project, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return Project{}, false
+		}
+		dir = parent
+	}
+}
+
+// Active returns how many of the project's leases have not expired at now,
+// and when the first of them expires. The daemon revokes expired leases
+// within a second, but the cache may be older than that if it stopped.
+func (p Project) Active(now time.Time) (count int, next time.Time) {
+	for _, expires := range p.Expires {
+		if !expires.After(now) {
+			continue
+		}
+		if count == 0 {
+			next = expires
+		}
+		count++
+	}
+	return count, next
+}
@@ -0,0 +1,63 @@
+package promptcache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "prompt.json")
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	cache := Cache{
+		UpdatedAt: now,
+		Projects: map[string]Project{
+			"/work/app/env-lease.toml": {Expires: []time.Time{now.Add(time.Minute)}, Failed: 1},
+		},
+	}
+	require.NoError(t, Write(path, cache))
+
+	read, err := Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, cache, read)
+}
+
+func TestCache_Find(t *testing.T) {
+	cache := Cache{Projects: map[string]Project{
+		"/work/app/env-lease.toml":     {Failed: 1},
+		"/work/app/sub/other.toml":     {Failed: 2},
+		"/work/env-lease.toml":         {Failed: 3},
+		"/work/app/nested/custom.toml": {Failed: 4},
+	}}
+
+	project, ok := cache.Find("/work/app/env-lease.toml")
+	assert.True(t, ok)
+	assert.Equal(t, 1, project.Failed)
+
+	project, ok = cache.Find("/work/app/src/pkg/env-lease.toml")
+	assert.True(t, ok)
+	assert.Equal(t, 1, project.Failed)
+
+	project, ok = cache.Find("/work/lib/env-lease.toml")
+	assert.True(t, ok)
+	assert.Equal(t, 3, project.Failed)
+
+	_, ok = cache.Find("/home/env-lease.toml")
+	assert.False(t, ok)
+}
+
+func TestProject_Active(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	project := Project{Expires: []time.Time{now.Add(-time.Second), now, now.Add(time.Minute), now.Add(time.Hour)}}
+
+	count, next := project.Active(now)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, now.Add(time.Minute), next)
+
+	count, next = project.Active(now.Add(2 * time.Hour))
+	assert.Zero(t, count)
+	assert.True(t, next.IsZero())
+}
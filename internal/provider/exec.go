@@ -1,16 +1,19 @@
 package provider
 
-import "os/exec"
+import (
+	"context"
+	"os/exec"
+)
 
-// execer is an interface to allow mocking of exec.Command.
+// execer is an interface to allow mocking of exec.CommandContext.
 type execer interface {
-	Command(name string, arg ...string) *exec.Cmd
+	CommandContext(ctx context.Context, name string, arg ...string) *exec.Cmd
 }
 
 type realExecer struct{}
 
-func (e *realExecer) Command(name string, arg ...string) *exec.Cmd {
-	return exec.Command(name, arg...)
+func (e *realExecer) CommandContext(ctx context.Context, name string, arg ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, name, arg...)
 }
 
 // Overridable for testing.
@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/mblarsen/env-lease/internal/config"
@@ -10,7 +11,10 @@ import (
 type MockProvider struct{}
 
 // Fetch returns a dummy secret value, or an error if the sourceURI is "mock-fail".
-func (p *MockProvider) Fetch(sourceURI string) (string, error) {
+func (p *MockProvider) Fetch(ctx context.Context, sourceURI string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	if sourceURI == "mock-fail" {
 		return "", fmt.Errorf("failed to fetch mock secret")
 	}
@@ -21,12 +25,12 @@ func (p *MockProvider) Fetch(sourceURI string) (string, error) {
 }
 
 // FetchLeases iterates through leases and calls Fetch for each one.
-func (p *MockProvider) FetchLeases(leases []config.Lease) (map[string]string, []ProviderError) {
+func (p *MockProvider) FetchLeases(ctx context.Context, leases []config.Lease) (map[string]string, []ProviderError) {
 	secrets := make(map[string]string)
 	var errors []ProviderError
 
 	for _, l := range leases {
-		secret, err := p.Fetch(l.Source)
+		secret, err := p.Fetch(ctx, l.Source)
 		if err != nil {
 			errors = append(errors, ProviderError{Lease: l, Err: err})
 			continue
@@ -36,3 +40,14 @@ func (p *MockProvider) FetchLeases(leases []config.Lease) (map[string]string, []
 
 	return secrets, errors
 }
+
+// Check reports "mock-fail" as missing, like Fetch.
+func (p *MockProvider) Check(ctx context.Context, sourceURI string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if sourceURI == "mock-fail" {
+		return fmt.Errorf("mock secret not found")
+	}
+	return nil
+}
@@ -1,11 +1,15 @@
 package provider
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/mblarsen/env-lease/internal/config"
 )
@@ -31,6 +35,17 @@ type opFile struct {
 	Name string `json:"name"`
 }
 
+// opField is a field of a 1Password item. Its value is left out so Check
+// never decodes a secret.
+type opField struct {
+	ID      string `json:"id"`
+	Label   string `json:"label"`
+	Section *struct {
+		ID    string `json:"id"`
+		Label string `json:"label"`
+	} `json:"section"`
+}
+
 // sanitizeOpURI defensively trims quotes/space and drops any trailing '=' run.
 // This guards against cases where a revoke/format string like "%s=" leaks into
 // a later op:// field path. Canonical 1Password field paths never end with '='.
@@ -43,7 +58,7 @@ func sanitizeOpURI(u string) string {
 
 // resolveFileURI resolves a friendly `op+file://<item-name>/<file-name>` URI
 // to a canonical `op://<vault-id>/<item-id>/<file-id>` URI.
-func (p *OnePasswordCLI) resolveFileURI(sourceURI string) (string, error) {
+func (p *OnePasswordCLI) resolveFileURI(ctx context.Context, sourceURI string) (string, error) {
 	parts := strings.SplitN(strings.TrimPrefix(sourceURI, "op+file://"), "/", 2)
 	if len(parts) != 2 {
 		return "", fmt.Errorf("invalid op+file URI format: %s", sourceURI)
@@ -54,18 +69,9 @@ func (p *OnePasswordCLI) resolveFileURI(sourceURI string) (string, error) {
 	if p.Account != "" {
 		args = append(args, "--account", p.Account)
 	}
-	cmd := cmdExecer.Command("op", args...)
-	output, err := cmd.Output()
+	output, err := runOp(ctx, "item get", opCommand(ctx, args, nil))
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return "", &OpError{
-				Command:  "item get",
-				ExitCode: exitErr.ExitCode(),
-				Stderr:   string(exitErr.Stderr),
-				Err:      err,
-			}
-		}
-		return "", fmt.Errorf("failed to execute 'op item get': %w", err)
+		return "", err
 	}
 
 	var item opItem
@@ -82,12 +88,65 @@ func (p *OnePasswordCLI) resolveFileURI(sourceURI string) (string, error) {
 	return "", fmt.Errorf("file '%s' not found in item '%s'", fileName, itemName)
 }
 
+// Check confirms that the vault, item and field or file of a source exist.
+// It reads the item's metadata, which 'op' returns along with field values;
+// those are never decoded.
+func (p *OnePasswordCLI) Check(ctx context.Context, sourceURI string) error {
+	uri := sanitizeOpURI(sourceURI)
+	if strings.HasPrefix(uri, "op+file://") {
+		_, err := p.resolveFileURI(ctx, uri)
+		return err
+	}
+
+	ref, _, _ := strings.Cut(strings.TrimPrefix(uri, "op://"), "?")
+	parts := strings.Split(ref, "/")
+	if !strings.HasPrefix(uri, "op://") || len(parts) < 3 || len(parts) > 4 {
+		return fmt.Errorf("invalid secret reference '%s': expected op://<vault>/<item>/[<section>/]<field>", sourceURI)
+	}
+	vault, itemName, field := parts[0], parts[1], parts[len(parts)-1]
+	section := ""
+	if len(parts) == 4 {
+		section = parts[2]
+	}
+
+	args := []string{"item", "get", itemName, "--vault", vault, "--format", "json"}
+	if p.Account != "" {
+		args = append(args, "--account", p.Account)
+	}
+	output, err := runOp(ctx, "item get", opCommand(ctx, args, nil))
+	if err != nil {
+		return err
+	}
+	var item struct {
+		Fields []opField `json:"fields"`
+		Files  []opFile  `json:"files"`
+	}
+	if err := json.Unmarshal(output, &item); err != nil {
+		return fmt.Errorf("failed to parse 'op item get' output: %w", err)
+	}
+
+	for _, f := range item.Fields {
+		if f.ID != field && f.Label != field {
+			continue
+		}
+		if section == "" || (f.Section != nil && (f.Section.ID == section || f.Section.Label == section)) {
+			return nil
+		}
+	}
+	for _, f := range item.Files {
+		if f.ID == field || f.Name == field {
+			return nil
+		}
+	}
+	return fmt.Errorf("field '%s' not found in item '%s'", strings.Join(parts[2:], "/"), itemName)
+}
+
 // Fetch retrieves a secret from 1Password. It supports `op://` URIs for secrets
 // and documents, and `op+file://` for a user-friendly way to reference documents.
-func (p *OnePasswordCLI) Fetch(sourceURI string) (string, error) {
+func (p *OnePasswordCLI) Fetch(ctx context.Context, sourceURI string) (string, error) {
 	uri := sanitizeOpURI(sourceURI)
 	if strings.HasPrefix(uri, "op+file://") {
-		r, err := p.resolveFileURI(uri)
+		r, err := p.resolveFileURI(ctx, uri)
 		if err != nil {
 			return "", err
 		}
@@ -97,17 +156,14 @@ func (p *OnePasswordCLI) Fetch(sourceURI string) (string, error) {
 	if p.Account != "" {
 		args = append(args, "--account", p.Account)
 	}
-	out, err := cmdExecer.Command("op", args...).Output()
+	out, err := runOp(ctx, "read", opCommand(ctx, args, nil))
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return "", &OpError{Command: "read", ExitCode: exitErr.ExitCode(), Stderr: string(exitErr.Stderr), Err: err}
-		}
-		return "", fmt.Errorf("failed to execute 'op read': %w", err)
+		return "", err
 	}
 	return strings.TrimRight(string(out), "\n"), nil
 }
 
-func (p *OnePasswordCLI) FetchBulk(sources map[string]string) (map[string]string, error) {
+func (p *OnePasswordCLI) FetchBulk(ctx context.Context, sources map[string]string) (map[string]string, error) {
 	// Build a template that will echo NAME=VALUE per line.
 	// Use generated safe identifiers as placeholders and map them back to the original names.
 	var (
@@ -129,14 +185,9 @@ func (p *OnePasswordCLI) FetchBulk(sources map[string]string) (map[string]string
 	if p.Account != "" {
 		args = append(args, "--account", p.Account)
 	}
-	cmd := cmdExecer.Command("op", args...)
-	cmd.Stdin = strings.NewReader(b.String())
-	out, err := cmd.Output()
+	out, err := runOp(ctx, "inject", opCommand(ctx, args, strings.NewReader(b.String())))
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return nil, &OpError{Command: "inject", ExitCode: exitErr.ExitCode(), Stderr: string(exitErr.Stderr), Err: err}
-		}
-		return nil, fmt.Errorf("failed to execute 'op inject': %w", err)
+		return nil, err
 	}
 
 	results := make(map[string]string, len(sources))
@@ -159,23 +210,14 @@ func (p *OnePasswordCLI) FetchBulk(sources map[string]string) (map[string]string
 }
 
 // fetchWithRead retrieves a secret from 1Password using the `op read` command.
-func (p *OnePasswordCLI) fetchWithRead(sourceURI string) (string, error) {
+func (p *OnePasswordCLI) fetchWithRead(ctx context.Context, sourceURI string) (string, error) {
 	args := []string{"read", sourceURI}
 	if p.Account != "" {
 		args = append(args, "--account", p.Account)
 	}
-	cmd := cmdExecer.Command("op", args...)
-	output, err := cmd.Output()
+	output, err := runOp(ctx, "read", opCommand(ctx, args, nil))
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return "", &OpError{
-				Command:  "read",
-				ExitCode: exitErr.ExitCode(),
-				Stderr:   string(exitErr.Stderr),
-				Err:      err,
-			}
-		}
-		return "", fmt.Errorf("failed to execute 'op read': %w", err)
+		return "", err
 	}
 
 	if len(output) == 0 {
@@ -187,7 +229,7 @@ func (p *OnePasswordCLI) fetchWithRead(sourceURI string) (string, error) {
 
 // FetchLeases fetches secrets for a slice of leases, using `op inject` for op://
 // URIs and falling back to individual `op read` calls for op+file:// URIs.
-func (p *OnePasswordCLI) FetchLeases(leases []config.Lease) (map[string]string, []ProviderError) {
+func (p *OnePasswordCLI) FetchLeases(ctx context.Context, leases []config.Lease) (map[string]string, []ProviderError) {
 	secrets := make(map[string]string, len(leases))
 	var perrs []ProviderError
 
@@ -249,7 +291,7 @@ func (p *OnePasswordCLI) FetchLeases(leases []config.Lease) (map[string]string,
 			"account", batch.account,
 			"request_count", len(request))
 
-		res, err := sub.FetchBulk(request)
+		res, err := sub.FetchBulk(ctx, request)
 		if err != nil {
 			// attribute an error to each lease in this batch
 			for _, leases := range batch.leases {
@@ -283,7 +325,7 @@ func (p *OnePasswordCLI) FetchLeases(leases []config.Lease) (map[string]string,
 	// Fetch singletons
 	for _, l := range singletons {
 		slog.Debug("onepassword: fetch singleton start", "source", l.Source)
-		val, err := p.Fetch(l.Source)
+		val, err := p.Fetch(ctx, l.Source)
 		if err != nil {
 			perrs = append(perrs, ProviderError{Lease: l, Err: err})
 			slog.Debug("onepassword: fetch singleton error",
@@ -298,6 +340,38 @@ func (p *OnePasswordCLI) FetchLeases(leases []config.Lease) (map[string]string,
 	return secrets, perrs
 }
 
+// opWaitDelay bounds how long to wait for op's output pipes to close after it
+// is killed because ctx was cancelled.
+const opWaitDelay = 2 * time.Second
+
+// opCommand builds an op invocation that is killed when ctx is done.
+func opCommand(ctx context.Context, args []string, stdin io.Reader) *exec.Cmd {
+	cmd := cmdExecer.CommandContext(ctx, "op", args...)
+	cmd.Stdin = stdin
+	cmd.WaitDelay = opWaitDelay
+	return cmd
+}
+
+// runOp runs cmd and returns its output. A failure caused by ctx is reported
+// as a timeout or cancellation rather than as an op error.
+func runOp(ctx context.Context, command string, cmd *exec.Cmd) ([]byte, error) {
+	out, err := cmd.Output()
+	if err == nil {
+		return out, nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		if errors.Is(ctxErr, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("'op %s' timed out: %w", command, ctxErr)
+		}
+		return nil, fmt.Errorf("'op %s' was cancelled: %w", command, ctxErr)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil, &OpError{Command: command, ExitCode: exitErr.ExitCode(), Stderr: string(exitErr.Stderr), Err: err}
+	}
+	return nil, fmt.Errorf("failed to execute 'op %s': %w", command, err)
+}
+
 // OpError is a custom error for 1Password CLI errors.
 type OpError struct {
 	Command  string
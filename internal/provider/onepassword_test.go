@@ -1,11 +1,13 @@
 package provider
 
 import (
+	"context"
 	"errors"
 	"os/exec"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/mblarsen/env-lease/internal/config"
 )
@@ -14,8 +16,11 @@ type mockExecer struct {
 	CommandFunc func(name string, arg ...string) *exec.Cmd
 }
 
-func (m *mockExecer) Command(name string, arg ...string) *exec.Cmd {
-	return m.CommandFunc(name, arg...)
+// CommandContext rebuilds the command returned by CommandFunc so that it is
+// bound to ctx like a real op invocation.
+func (m *mockExecer) CommandContext(ctx context.Context, name string, arg ...string) *exec.Cmd {
+	cmd := m.CommandFunc(name, arg...)
+	return exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
 }
 
 func TestOnePasswordCLI_FetchLeases(t *testing.T) {
@@ -50,7 +55,7 @@ func TestOnePasswordCLI_FetchLeases(t *testing.T) {
 			{Variable: "VAR1", Source: "op://vault/item1", OpAccount: "account1"},
 			{Variable: "VAR2", Source: "op://vault/item2", OpAccount: "account2"},
 		}
-		_, errs := provider.FetchLeases(leases)
+		_, errs := provider.FetchLeases(context.Background(), leases)
 		if len(errs) > 0 {
 			t.Fatalf("unexpected errors: %v", errs)
 		}
@@ -89,7 +94,7 @@ func TestOnePasswordCLI_Fetch(t *testing.T) {
 		}
 
 		provider := &OnePasswordCLI{}
-		secret, err := provider.Fetch("op://vault/item/field")
+		secret, err := provider.Fetch(context.Background(), "op://vault/item/field")
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -107,7 +112,7 @@ func TestOnePasswordCLI_Fetch(t *testing.T) {
 		}
 
 		provider := &OnePasswordCLI{}
-		_, err := provider.Fetch("op://vault/item/secret")
+		_, err := provider.Fetch(context.Background(), "op://vault/item/secret")
 		if err == nil {
 			t.Fatal("expected an error, got nil")
 		}
@@ -121,7 +126,7 @@ func TestOnePasswordCLI_Fetch(t *testing.T) {
 		}
 
 		provider := &OnePasswordCLI{}
-		_, err := provider.Fetch("op://vault/item/secret")
+		_, err := provider.Fetch(context.Background(), "op://vault/item/secret")
 		if err == nil {
 			t.Fatal("expected an error, got nil")
 		}
@@ -144,7 +149,7 @@ func TestOnePasswordCLI_Fetch(t *testing.T) {
 		}
 
 		provider := &OnePasswordCLI{Account: "my-account"}
-		_, err := provider.Fetch("op://vault/item/secret")
+		_, err := provider.Fetch(context.Background(), "op://vault/item/secret")
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -156,6 +161,29 @@ func TestOnePasswordCLI_Fetch(t *testing.T) {
 	})
 }
 
+func TestOnePasswordCLI_FetchTimeout(t *testing.T) {
+	originalExecer := cmdExecer
+	defer func() { cmdExecer = originalExecer }()
+
+	cmdExecer = &mockExecer{
+		CommandFunc: func(name string, arg ...string) *exec.Cmd {
+			return exec.Command("sleep", "10")
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := (&OnePasswordCLI{}).Fetch(ctx, "op://vault/item/secret")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("fetch did not stop at the deadline, took %s", elapsed)
+	}
+}
+
 func equal(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -167,3 +195,33 @@ func equal(a, b []string) bool {
 	}
 	return true
 }
+
+func TestOnePasswordCLI_Check(t *testing.T) {
+	originalExecer := cmdExecer
+	defer func() { cmdExecer = originalExecer }()
+
+	var capturedArgs []string
+	cmdExecer = &mockExecer{
+		CommandFunc: func(name string, arg ...string) *exec.Cmd {
+			capturedArgs = arg
+			return exec.Command("echo", `{"fields":[{"id":"password","label":"password","value":"hunter2"},{"id":"x1","label":"token","section":{"id":"s1","label":"api"},"value":"t"}],"files":[{"id":"f1","name":"key.pem"}]}`)
+		},
+	}
+
+	p := &OnePasswordCLI{Account: "acct"}
+	for _, source := range []string{"op://Private/Login/password", "op://Private/Login/api/token", "op://Private/Login/key.pem", "op://Private/Login/password?attribute=otp"} {
+		if err := p.Check(context.Background(), source); err != nil {
+			t.Errorf("expected %s to exist, got %v", source, err)
+		}
+	}
+	want := "item get Login --vault Private --format json --account acct"
+	if got := strings.Join(capturedArgs, " "); got != want {
+		t.Errorf("expected args %q, got %q", want, got)
+	}
+
+	for _, source := range []string{"op://Private/Login/missing", "op://Private/Login/other/token", "op://Private/Login"} {
+		if err := p.Check(context.Background(), source); err == nil {
+			t.Errorf("expected an error for %s", source)
+		}
+	}
+}
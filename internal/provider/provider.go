@@ -1,6 +1,10 @@
 package provider
 
-import "github.com/mblarsen/env-lease/internal/config"
+import (
+	"context"
+
+	"github.com/mblarsen/env-lease/internal/config"
+)
 
 // ProviderError associates an error with a specific lease that failed.
 type ProviderError struct {
@@ -9,13 +13,14 @@ type ProviderError struct {
 }
 
 // SecretProvider defines the interface for fetching secrets from a backend.
+// Implementations must give up and return an error once ctx is done.
 type SecretProvider interface {
 	// Fetch retrieves a secret from the given source URI.
-	Fetch(sourceURI string) (string, error)
+	Fetch(ctx context.Context, sourceURI string) (string, error)
 	// FetchLeases retrieves secrets for a slice of leases.
 	// RETURN CONTRACT: the returned map MUST be keyed by Lease.Source (the source URI).
 	// This ensures a stable key across simple, file, and explode flows.
-	FetchLeases(leases []config.Lease) (map[string]string, []ProviderError)
+	FetchLeases(ctx context.Context, leases []config.Lease) (map[string]string, []ProviderError)
 }
 
 // BulkSecretProvider defines the interface for providers that can fetch multiple
@@ -23,5 +28,12 @@ type SecretProvider interface {
 type BulkSecretProvider interface {
 	SecretProvider
 	// FetchBulk retrieves multiple secrets from the given source URIs.
-	FetchBulk(sources map[string]string) (map[string]string, error)
+	FetchBulk(ctx context.Context, sources map[string]string) (map[string]string, error)
+}
+
+// SourceChecker is implemented by providers that can tell whether a source
+// exists without reading its value. 'env-lease plan' uses it.
+type SourceChecker interface {
+	// Check returns an error if sourceURI cannot be fetched.
+	Check(ctx context.Context, sourceURI string) error
 }
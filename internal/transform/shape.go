@@ -0,0 +1,68 @@
+package transform
+
+import "fmt"
+
+// shape is the kind of data between two pipeline steps.
+type shape int
+
+const (
+	shapeString shape = iota
+	shapeStructured
+	// shapeEither is what select returns: a string or, for an object,
+	// structured data.
+	shapeEither
+	shapeExploded
+)
+
+// CheckShape reports steps that would get input of the wrong kind, and a
+// pipeline that ends in structured data, without running the pipeline. It
+// finds the mistakes Run would only find once a secret has been read, like
+// 'select' on a string or 'explode' without a 'json' step before it.
+func (p *Pipeline) CheckShape() error {
+	current := shapeString
+	for _, t := range p.transformers {
+		switch t.(type) {
+		case *base64EncodeTransformer, *base64DecodeTransformer:
+			if current == shapeStructured {
+				return fmt.Errorf("%s: input must be a string", stepName(t))
+			}
+			current = shapeString
+		case *jsonTransformer, *tomlTransformer, *yamlTransformer:
+			if current == shapeStructured {
+				return fmt.Errorf("%s: input must be a string", stepName(t))
+			}
+			current = shapeStructured
+		case *toJSONTransformer, *toYamlTransformer, *toTomlTransformer:
+			current = shapeString
+		case *selectTransformer:
+			if current == shapeString {
+				return fmt.Errorf("select: input must be structured data; put 'json', 'toml' or 'yaml' before it")
+			}
+			current = shapeEither
+		case *explodeTransformer:
+			if current == shapeString {
+				return fmt.Errorf("explode: input must be structured data; put 'json', 'toml' or 'yaml' before it")
+			}
+			current = shapeExploded
+		}
+	}
+	if current == shapeStructured {
+		return fmt.Errorf("transforms produce structured data; end them with 'select', 'to_json' or 'explode'")
+	}
+	return nil
+}
+
+func stepName(t Transformer) string {
+	switch t.(type) {
+	case *base64EncodeTransformer:
+		return "base64-encode"
+	case *base64DecodeTransformer:
+		return "base64-decode"
+	case *jsonTransformer:
+		return "json"
+	case *tomlTransformer:
+		return "toml"
+	default:
+		return "yaml"
+	}
+}
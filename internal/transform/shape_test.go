@@ -0,0 +1,36 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckShape(t *testing.T) {
+	tests := []struct {
+		steps []string
+		err   string
+	}{
+		{[]string{"base64-decode"}, ""},
+		{[]string{"json", "select 'a'"}, ""},
+		{[]string{"json", "select 'a'", "explode"}, ""},
+		{[]string{"yaml", "to_json", "base64-encode"}, ""},
+		{[]string{"base64-decode", "json", "explode(prefix=APP_)"}, ""},
+		{[]string{"select 'a'"}, "select: input must be structured data"},
+		{[]string{"base64-decode", "explode"}, "explode: input must be structured data"},
+		{[]string{"json", "base64-encode"}, "base64-encode: input must be a string"},
+		{[]string{"json", "yaml"}, "yaml: input must be a string"},
+		{[]string{"toml"}, "transforms produce structured data"},
+	}
+	for _, tt := range tests {
+		p, err := NewPipeline(tt.steps)
+		require.NoError(t, err, tt.steps)
+		err = p.CheckShape()
+		if tt.err == "" {
+			assert.NoError(t, err, tt.steps)
+		} else {
+			assert.ErrorContains(t, err, tt.err, tt.steps)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package transform
+
+// Syntax describes the form of a transform step, for documentation and
+// config schemas.
+type Syntax struct {
+	// Name is the step itself, or the name of a step that takes arguments.
+	Name string
+	// Pattern matches the whole step if it takes arguments.
+	Pattern     string
+	Example     string
+	Description string
+}
+
+// Steps lists the syntax of every step NewPipeline accepts.
+var Steps = []Syntax{
+	{Name: "base64-encode", Description: "Encodes the input string to standard base64."},
+	{Name: "base64-decode", Description: "Decodes a base64-encoded input string."},
+	{Name: "json", Description: "Parses a JSON string into structured data."},
+	{Name: "toml", Description: "Parses a TOML string into structured data."},
+	{Name: "yaml", Description: "Parses a YAML string into structured data."},
+	{Name: "to_json", Description: "Converts structured data to a JSON string."},
+	{Name: "to_yaml", Description: "Converts structured data to a YAML string."},
+	{Name: "to_toml", Description: "Converts structured data to a TOML string."},
+	{
+		Name:        "select",
+		Pattern:     `^select .*$`,
+		Example:     "select 'database.password'",
+		Description: "Extracts a value from structured data using a quoted dot-notation path.",
+	},
+	{
+		Name:        "explode",
+		Pattern:     `^explode(\(\s*((filter|prefix)\s*=\s*[^,\s][^,]*(,\s*(filter|prefix)\s*=\s*[^,\s][^,]*)*)?\))?$`,
+		Example:     "explode(filter=DB_, prefix=APP_)",
+		Description: "Expands structured data into one variable per key. Takes optional filter and prefix arguments and must be the last step.",
+	},
+}
@@ -0,0 +1,44 @@
+package transform
+
+import (
+	"regexp"
+	"testing"
+)
+
+// TestStepsMatchNewPipeline keeps the published syntax and the steps
+// NewPipeline accepts in agreement.
+func TestStepsMatchNewPipeline(t *testing.T) {
+	steps := []string{
+		"base64-encode", "base64-decode", "json", "toml", "yaml", "to_json", "to_yaml", "to_toml",
+		"select 'a.b'", `select "a"`, "select a.b.c", "select",
+		"explode", "explode()", "explode( )", "explode(filter=DB_)", "explode(prefix=APP_)",
+		"explode(filter=DB_, prefix=APP_)", "explode( prefix = X_ ,filter=Y )", "explode(filter==x)",
+		"explode(filter=)", "explode(filter= )", "explode(filter=a,)", "explode(,)", "explode(other=x)",
+		"explode(filter=a", "explode(filter)", "explodes", "JSON", "json ", " json", "base64", "uppercase", "",
+	}
+	for _, step := range steps {
+		_, err := newTransformer(step)
+		built := err == nil
+		matched := false
+		for _, s := range Steps {
+			if s.Pattern == "" {
+				matched = matched || step == s.Name
+			} else {
+				matched = matched || regexp.MustCompile(s.Pattern).MatchString(step)
+			}
+		}
+		if built != matched {
+			t.Errorf("%q: newTransformer accepts it: %v, Steps match it: %v", step, built, matched)
+		}
+	}
+
+	for _, s := range Steps {
+		example := s.Name
+		if s.Pattern != "" {
+			example = s.Example
+		}
+		if _, err := newTransformer(example); err != nil {
+			t.Errorf("example %q of %s: %v", example, s.Name, err)
+		}
+	}
+}
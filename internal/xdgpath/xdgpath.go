@@ -4,8 +4,82 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 )
 
+// DefaultInstance is the daemon instance used when none is selected. Its
+// files live directly in the env-lease directories, where they were before
+// instances existed.
+const DefaultInstance = "default"
+
+// InstanceEnv is the environment variable that selects an instance when
+// SetInstance has not been called.
+const InstanceEnv = "ENV_LEASE_INSTANCE"
+
+var instanceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+var instance string
+
+// ValidateInstance checks that name can be used as an instance name.
+func ValidateInstance(name string) error {
+	if !instanceNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid instance name '%s': use up to 64 letters, digits, '-' and '_', starting with a letter or digit", name)
+	}
+	return nil
+}
+
+// EnvInstance returns the instance selected by $ENV_LEASE_INSTANCE, or
+// DefaultInstance if it is unset. An invalid name is an error rather than
+// falling back to the default, which would mix one instance's leases into
+// another's daemon.
+func EnvInstance() (string, error) {
+	name := os.Getenv(InstanceEnv)
+	if name == "" {
+		return DefaultInstance, nil
+	}
+	if err := ValidateInstance(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// SetInstance selects the daemon instance whose paths StatePath, RuntimePath
+// and ConfigPath return. An empty name falls back to $ENV_LEASE_INSTANCE,
+// which is validated like name.
+func SetInstance(name string) error {
+	if name == "" {
+		var err error
+		if name, err = EnvInstance(); err != nil {
+			return err
+		}
+	} else if err := ValidateInstance(name); err != nil {
+		return err
+	}
+	instance = name
+	return nil
+}
+
+// Instance returns the selected instance: the one set with SetInstance, else
+// $ENV_LEASE_INSTANCE, else DefaultInstance. An invalid environment value is
+// ignored here; SetInstance and EnvInstance report it.
+func Instance() string {
+	if instance != "" {
+		return instance
+	}
+	if name := os.Getenv(InstanceEnv); name != "" && ValidateInstance(name) == nil {
+		return name
+	}
+	return DefaultInstance
+}
+
+// instanceDir returns the env-lease directory for name under base.
+func instanceDir(base, name string) string {
+	if name == "" || name == DefaultInstance {
+		return filepath.Join(base, "env-lease")
+	}
+	return filepath.Join(base, "env-lease", "instances", name)
+}
+
 func getStateHome() (string, error) {
 	if stateHome := os.Getenv("XDG_STATE_HOME"); stateHome != "" {
 		return stateHome, nil
@@ -27,26 +101,78 @@ func getRuntimeDir() (string, error) {
 
 // StatePath returns the path for a state file, creating the directory if needed.
 func StatePath(elem ...string) (string, error) {
+	return InstanceStatePath(Instance(), elem...)
+}
+
+// InstanceStatePath is StatePath for the named instance.
+func InstanceStatePath(name string, elem ...string) (string, error) {
 	base, err := getStateHome()
 	if err != nil {
 		return "", err
 	}
-	dir := filepath.Join(base, "env-lease")
-	if err := os.MkdirAll(dir, 0700); err != nil {
+	return makeInstancePath(instanceDir(base, name), elem)
+}
+
+// ResolveInstanceStatePath is InstanceStatePath without creating the
+// directory, for callers that only read files the daemon created.
+func ResolveInstanceStatePath(name string, elem ...string) (string, error) {
+	base, err := getStateHome()
+	if err != nil {
 		return "", err
 	}
-	return filepath.Join(append([]string{dir}, elem...)...), nil
+	return filepath.Join(append([]string{instanceDir(base, name)}, elem...)...), nil
 }
 
 // RuntimePath returns the path for a runtime file, creating the directory if needed.
 func RuntimePath(elem ...string) (string, error) {
+	return InstanceRuntimePath(Instance(), elem...)
+}
+
+// InstanceRuntimePath is RuntimePath for the named instance.
+func InstanceRuntimePath(name string, elem ...string) (string, error) {
 	base, err := getRuntimeDir()
 	if err != nil {
 		return "", err
 	}
-	dir := filepath.Join(base, "env-lease")
+	return makeInstancePath(instanceDir(base, name), elem)
+}
+
+// ResolveInstanceRuntimePath is InstanceRuntimePath without creating the
+// directory, for callers that only read files the daemon created.
+func ResolveInstanceRuntimePath(name string, elem ...string) (string, error) {
+	base, err := getRuntimeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(append([]string{instanceDir(base, name)}, elem...)...), nil
+}
+
+// makeInstancePath creates dir and joins elem to it.
+func makeInstancePath(dir string, elem []string) (string, error) {
 	if err := os.MkdirAll(dir, 0700); err != nil {
 		return "", err
 	}
 	return filepath.Join(append([]string{dir}, elem...)...), nil
 }
+
+func getConfigHome() (string, error) {
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return configHome, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not get user home directory: %w", err)
+	}
+	return filepath.Join(home, ".config"), nil
+}
+
+// ConfigPath returns the path for a user configuration file. Unlike StatePath
+// and RuntimePath it does not create the directory, as configuration is
+// optional and written by the user.
+func ConfigPath(elem ...string) (string, error) {
+	base, err := getConfigHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(append([]string{instanceDir(base, Instance())}, elem...)...), nil
+}
@@ -0,0 +1,58 @@
+package xdgpath
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestInstancePaths(t *testing.T) {
+	stateHome := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateHome)
+	t.Setenv(InstanceEnv, "")
+	t.Cleanup(func() { instance = "" })
+
+	cases := []struct {
+		name     string
+		set      string
+		env      string
+		instance string
+		dir      string
+	}{
+		{name: "default", instance: DefaultInstance, dir: filepath.Join(stateHome, "env-lease")},
+		{name: "explicit default", set: DefaultInstance, instance: DefaultInstance, dir: filepath.Join(stateHome, "env-lease")},
+		{name: "from environment", env: "oss", instance: "oss", dir: filepath.Join(stateHome, "env-lease", "instances", "oss")},
+		{name: "flag wins over environment", set: "work", env: "oss", instance: "work", dir: filepath.Join(stateHome, "env-lease", "instances", "work")},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(InstanceEnv, tc.env)
+			if err := SetInstance(tc.set); err != nil {
+				t.Fatalf("SetInstance failed: %v", err)
+			}
+			if got := Instance(); got != tc.instance {
+				t.Errorf("expected instance %q, got %q", tc.instance, got)
+			}
+			path, err := StatePath("state.json")
+			if err != nil {
+				t.Fatalf("StatePath failed: %v", err)
+			}
+			if want := filepath.Join(tc.dir, "state.json"); path != want {
+				t.Errorf("expected %s, got %s", want, path)
+			}
+		})
+	}
+}
+
+func TestSetInstanceRejectsInvalidNames(t *testing.T) {
+	t.Cleanup(func() { instance = "" })
+	for _, name := range []string{"../work", "work/oss", "-work", "a b", "work."} {
+		if err := SetInstance(name); err == nil {
+			t.Errorf("expected an error for %q", name)
+		}
+		t.Setenv(InstanceEnv, name)
+		if err := SetInstance(""); err == nil {
+			t.Errorf("expected an error for %s=%q", InstanceEnv, name)
+		}
+		t.Setenv(InstanceEnv, "")
+	}
+}
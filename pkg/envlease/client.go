@@ -0,0 +1,225 @@
+package envlease
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/mblarsen/env-lease/internal/xdgpath"
+)
+
+// DefaultTimeout bounds every call except Subscribe.
+const DefaultTimeout = 5 * time.Second
+
+var (
+	// ErrNotRunning is returned when the daemon socket cannot be reached.
+	ErrNotRunning = errors.New("env-lease daemon is not running")
+	// ErrVersionMismatch is returned when the daemon speaks a protocol this
+	// package does not support, or does not know a command.
+	ErrVersionMismatch = errors.New("env-lease daemon version mismatch")
+	// ErrUnauthenticated is returned when the daemon's response is not signed
+	// with the auth token, e.g. because the token changed or the socket does
+	// not belong to env-lease.
+	ErrUnauthenticated = errors.New("env-lease daemon response could not be authenticated")
+)
+
+// Client talks to the env-lease daemon. It is safe for concurrent use.
+type Client struct {
+	instance   string
+	socketPath string
+	secret     []byte
+	timeout    time.Duration
+	ipc        *ipc.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithSocketPath connects to the daemon socket at path instead of the default
+// $XDG_RUNTIME_DIR/env-lease/daemon.sock.
+func WithSocketPath(path string) Option {
+	return func(c *Client) { c.socketPath = path }
+}
+
+// WithInstance connects to the named daemon instance instead of the one
+// selected by $ENV_LEASE_INSTANCE.
+func WithInstance(name string) Option {
+	return func(c *Client) { c.instance = name }
+}
+
+// WithSecret uses secret instead of reading the daemon's auth.token.
+func WithSecret(secret []byte) Option {
+	return func(c *Client) { c.secret = secret }
+}
+
+// WithTimeout sets how long a call may take. Zero disables the timeout, leaving
+// only the caller's context in control.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) { c.timeout = timeout }
+}
+
+// New creates a client for the daemon of the current user.
+func New(opts ...Option) (*Client, error) {
+	c := &Client{timeout: DefaultTimeout}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.instance == "" {
+		instance, err := xdgpath.EnvInstance()
+		if err != nil {
+			return nil, err
+		}
+		c.instance = instance
+	} else if err := xdgpath.ValidateInstance(c.instance); err != nil {
+		return nil, err
+	}
+	if c.socketPath == "" {
+		path, err := xdgpath.ResolveInstanceRuntimePath(c.instance, "daemon.sock")
+		if err != nil {
+			return nil, fmt.Errorf("could not determine daemon socket path: %w", err)
+		}
+		c.socketPath = path
+	}
+	if c.secret == nil {
+		path, err := xdgpath.ResolveInstanceStatePath(c.instance, "auth.token")
+		if err != nil {
+			return nil, fmt.Errorf("could not determine auth token path: %w", err)
+		}
+		secret, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("%w: no auth token at %s", ErrNotRunning, path)
+			}
+			return nil, fmt.Errorf("failed to read auth token: %w", err)
+		}
+		c.secret = secret
+	}
+
+	c.ipc = ipc.NewClient(c.socketPath, c.secret)
+	c.ipc.SetTimeout(c.timeout)
+	return c, nil
+}
+
+// SocketPath returns the daemon socket the client connects to.
+func (c *Client) SocketPath() string {
+	return c.socketPath
+}
+
+// Status returns the active and failed leases of configFile, the absolute path
+// to an env-lease.toml. An empty configFile returns leases of all projects.
+func (c *Client) Status(ctx context.Context, configFile string) (*Status, error) {
+	var resp ipc.StatusResponse
+	if err := c.send(ctx, ipc.StatusRequest{Command: "status", ConfigFile: configFile}, &resp); err != nil {
+		return nil, err
+	}
+
+	status := &Status{Leases: leasesFromIPC(resp.Leases)}
+	for _, f := range resp.Failed {
+		status.Failed = append(status.Failed, FailedRevocation{
+			Lease:          leaseFromIPC(f.Lease),
+			Attempts:       f.Attempts,
+			NextRetryTime:  f.NextRetryTime,
+			InitialFailure: f.InitialFailure,
+			LastError:      f.LastError,
+			DeadLetter:     f.DeadLetter,
+		})
+	}
+	if idle := resp.Idle; idle != nil {
+		status.Idle = &IdleStatus{
+			Source:    idle.Source,
+			Timeout:   idle.Timeout,
+			Idle:      idle.Idle,
+			CheckedAt: idle.CheckedAt,
+			Error:     idle.Error,
+		}
+	}
+	return status, nil
+}
+
+// Grant registers leases with the daemon, which revokes them when they
+// expire.
+func (c *Client) Grant(ctx context.Context, req GrantRequest) error {
+	payload := ipc.GrantRequest{
+		Command:    "grant",
+		Leases:     leasesToIPC(req.Leases),
+		Override:   req.Override,
+		Append:     req.Append,
+		ConfigFile: req.ConfigFile,
+	}
+	return c.send(ctx, payload, &ipc.GrantResponse{})
+}
+
+// Revoke revokes leases now.
+func (c *Client) Revoke(ctx context.Context, req RevokeRequest) (*RevokeResult, error) {
+	payload := ipc.RevokeRequest{
+		Command:    "revoke",
+		ConfigFile: req.ConfigFile,
+		All:        req.All,
+		Leases:     leasesToIPC(req.Leases),
+	}
+	var resp ipc.RevokeResponse
+	if err := c.send(ctx, payload, &resp); err != nil {
+		return nil, err
+	}
+	return &RevokeResult{Messages: resp.Messages, ShellCommands: resp.ShellCommands, ShellVariables: resp.ShellVariables}, nil
+}
+
+// Renew extends active leases without fetching their secrets again, and
+// returns the renewed leases.
+func (c *Client) Renew(ctx context.Context, req RenewRequest) ([]Lease, error) {
+	payload := ipc.RenewRequest{
+		Command:    "renew",
+		ConfigFile: req.ConfigFile,
+		All:        req.All,
+		Leases:     leasesToIPC(req.Leases),
+	}
+	if req.Duration > 0 {
+		payload.Duration = req.Duration.String()
+	}
+	var resp ipc.RenewResponse
+	if err := c.send(ctx, payload, &resp); err != nil {
+		return nil, err
+	}
+	return leasesFromIPC(resp.Leases), nil
+}
+
+// Subscribe calls handle for every lease event of configFile, or of all
+// projects if configFile is empty, until ctx is cancelled or handle returns an
+// error. It returns ctx.Err() when ctx is cancelled.
+func (c *Client) Subscribe(ctx context.Context, configFile string, handle func(Event) error) error {
+	req := ipc.SubscribeRequest{Command: "subscribe", ConfigFile: configFile}
+	err := c.ipc.Subscribe(ctx, req, func(payload json.RawMessage) error {
+		var event ipc.Event
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
+		return handle(eventFromIPC(event))
+	})
+	return translateError(err)
+}
+
+func (c *Client) send(ctx context.Context, payload any, resp any) error {
+	return translateError(c.ipc.Send(ctx, payload, resp))
+}
+
+// translateError maps internal IPC errors to the exported sentinel errors.
+func translateError(err error) error {
+	var connErr *ipc.ConnectionError
+	var versionErr *ipc.VersionMismatchError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &connErr):
+		return fmt.Errorf("%w: %v", ErrNotRunning, connErr.Err)
+	case errors.As(err, &versionErr):
+		return fmt.Errorf("%w: %s", ErrVersionMismatch, versionErr)
+	case errors.Is(err, ipc.ErrInvalidResponseSignature):
+		return fmt.Errorf("%w: %s", ErrUnauthenticated, err)
+	}
+	return err
+}
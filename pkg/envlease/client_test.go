@@ -0,0 +1,138 @@
+package envlease
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/config"
+	"github.com/mblarsen/env-lease/internal/daemon"
+	"github.com/mblarsen/env-lease/internal/ipc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nopRevoker struct{}
+
+func (nopRevoker) Revoke(*config.Lease) error { return nil }
+
+type nopNotifier struct{}
+
+func (nopNotifier) Notify(string, string) error { return nil }
+
+// startDaemon runs a daemon on a temporary socket and returns a client for it.
+func startDaemon(t *testing.T) *Client {
+	t.Helper()
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "daemon.sock")
+	secret := []byte("client-secret")
+
+	server, err := ipc.NewServer(socketPath, secret)
+	require.NoError(t, err)
+	d := daemon.NewDaemon(daemon.NewState(), filepath.Join(dir, "state.json"), &daemon.RealClock{}, server, nopRevoker{}, nopNotifier{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = d.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	client, err := New(WithSocketPath(socketPath), WithSecret(secret))
+	require.NoError(t, err)
+	return client
+}
+
+func TestClient(t *testing.T) {
+	client := startDaemon(t)
+	ctx := context.Background()
+	configFile := "/project/env-lease.toml"
+
+	events := make(chan Event, 10)
+	subCtx, stopSub := context.WithCancel(ctx)
+	subDone := make(chan error, 1)
+	go func() {
+		subDone <- client.Subscribe(subCtx, configFile, func(e Event) error {
+			events <- e
+			return nil
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	lease := Lease{Source: "op://vault/item/token", Destination: "/project/.envrc", Duration: "1h", LeaseType: "shell", Variable: "TOKEN", Format: "posix-sh", Transform: []string{"base64-decode"}, FileMode: "0600", OpAccount: "work", ShellSession: "shell-1"}
+	assert.Equal(t, "shell-1", leaseToIPC(lease).ShellSession)
+	require.NoError(t, client.Grant(ctx, GrantRequest{ConfigFile: configFile, Leases: []Lease{lease}}))
+
+	status, err := client.Status(ctx, configFile)
+	require.NoError(t, err)
+	require.Len(t, status.Leases, 1)
+	assert.Equal(t, "TOKEN", status.Leases[0].Variable)
+	assert.Equal(t, "1h", status.Leases[0].Duration)
+	assert.Equal(t, "posix-sh", status.Leases[0].Format)
+	assert.Equal(t, []string{"base64-decode"}, status.Leases[0].Transform)
+	assert.Equal(t, "0600", status.Leases[0].FileMode)
+	assert.Equal(t, "work", status.Leases[0].OpAccount)
+	expiresAt := status.Leases[0].ExpiresAt
+
+	renewed, err := client.Renew(ctx, RenewRequest{ConfigFile: configFile, Duration: 2 * time.Hour})
+	require.NoError(t, err)
+	require.Len(t, renewed, 1)
+	assert.True(t, renewed[0].ExpiresAt.After(expiresAt))
+
+	result, err := client.Revoke(ctx, RevokeRequest{ConfigFile: configFile})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"unset TOKEN"}, result.ShellCommands)
+	assert.Equal(t, []string{"TOKEN"}, result.ShellVariables)
+
+	var types []string
+	for len(types) < 3 {
+		select {
+		case e := <-events:
+			types = append(types, e.Type)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for events, got %v", types)
+		}
+	}
+	assert.Equal(t, []string{EventGranted, EventRenewed, EventRevoked}, types)
+
+	stopSub()
+	assert.ErrorIs(t, <-subDone, context.Canceled)
+}
+
+func TestClient_NotRunning(t *testing.T) {
+	client, err := New(WithSocketPath(filepath.Join(t.TempDir(), "missing.sock")), WithSecret([]byte("x")))
+	require.NoError(t, err)
+
+	_, err = client.Status(context.Background(), "")
+	assert.True(t, errors.Is(err, ErrNotRunning), "expected ErrNotRunning, got %v", err)
+}
+
+func TestNew_WithInstance(t *testing.T) {
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+
+	client, err := New(WithInstance("work"), WithSecret([]byte("x")))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(runtimeDir, "env-lease", "instances", "work", "daemon.sock"), client.SocketPath())
+	assert.NoDirExists(t, filepath.Join(runtimeDir, "env-lease"), "the client must not create directories")
+
+	stateHome := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateHome)
+	_, err = New(WithInstance("work"))
+	assert.ErrorIs(t, err, ErrNotRunning)
+	assert.NoDirExists(t, filepath.Join(stateHome, "env-lease"), "the client must not create directories")
+
+	_, err = New(WithInstance("../work"), WithSecret([]byte("x")))
+	assert.Error(t, err)
+
+	t.Setenv("ENV_LEASE_INSTANCE", "work.")
+	_, err = New(WithSecret([]byte("x")))
+	assert.Error(t, err, "an invalid $ENV_LEASE_INSTANCE must not fall back to the default instance")
+}
@@ -0,0 +1,15 @@
+// Package envlease is a Go client for the env-lease daemon.
+//
+// It lets other programs query and manage leases without scraping the output
+// of the env-lease CLI:
+//
+//	client, err := envlease.New()
+//	if err != nil {
+//		return err
+//	}
+//	status, err := client.Status(ctx, "")
+//
+// The client finds the daemon socket and auth token in the same places as the
+// CLI. It never starts the daemon, and creates no files or directories: the
+// token and socket must already be there.
+package envlease
@@ -0,0 +1,200 @@
+package envlease
+
+import (
+	"time"
+
+	"github.com/mblarsen/env-lease/internal/ipc"
+)
+
+// Lease is a secret the daemon is tracking.
+type Lease struct {
+	Source      string
+	Destination string
+	// Duration is the lease length as a Go duration string, e.g. "1h".
+	Duration     string
+	LeaseType    string
+	Variable     string
+	Format       string
+	Transform    []string
+	FileMode     string
+	ExpiresAt    time.Time
+	ConfigFile   string
+	OpAccount    string
+	ParentSource string
+	// RevokeOnLock revokes the lease when the session locks, suspends or
+	// ends. See the daemon's session_revoke setting.
+	RevokeOnLock bool
+	// IdleTimeout overrides the daemon's idle_timeout for this lease. "0"
+	// exempts it from idle revocation.
+	IdleTimeout string
+	// ShellSession identifies the shell a shell lease is granted to, so the
+	// shell hook can ask which of its leases are still active. It is only
+	// sent with grants; leases in responses leave it empty.
+	ShellSession string
+}
+
+// FailedRevocation is a lease the daemon could not revoke.
+type FailedRevocation struct {
+	Lease          Lease
+	Attempts       int
+	NextRetryTime  time.Time
+	InitialFailure time.Time
+	LastError      string
+	// DeadLetter is set once the daemon has stopped retrying on its own.
+	DeadLetter bool
+}
+
+// Status is the daemon's view of active and failed leases.
+type Status struct {
+	Leases []Lease
+	Failed []FailedRevocation
+	// Idle is nil unless the daemon revokes leases on idle.
+	Idle *IdleStatus
+}
+
+// IdleStatus reports how long the daemon has seen the user idle.
+type IdleStatus struct {
+	Source  string
+	Timeout time.Duration
+	Idle    time.Duration
+	// CheckedAt is zero before the daemon's first check.
+	CheckedAt time.Time
+	// Error is set when the last check failed.
+	Error string
+}
+
+// Event types delivered by Subscribe.
+const (
+	EventGranted       = ipc.EventGranted
+	EventRenewed       = ipc.EventRenewed
+	EventWarning       = ipc.EventWarning
+	EventExpired       = ipc.EventExpired
+	EventRevoked       = ipc.EventRevoked
+	EventRevokeFailed  = ipc.EventRevokeFailed
+	EventOrphaned      = ipc.EventOrphaned
+	EventConfigChanged = ipc.EventConfigChanged
+)
+
+// Event is a change to a lease, or to a project's config.
+type Event struct {
+	Type        string
+	Time        time.Time
+	Source      string
+	Destination string
+	Variable    string
+	LeaseType   string
+	ConfigFile  string
+	// ExpiresAt is nil for events that are not about a lease.
+	ExpiresAt *time.Time
+	Message   string
+}
+
+// GrantRequest registers leases with the daemon. The caller is responsible for
+// writing the secrets to their destinations first; the daemon only tracks and
+// later revokes them.
+type GrantRequest struct {
+	ConfigFile string
+	Leases     []Lease
+	// Override replaces existing values in destination files.
+	Override bool
+	// Append keeps active leases of ConfigFile that are not in Leases. By
+	// default they are revoked.
+	Append bool
+}
+
+// RevokeRequest selects leases to revoke. Leases takes precedence over
+// ConfigFile; All revokes every lease.
+type RevokeRequest struct {
+	ConfigFile string
+	All        bool
+	Leases     []Lease
+}
+
+// RevokeResult reports what a revoke did.
+type RevokeResult struct {
+	Messages []string
+	// ShellCommands must be evaluated by a POSIX shell to unset shell leases.
+	ShellCommands []string
+	// ShellVariables are the variables of the revoked shell leases.
+	ShellVariables []string
+}
+
+// RenewRequest selects leases to extend. Leases takes precedence over
+// ConfigFile; All renews every lease. Duration overrides each lease's own
+// duration when non-zero.
+type RenewRequest struct {
+	ConfigFile string
+	All        bool
+	Leases     []Lease
+	Duration   time.Duration
+}
+
+func leaseFromIPC(l ipc.Lease) Lease {
+	return Lease{
+		Source:       l.Source,
+		Destination:  l.Destination,
+		Duration:     l.Duration,
+		LeaseType:    l.LeaseType,
+		Variable:     l.Variable,
+		Format:       l.Format,
+		Transform:    l.Transform,
+		FileMode:     l.FileMode,
+		ExpiresAt:    l.ExpiresAt,
+		ConfigFile:   l.ConfigFile,
+		OpAccount:    l.OpAccount,
+		ParentSource: l.ParentSource,
+		RevokeOnLock: l.RevokeOnLock,
+		IdleTimeout:  l.IdleTimeout,
+		ShellSession: l.ShellSession,
+	}
+}
+
+func leaseToIPC(l Lease) ipc.Lease {
+	return ipc.Lease{
+		Source:       l.Source,
+		Destination:  l.Destination,
+		Duration:     l.Duration,
+		LeaseType:    l.LeaseType,
+		Variable:     l.Variable,
+		Format:       l.Format,
+		Transform:    l.Transform,
+		FileMode:     l.FileMode,
+		ExpiresAt:    l.ExpiresAt,
+		ConfigFile:   l.ConfigFile,
+		OpAccount:    l.OpAccount,
+		ParentSource: l.ParentSource,
+		RevokeOnLock: l.RevokeOnLock,
+		IdleTimeout:  l.IdleTimeout,
+		ShellSession: l.ShellSession,
+	}
+}
+
+func leasesFromIPC(leases []ipc.Lease) []Lease {
+	out := make([]Lease, 0, len(leases))
+	for _, l := range leases {
+		out = append(out, leaseFromIPC(l))
+	}
+	return out
+}
+
+func leasesToIPC(leases []Lease) []ipc.Lease {
+	out := make([]ipc.Lease, 0, len(leases))
+	for _, l := range leases {
+		out = append(out, leaseToIPC(l))
+	}
+	return out
+}
+
+func eventFromIPC(e ipc.Event) Event {
+	return Event{
+		Type:        e.Type,
+		Time:        e.Time,
+		Source:      e.Source,
+		Destination: e.Destination,
+		Variable:    e.Variable,
+		LeaseType:   e.LeaseType,
+		ConfigFile:  e.ConfigFile,
+		ExpiresAt:   e.ExpiresAt,
+		Message:     e.Message,
+	}
+}